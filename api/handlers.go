@@ -1,11 +1,18 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ad-delivery-simulator/internal/auction"
 	"github.com/ad-delivery-simulator/internal/campaign"
+	"github.com/ad-delivery-simulator/internal/creative"
+	"github.com/ad-delivery-simulator/internal/deal"
+	"github.com/ad-delivery-simulator/internal/inventory"
 	"github.com/ad-delivery-simulator/internal/models"
 	"github.com/ad-delivery-simulator/internal/tracking"
 	"github.com/gin-gonic/gin"
@@ -14,23 +21,32 @@ import (
 )
 
 type Handlers struct {
-	auctionEngine   *auction.Engine
-	campaignService *campaign.Service
-	trackingService *tracking.Service
-	logger          *logrus.Logger
+	auctionEngine    *auction.Engine
+	campaignService  *campaign.Service
+	creativeService  *creative.Service
+	dealService      *deal.Service
+	inventoryService *inventory.Service
+	trackingService  *tracking.Service
+	logger           *logrus.Logger
 }
 
 func NewHandlers(
 	auctionEngine *auction.Engine,
 	campaignService *campaign.Service,
+	creativeService *creative.Service,
+	dealService *deal.Service,
+	inventoryService *inventory.Service,
 	trackingService *tracking.Service,
 	logger *logrus.Logger,
 ) *Handlers {
 	return &Handlers{
-		auctionEngine:   auctionEngine,
-		campaignService: campaignService,
-		trackingService: trackingService,
-		logger:          logger,
+		auctionEngine:    auctionEngine,
+		campaignService:  campaignService,
+		creativeService:  creativeService,
+		dealService:      dealService,
+		inventoryService: inventoryService,
+		trackingService:  trackingService,
+		logger:           logger,
 	}
 }
 
@@ -46,7 +62,12 @@ func (h *Handlers) HandleBidRequest(c *gin.Context) {
 		request.ID = uuid.New().String()
 	}
 
-	response, err := h.auctionEngine.RunAuction(c.Request.Context(), &request)
+	ctx := c.Request.Context()
+	if traceHeader, _ := strconv.ParseBool(c.GetHeader(auction.TraceHeader)); traceHeader {
+		ctx = auction.WithTrace(ctx)
+	}
+
+	response, err := h.auctionEngine.RunAuction(ctx, &request)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to run auction")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Auction failed"})
@@ -56,6 +77,22 @@ func (h *Handlers) HandleBidRequest(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+func (h *Handlers) GetAuctionTrace(c *gin.Context) {
+	trace, err := h.auctionEngine.GetTrace(c.Param("id"))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get auction trace")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get auction trace"})
+		return
+	}
+
+	if trace == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Auction trace not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, trace)
+}
+
 func (h *Handlers) CreateCampaign(c *gin.Context) {
 	var campaign models.Campaign
 	if err := c.ShouldBindJSON(&campaign); err != nil {
@@ -64,7 +101,16 @@ func (h *Handlers) CreateCampaign(c *gin.Context) {
 		return
 	}
 
+	if validationErr := h.checkInventoryLists(&campaign); validationErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error(), "details": validationErr})
+		return
+	}
+
 	if err := h.campaignService.CreateCampaign(c.Request.Context(), &campaign); err != nil {
+		if validationErr, ok := asValidationError(err); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error(), "details": validationErr})
+			return
+		}
 		h.logger.WithError(err).Error("Failed to create campaign")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create campaign"})
 		return
@@ -106,7 +152,16 @@ func (h *Handlers) UpdateCampaign(c *gin.Context) {
 
 	campaign.ID = campaignID
 
+	if validationErr := h.checkInventoryLists(&campaign); validationErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error(), "details": validationErr})
+		return
+	}
+
 	if err := h.campaignService.UpdateCampaign(c.Request.Context(), &campaign); err != nil {
+		if validationErr, ok := asValidationError(err); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error(), "details": validationErr})
+			return
+		}
 		h.logger.WithError(err).Error("Failed to update campaign")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update campaign"})
 		return
@@ -145,12 +200,373 @@ func (h *Handlers) GetCampaignPerformance(c *gin.Context) {
 	c.JSON(http.StatusOK, metrics)
 }
 
+func (h *Handlers) GetUserSegments(c *gin.Context) {
+	segments, err := h.campaignService.UserSegments(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get user segments")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user segments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": c.Param("id"), "segments": segments})
+}
+
+func (h *Handlers) SetUserSegments(c *gin.Context) {
+	var request struct {
+		Segments []string `json:"segments"`
+		TTL      string   `json:"ttl"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	var ttl time.Duration
+	if request.TTL != "" {
+		parsed, err := time.ParseDuration(request.TTL)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ttl"})
+			return
+		}
+		ttl = parsed
+	}
+
+	if err := h.campaignService.SetUserSegments(c.Request.Context(), c.Param("id"), request.Segments, ttl); err != nil {
+		h.logger.WithError(err).Error("Failed to set user segments")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set user segments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": c.Param("id"), "segments": request.Segments})
+}
+
+func (h *Handlers) CreateCreative(c *gin.Context) {
+	var creative models.AdCreative
+	if err := c.ShouldBindJSON(&creative); err != nil {
+		h.logger.WithError(err).Error("Failed to parse creative request")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid creative format"})
+		return
+	}
+
+	if err := h.creativeService.CreateCreative(c.Request.Context(), &creative); err != nil {
+		if validationErr, ok := asValidationError(err); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error(), "details": validationErr})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to create creative")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create creative"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, creative)
+}
+
+func (h *Handlers) ListCreatives(c *gin.Context) {
+	campaignID, err := uuid.Parse(c.Query("campaign_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	creatives, err := h.creativeService.ListCreatives(c.Request.Context(), campaignID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list creatives")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list creatives"})
+		return
+	}
+
+	c.JSON(http.StatusOK, creatives)
+}
+
+func (h *Handlers) GetCreative(c *gin.Context) {
+	creativeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid creative ID"})
+		return
+	}
+
+	creative, err := h.creativeService.GetCreative(c.Request.Context(), creativeID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get creative")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Creative not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, creative)
+}
+
+func (h *Handlers) UpdateCreative(c *gin.Context) {
+	creativeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid creative ID"})
+		return
+	}
+
+	var creative models.AdCreative
+	if err := c.ShouldBindJSON(&creative); err != nil {
+		h.logger.WithError(err).Error("Failed to parse creative request")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid creative format"})
+		return
+	}
+
+	creative.ID = creativeID
+
+	if err := h.creativeService.UpdateCreative(c.Request.Context(), &creative); err != nil {
+		if validationErr, ok := asValidationError(err); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error(), "details": validationErr})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to update creative")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update creative"})
+		return
+	}
+
+	c.JSON(http.StatusOK, creative)
+}
+
+func (h *Handlers) DeleteCreative(c *gin.Context) {
+	creativeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid creative ID"})
+		return
+	}
+
+	if err := h.creativeService.DeleteCreative(c.Request.Context(), creativeID); err != nil {
+		h.logger.WithError(err).Error("Failed to delete creative")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete creative"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+func (h *Handlers) CreateDeal(c *gin.Context) {
+	var deal models.PrivateDeal
+	if err := c.ShouldBindJSON(&deal); err != nil {
+		h.logger.WithError(err).Error("Failed to parse deal request")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deal format"})
+		return
+	}
+
+	if err := h.dealService.CreateDeal(c.Request.Context(), &deal); err != nil {
+		if validationErr, ok := asValidationError(err); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error(), "details": validationErr})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to create deal")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create deal"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, deal)
+}
+
+func (h *Handlers) ListDeals(c *gin.Context) {
+	deals, err := h.dealService.ListDeals(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list deals")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list deals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deals)
+}
+
+func (h *Handlers) GetDeal(c *gin.Context) {
+	deal, err := h.dealService.GetDeal(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get deal")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deal not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deal)
+}
+
+func (h *Handlers) UpdateDeal(c *gin.Context) {
+	var deal models.PrivateDeal
+	if err := c.ShouldBindJSON(&deal); err != nil {
+		h.logger.WithError(err).Error("Failed to parse deal request")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deal format"})
+		return
+	}
+
+	deal.ID = c.Param("id")
+
+	if err := h.dealService.UpdateDeal(c.Request.Context(), &deal); err != nil {
+		if validationErr, ok := asValidationError(err); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error(), "details": validationErr})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to update deal")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update deal"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deal)
+}
+
+func (h *Handlers) DeleteDeal(c *gin.Context) {
+	if err := h.dealService.DeleteDeal(c.Request.Context(), c.Param("id")); err != nil {
+		h.logger.WithError(err).Error("Failed to delete deal")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete deal"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// checkInventoryLists rejects campaigns that attach inventory lists which
+// don't exist.
+func (h *Handlers) checkInventoryLists(campaign *models.Campaign) *models.ValidationError {
+	if campaign.TargetingRules == nil || campaign.TargetingRules.InventoryLists == nil {
+		return nil
+	}
+
+	refs := campaign.TargetingRules.InventoryLists
+	for _, id := range append(append([]uuid.UUID(nil), refs.Allow...), refs.Block...) {
+		if !h.inventoryService.Exists(id) {
+			return &models.ValidationError{Field: "targeting_rules.inventory_lists", Message: fmt.Sprintf("list %s does not exist", id)}
+		}
+	}
+	return nil
+}
+
+func (h *Handlers) CreateInventoryList(c *gin.Context) {
+	var list models.InventoryList
+	if err := c.ShouldBindJSON(&list); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid inventory list format"})
+		return
+	}
+
+	if err := h.inventoryService.CreateList(c.Request.Context(), &list); err != nil {
+		if validationErr, ok := asValidationError(err); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error(), "details": validationErr})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to create inventory list")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create inventory list"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, list)
+}
+
+func (h *Handlers) ListInventoryLists(c *gin.Context) {
+	lists, err := h.inventoryService.ListLists(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list inventory lists")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list inventory lists"})
+		return
+	}
+
+	c.JSON(http.StatusOK, lists)
+}
+
+func (h *Handlers) GetInventoryList(c *gin.Context) {
+	listID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid list ID"})
+		return
+	}
+
+	list, err := h.inventoryService.GetList(c.Request.Context(), listID)
+	if err != nil {
+		if errors.Is(err, inventory.ErrListNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Inventory list not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to get inventory list")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get inventory list"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handlers) DeleteInventoryList(c *gin.Context) {
+	listID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid list ID"})
+		return
+	}
+
+	if err := h.inventoryService.DeleteList(c.Request.Context(), listID); err != nil {
+		if errors.Is(err, inventory.ErrListNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Inventory list not found"})
+			return
+		}
+		if errors.Is(err, inventory.ErrListInUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to delete inventory list")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete inventory list"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Inventory list deleted"})
+}
+
+// maxUploadBytes bounds a bulk upload body, about a million domains.
+const maxUploadBytes = 64 << 20
+
+// UploadInventoryEntries adds entries to a list (POST) or replaces them
+// (PUT). The body is one entry per line; blank lines and lines starting
+// with # are skipped. Nothing is saved if any entry is invalid.
+func (h *Handlers) UploadInventoryEntries(c *gin.Context) {
+	listID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid list ID"})
+		return
+	}
+
+	list, err := h.inventoryService.GetList(c.Request.Context(), listID)
+	if err != nil {
+		if errors.Is(err, inventory.ErrListNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Inventory list not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to get inventory list")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get inventory list"})
+		return
+	}
+
+	entries, invalid, err := inventory.ParseEntries(http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadBytes), list.Type)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to read entries: %v", err)})
+		return
+	}
+	if len(invalid) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload has invalid entries", "details": invalid})
+		return
+	}
+
+	replace := c.Request.Method == http.MethodPut
+	list, err = h.inventoryService.UploadEntries(c.Request.Context(), listID, entries, replace)
+	if err != nil {
+		if errors.Is(err, inventory.ErrListNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Inventory list not found"})
+			return
+		}
+		h.logger.WithError(err).WithField("list_id", listID).Error("Failed to upload inventory list entries")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"list": list, "uploaded": len(entries)})
+}
+
 func (h *Handlers) TrackImpression(c *gin.Context) {
 	var request struct {
 		CampaignID string `json:"campaign_id" binding:"required"`
 		CreativeID string `json:"creative_id"`
 		UserID     string `json:"user_id"`
 		SessionID  string `json:"session_id"`
+		SiteID     string `json:"site_id"`
+		DeviceType int    `json:"device_type"`
+		Test       int    `json:"test"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -177,6 +593,9 @@ func (h *Handlers) TrackImpression(c *gin.Context) {
 		IP:         c.ClientIP(),
 		UserAgent:  c.Request.UserAgent(),
 		Referrer:   c.Request.Referer(),
+		SiteID:     request.SiteID,
+		DeviceType: request.DeviceType,
+		Test:       request.Test == 1,
 	}
 
 	if err := h.trackingService.TrackImpression(c.Request.Context(), event); err != nil {
@@ -194,6 +613,9 @@ func (h *Handlers) TrackClick(c *gin.Context) {
 		CreativeID string `json:"creative_id"`
 		UserID     string `json:"user_id"`
 		SessionID  string `json:"session_id"`
+		SiteID     string `json:"site_id"`
+		DeviceType int    `json:"device_type"`
+		Test       int    `json:"test"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -220,6 +642,9 @@ func (h *Handlers) TrackClick(c *gin.Context) {
 		IP:         c.ClientIP(),
 		UserAgent:  c.Request.UserAgent(),
 		Referrer:   c.Request.Referer(),
+		SiteID:     request.SiteID,
+		DeviceType: request.DeviceType,
+		Test:       request.Test == 1,
 	}
 
 	if err := h.trackingService.TrackClick(c.Request.Context(), event); err != nil {
@@ -231,12 +656,199 @@ func (h *Handlers) TrackClick(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "success", "event_id": event.ID})
 }
 
+// TrackImpressionPixel and TrackVideoEvent serve the GET beacons embedded in
+// VAST markup, so they answer with an empty 204 rather than a JSON body.
+func (h *Handlers) TrackImpressionPixel(c *gin.Context) {
+	event, ok := pixelEvent(c)
+	if !ok {
+		return
+	}
+
+	if err := h.trackingService.TrackImpression(c.Request.Context(), event); err != nil {
+		h.logger.WithError(err).Error("Failed to track impression")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track impression"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handlers) TrackVideoEvent(c *gin.Context) {
+	event, ok := pixelEvent(c)
+	if !ok {
+		return
+	}
+	event.Type = models.EventType(c.Query("event"))
+
+	if err := h.trackingService.TrackVideoEvent(c.Request.Context(), event); err != nil {
+		h.logger.WithError(err).WithField("event", event.Type).Error("Failed to track video event")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to track video event"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handlers) TrackWinNotice(c *gin.Context) {
+	notice, ok := h.auctionNotice(c, "price")
+	if !ok {
+		return
+	}
+
+	if err := h.trackingService.TrackWin(c.Request.Context(), notice); err != nil {
+		h.logger.WithError(err).Error("Failed to track win notice")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track win notice"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handlers) TrackBillingNotice(c *gin.Context) {
+	notice, ok := h.auctionNotice(c, "price")
+	if !ok {
+		return
+	}
+
+	if err := h.trackingService.TrackBilling(c.Request.Context(), notice); err != nil {
+		if errors.Is(err, tracking.ErrNoBudgetHold) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to track billing notice")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track billing notice"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handlers) TrackLossNotice(c *gin.Context) {
+	notice, ok := h.auctionNotice(c, "reason")
+	if !ok {
+		return
+	}
+
+	if err := h.trackingService.TrackLoss(c.Request.Context(), notice); err != nil {
+		h.logger.WithError(err).Error("Failed to track loss notice")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track loss notice"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// auctionNotice reads a notice URL whose ${AUCTION_*} macros have been
+// substituted by the exchange. required names the macro-backed parameter the
+// notice cannot do without: the clearing price or the loss reason. A price
+// or auction ID the exchange left unexpanded is filled in from the stored
+// auction; any other unexpanded macro is rejected.
+func (h *Handlers) auctionNotice(c *gin.Context, required string) (*models.AuctionNotice, bool) {
+	unexpanded := make(map[string]bool)
+	for key, values := range c.Request.URL.Query() {
+		for _, value := range values {
+			if !strings.Contains(value, "${") {
+				continue
+			}
+			if key != "auction_id" && !(key == "price" && required == "price") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unexpanded macro in %s", key)})
+				return nil, false
+			}
+			unexpanded[key] = true
+		}
+	}
+
+	notice := &models.AuctionNotice{
+		BidID: c.Query("bid_id"),
+		Test:  c.Query("test") == "1",
+	}
+	if notice.BidID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing bid ID"})
+		return nil, false
+	}
+	if !unexpanded["auction_id"] {
+		notice.AuctionID = c.Query("auction_id")
+	}
+
+	campaignID, err := uuid.Parse(c.Query("campaign_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return nil, false
+	}
+	notice.CampaignID = campaignID
+
+	switch required {
+	case "price":
+		if unexpanded["price"] {
+			break
+		}
+		price, err := strconv.ParseFloat(c.Query("price"), 64)
+		if err != nil || price < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid auction price"})
+			return nil, false
+		}
+		notice.Price = price
+	case "reason":
+		reason, err := strconv.Atoi(c.Query("reason"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loss reason"})
+			return nil, false
+		}
+		notice.LossReason = reason
+	}
+
+	if len(unexpanded) > 0 {
+		if err := h.trackingService.FillNotice(c.Request.Context(), notice, unexpanded["price"]); err != nil {
+			if errors.Is(err, tracking.ErrUnexpandedMacro) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return nil, false
+			}
+			h.logger.WithError(err).Error("Failed to fill notice macros")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fill notice macros"})
+			return nil, false
+		}
+	}
+
+	return notice, true
+}
+
+func pixelEvent(c *gin.Context) (*models.TrackingEvent, bool) {
+	campaignID, err := uuid.Parse(c.Query("campaign_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return nil, false
+	}
+
+	var creativeID uuid.UUID
+	if raw := c.Query("creative_id"); raw != "" {
+		creativeID, _ = uuid.Parse(raw)
+	}
+
+	deviceType, _ := strconv.Atoi(c.Query("device_type"))
+
+	return &models.TrackingEvent{
+		CampaignID: campaignID,
+		CreativeID: creativeID,
+		UserID:     c.Query("user_id"),
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		Referrer:   c.Request.Referer(),
+		Metadata:   c.Query("bid_id"),
+		SiteID:     c.Query("site_id"),
+		DeviceType: deviceType,
+		Test:       c.Query("test") == "1",
+	}, true
+}
+
 func (h *Handlers) TrackConversion(c *gin.Context) {
 	var request struct {
 		CampaignID string  `json:"campaign_id" binding:"required"`
 		UserID     string  `json:"user_id"`
 		Value      float64 `json:"value"`
 		SessionID  string  `json:"session_id"`
+		SiteID     string  `json:"site_id"`
+		DeviceType int     `json:"device_type"`
+		Test       int     `json:"test"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -257,6 +869,9 @@ func (h *Handlers) TrackConversion(c *gin.Context) {
 		IP:         c.ClientIP(),
 		UserAgent:  c.Request.UserAgent(),
 		Price:      request.Value,
+		SiteID:     request.SiteID,
+		DeviceType: request.DeviceType,
+		Test:       request.Test == 1,
 	}
 
 	if err := h.trackingService.TrackConversion(c.Request.Context(), event); err != nil {
@@ -313,6 +928,14 @@ func (h *Handlers) GetRealTimeMetrics(c *gin.Context) {
 	c.JSON(http.StatusOK, metrics)
 }
 
+func asValidationError(err error) (*models.ValidationError, bool) {
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr, true
+	}
+	return nil, false
+}
+
 func (h *Handlers) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status": "healthy",
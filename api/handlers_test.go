@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/campaign"
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/sqltest"
+	"github.com/ad-delivery-simulator/internal/tracking"
+	"github.com/ad-delivery-simulator/pkg/kafka"
+	"github.com/ad-delivery-simulator/pkg/redis"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newNoticeRouter(t *testing.T) (*gin.Engine, *campaign.Service, *redis.Client) {
+	server := miniredis.RunT(t)
+	redisClient, err := redis.NewClient(server.Addr(), "", 0, logrus.New())
+	require.NoError(t, err)
+	t.Cleanup(func() { redisClient.Close() })
+
+	db, mock := sqltest.Open(t)
+	mock.OnExec("UPDATE campaigns", 1)
+
+	logger := logrus.New()
+	brokers := []string{"127.0.0.1:1"}
+	producer := kafka.NewProducer(brokers, logger)
+	campaignService := campaign.NewService(db, redisClient, producer, brokers, logger)
+	trackingService := tracking.NewService(db, redisClient, producer, campaignService, brokers, logger)
+	handlers := NewHandlers(nil, campaignService, nil, nil, nil, trackingService, logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/track/win", handlers.TrackWinNotice)
+	router.GET("/track/billing", handlers.TrackBillingNotice)
+	router.GET("/track/loss", handlers.TrackLossNotice)
+	return router, campaignService, redisClient
+}
+
+func TestHandlers_AuctionNotices(t *testing.T) {
+	router, campaignService, redisClient := newNoticeRouter(t)
+	ctx := context.Background()
+	campaignID := uuid.New()
+	require.NoError(t, redisClient.SetCampaignBudget(campaignID.String(), 10, 100))
+
+	for _, bidID := range []string{"bid-1", "bid-2", "bid-3"} {
+		allowed, err := campaignService.HoldBudget(ctx, &models.BudgetHold{BidID: bidID, CampaignID: campaignID, AuctionID: "auction-1", Amount: 1.5}, time.Minute)
+		require.NoError(t, err)
+		require.True(t, allowed)
+	}
+
+	query := "&campaign_id=" + campaignID.String()
+	tests := []struct {
+		name     string
+		url      string
+		expected int
+	}{
+		{"Win", "/track/win?bid_id=bid-1&auction_id=auction-1&price=1.2" + query, http.StatusNoContent},
+		{"Win with unexpanded macros", "/track/win?bid_id=bid-1&auction_id=${AUCTION_ID}&price=${AUCTION_PRICE}" + query, http.StatusNoContent},
+		{"Billing with unexpanded price", "/track/billing?bid_id=bid-1&auction_id=auction-1&price=${AUCTION_PRICE}" + query, http.StatusNoContent},
+		{"Billing twice", "/track/billing?bid_id=bid-1&auction_id=auction-1&price=1.2" + query, http.StatusNotFound},
+		{"Billing with test=1 added", "/track/billing?bid_id=bid-2&auction_id=auction-1&price=1.2&test=1" + query, http.StatusNoContent},
+		{"Loss", "/track/loss?bid_id=bid-3&auction_id=${AUCTION_ID}&reason=102" + query, http.StatusNoContent},
+		{"Loss with unexpanded reason", "/track/loss?bid_id=bid-3&auction_id=auction-1&reason=${AUCTION_LOSS}" + query, http.StatusBadRequest},
+		{"Unexpanded price and nothing stored", "/track/billing?bid_id=bid-4&auction_id=auction-1&price=${AUCTION_PRICE}" + query, http.StatusBadRequest},
+		{"Unexpanded bid ID", "/track/billing?bid_id=${BID_ID}&auction_id=auction-1&price=1" + query, http.StatusBadRequest},
+		{"Missing bid ID", "/track/win?auction_id=auction-1&price=1" + query, http.StatusBadRequest},
+		{"Invalid campaign ID", "/track/win?bid_id=bid-1&auction_id=auction-1&price=1&campaign_id=nope", http.StatusBadRequest},
+		{"Negative price", "/track/win?bid_id=bid-1&auction_id=auction-1&price=-1" + query, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			assert.Equal(t, tt.expected, recorder.Code, recorder.Body.String())
+		})
+	}
+
+	delivered, _, err := redisClient.GetDelivery(campaignID.String(), time.Now().Format("2006-01-02"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), delivered, "the bid with test=1 added is billed like any other")
+
+	hold, err := campaignService.BudgetHold(ctx, "bid-3")
+	require.NoError(t, err)
+	assert.Nil(t, hold, "the loss released the hold")
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"time"
 
+	"github.com/ad-delivery-simulator/internal/auction"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -21,7 +22,7 @@ func SetupRouter(handlers *Handlers, logger *logrus.Logger) *gin.Engine {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", auction.TraceHeader},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -33,6 +34,7 @@ func SetupRouter(handlers *Handlers, logger *logrus.Logger) *gin.Engine {
 	api := router.Group("/api/v1")
 	{
 		api.POST("/bid-request", RateLimitMiddleware(1000), handlers.HandleBidRequest)
+		api.GET("/auctions/:id/trace", handlers.GetAuctionTrace)
 
 		campaigns := api.Group("/campaigns")
 		{
@@ -45,11 +47,50 @@ func SetupRouter(handlers *Handlers, logger *logrus.Logger) *gin.Engine {
 			campaigns.GET("/:id/metrics", handlers.GetRealTimeMetrics)
 		}
 
+		users := api.Group("/users")
+		{
+			users.GET("/:id/segments", handlers.GetUserSegments)
+			users.PUT("/:id/segments", handlers.SetUserSegments)
+		}
+
+		creatives := api.Group("/creatives")
+		{
+			creatives.POST("", handlers.CreateCreative)
+			creatives.GET("", handlers.ListCreatives)
+			creatives.GET("/:id", handlers.GetCreative)
+			creatives.PUT("/:id", handlers.UpdateCreative)
+			creatives.DELETE("/:id", handlers.DeleteCreative)
+		}
+
+		deals := api.Group("/deals")
+		{
+			deals.POST("", handlers.CreateDeal)
+			deals.GET("", handlers.ListDeals)
+			deals.GET("/:id", handlers.GetDeal)
+			deals.PUT("/:id", handlers.UpdateDeal)
+			deals.DELETE("/:id", handlers.DeleteDeal)
+		}
+
+		lists := api.Group("/lists")
+		{
+			lists.POST("", handlers.CreateInventoryList)
+			lists.GET("", handlers.ListInventoryLists)
+			lists.GET("/:id", handlers.GetInventoryList)
+			lists.DELETE("/:id", handlers.DeleteInventoryList)
+			lists.POST("/:id/entries", handlers.UploadInventoryEntries)
+			lists.PUT("/:id/entries", handlers.UploadInventoryEntries)
+		}
+
 		tracking := api.Group("/track")
 		{
 			tracking.POST("/impression", RateLimitMiddleware(10000), handlers.TrackImpression)
 			tracking.POST("/click", RateLimitMiddleware(5000), handlers.TrackClick)
 			tracking.POST("/conversion", RateLimitMiddleware(1000), handlers.TrackConversion)
+			tracking.GET("/impression", RateLimitMiddleware(10000), handlers.TrackImpressionPixel)
+			tracking.GET("/video", RateLimitMiddleware(10000), handlers.TrackVideoEvent)
+			tracking.GET("/win", RateLimitMiddleware(10000), handlers.TrackWinNotice)
+			tracking.GET("/billing", RateLimitMiddleware(10000), handlers.TrackBillingNotice)
+			tracking.GET("/loss", RateLimitMiddleware(10000), handlers.TrackLossNotice)
 		}
 	}
 
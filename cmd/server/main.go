@@ -14,6 +14,11 @@ import (
 	"github.com/ad-delivery-simulator/config"
 	"github.com/ad-delivery-simulator/internal/auction"
 	"github.com/ad-delivery-simulator/internal/campaign"
+	"github.com/ad-delivery-simulator/internal/creative"
+	"github.com/ad-delivery-simulator/internal/deal"
+	"github.com/ad-delivery-simulator/internal/inventory"
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/prediction"
 	"github.com/ad-delivery-simulator/internal/tracking"
 	kafkapkg "github.com/ad-delivery-simulator/pkg/kafka"
 	redispkg "github.com/ad-delivery-simulator/pkg/redis"
@@ -59,20 +64,56 @@ func main() {
 	defer kafkaConsumer.Close()
 
 	campaignService := campaign.NewService(db, redisClient, kafkaProducer, cfg.Kafka.Brokers, logger)
+	dealService := deal.NewService(db, logger)
+	creativeService := creative.NewService(db, logger)
+	inventoryService := inventory.NewService(db, logger)
 	trackingService := tracking.NewService(db, redisClient, kafkaProducer, campaignService, cfg.Kafka.Brokers, logger)
-	auctionEngine := auction.NewEngine(campaignService, redisClient, kafkaProducer, cfg.Kafka.Brokers, logger)
+	predictor := prediction.NewModel(redisClient, prediction.Config{
+		PriorCTR:         cfg.Prediction.PriorCTR,
+		PriorCVR:         cfg.Prediction.PriorCVR,
+		ImpressionWeight: cfg.Prediction.ImpressionWeight,
+		ClickWeight:      cfg.Prediction.ClickWeight,
+		MaxImpressions:   cfg.Prediction.MaxImpressions,
+	}, logger)
+	auctionEngine := auction.NewEngine(campaignService, dealService, creativeService, inventoryService, predictor, redisClient, kafkaProducer, cfg.Kafka.Brokers, auction.Config{
+		DefaultAuctionType: models.AuctionType(cfg.Auction.DefaultType),
+		TrackingBaseURL:    cfg.Auction.TrackingBaseURL,
+		BillingTimeout:     cfg.Auction.BillingTimeout,
+	}, logger)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	if err := campaignService.StartIndex(ctx, kafkaConsumer, instanceGroup(cfg.Kafka.ConsumerGroup, "campaign-index"), time.Minute); err != nil {
+		logger.WithError(err).Fatal("Failed to load campaign index")
+	}
+
+	if err := predictor.Start(ctx, kafkaConsumer, cfg.Kafka.Brokers, instanceGroup(cfg.Kafka.ConsumerGroup, "prediction"), cfg.Prediction.SnapshotInterval); err != nil {
+		logger.WithError(err).Fatal("Failed to load prediction model")
+	}
+
+	if err := dealService.Start(ctx, time.Minute); err != nil {
+		logger.WithError(err).Fatal("Failed to load deals")
+	}
+
+	if err := creativeService.Start(ctx, time.Minute); err != nil {
+		logger.WithError(err).Fatal("Failed to load creatives")
+	}
+
+	if err := inventoryService.Start(ctx, time.Minute); err != nil {
+		logger.WithError(err).Fatal("Failed to load inventory lists")
+	}
+
 	trackingService.Start(ctx)
 	defer trackingService.Stop()
 
 	go startDailyBudgetResetScheduler(ctx, campaignService, logger)
 
+	go startBudgetHoldReaper(ctx, campaignService, logger)
+
 	go startKafkaConsumers(ctx, kafkaConsumer, cfg.Kafka, logger)
 
-	handlers := api.NewHandlers(auctionEngine, campaignService, trackingService, logger)
+	handlers := api.NewHandlers(auctionEngine, campaignService, creativeService, dealService, inventoryService, trackingService, logger)
 	
 	if cfg.Server.Mode == "release" {
 		gin.SetMode(gin.ReleaseMode)
@@ -181,6 +222,16 @@ func runMigrations(db *sql.DB) error {
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_campaigns_status ON campaigns(status)`,
 		`CREATE INDEX IF NOT EXISTS idx_campaigns_advertiser ON campaigns(advertiser_id)`,
+		`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS bid_strategy VARCHAR(50)`,
+		`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS bid_strategy_params JSONB`,
+		`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS deal_ids JSONB`,
+		`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS seat VARCHAR(255)`,
+		`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS advertiser_domains JSONB`,
+		`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS categories JSONB`,
+		`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS app_bundle VARCHAR(255)`,
+		`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS competitive_labels JSONB`,
+		`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS priority VARCHAR(20)`,
+		`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS delivery_goal JSONB`,
 		`CREATE TABLE IF NOT EXISTS tracking_events (
 			id UUID PRIMARY KEY,
 			type VARCHAR(50) NOT NULL,
@@ -199,6 +250,8 @@ func runMigrations(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_tracking_campaign ON tracking_events(campaign_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_tracking_type ON tracking_events(type)`,
 		`CREATE INDEX IF NOT EXISTS idx_tracking_timestamp ON tracking_events(timestamp)`,
+		`ALTER TABLE tracking_events ADD COLUMN IF NOT EXISTS site_id VARCHAR(255)`,
+		`ALTER TABLE tracking_events ADD COLUMN IF NOT EXISTS device_type INT`,
 		`CREATE TABLE IF NOT EXISTS ad_creatives (
 			id UUID PRIMARY KEY,
 			campaign_id UUID NOT NULL REFERENCES campaigns(id),
@@ -216,6 +269,38 @@ func runMigrations(db *sql.DB) error {
 			updated_at TIMESTAMP DEFAULT NOW()
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_creatives_campaign ON ad_creatives(campaign_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_creatives_status ON ad_creatives(status)`,
+		`ALTER TABLE ad_creatives ADD COLUMN IF NOT EXISTS duration INT`,
+		`ALTER TABLE ad_creatives ADD COLUMN IF NOT EXISTS mime_type VARCHAR(100)`,
+		`ALTER TABLE ad_creatives ADD COLUMN IF NOT EXISTS skippable BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE ad_creatives ADD COLUMN IF NOT EXISTS skip_offset INT`,
+		`ALTER TABLE ad_creatives ADD COLUMN IF NOT EXISTS native_assets JSONB`,
+		`CREATE TABLE IF NOT EXISTS deals (
+			id VARCHAR(255) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			publisher_id VARCHAR(255),
+			bid_floor DECIMAL(10, 4) DEFAULT 0,
+			priority INT DEFAULT 0,
+			status VARCHAR(50) NOT NULL,
+			start_date TIMESTAMP,
+			end_date TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_deals_status ON deals(status)`,
+		`CREATE TABLE IF NOT EXISTS inventory_lists (
+			id UUID PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			entry_count INT DEFAULT 0,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		)`,
+		`CREATE TABLE IF NOT EXISTS inventory_list_entries (
+			list_id UUID NOT NULL REFERENCES inventory_lists(id) ON DELETE CASCADE,
+			value VARCHAR(255) NOT NULL,
+			PRIMARY KEY (list_id, value)
+		)`,
 	}
 
 	for _, migration := range migrations {
@@ -247,6 +332,37 @@ func startDailyBudgetResetScheduler(ctx context.Context, campaignService *campai
 	}
 }
 
+// instanceGroup gives each instance its own consumer group for purpose, so
+// in-memory state such as the campaign index sees every message on the topic.
+func instanceGroup(consumerGroup, purpose string) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = fmt.Sprintf("pid-%d", os.Getpid())
+	}
+	return fmt.Sprintf("%s-%s-%s", consumerGroup, purpose, hostname)
+}
+
+func startBudgetHoldReaper(ctx context.Context, campaignService *campaign.Service, logger *logrus.Logger) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			released, err := campaignService.ReleaseExpiredHolds(ctx)
+			if err != nil {
+				logger.WithError(err).Error("Failed to release expired budget holds")
+				continue
+			}
+			if released > 0 {
+				logger.WithField("released", released).Info("Released budget holds without billing notices")
+			}
+		}
+	}
+}
+
 func startKafkaConsumers(ctx context.Context, consumer *kafkapkg.Consumer, cfg config.KafkaConfig, logger *logrus.Logger) {
 	logger.Info("Starting Kafka consumers")
 
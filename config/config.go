@@ -8,12 +8,14 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	Kafka    KafkaConfig    `mapstructure:"kafka"`
-	Logging  LoggingConfig  `mapstructure:"logging"`
-	Metrics  MetricsConfig  `mapstructure:"metrics"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Database   DatabaseConfig   `mapstructure:"database"`
+	Redis      RedisConfig      `mapstructure:"redis"`
+	Kafka      KafkaConfig      `mapstructure:"kafka"`
+	Auction    AuctionConfig    `mapstructure:"auction"`
+	Prediction PredictionConfig `mapstructure:"prediction"`
+	Logging    LoggingConfig    `mapstructure:"logging"`
+	Metrics    MetricsConfig    `mapstructure:"metrics"`
 }
 
 type ServerConfig struct {
@@ -58,6 +60,21 @@ type KafkaConfig struct {
 	Compression    string        `mapstructure:"compression"`
 }
 
+type AuctionConfig struct {
+	DefaultType     string        `mapstructure:"default_type"`
+	TrackingBaseURL string        `mapstructure:"tracking_base_url"`
+	BillingTimeout  time.Duration `mapstructure:"billing_timeout"`
+}
+
+type PredictionConfig struct {
+	PriorCTR         float64       `mapstructure:"prior_ctr"`
+	PriorCVR         float64       `mapstructure:"prior_cvr"`
+	ImpressionWeight float64       `mapstructure:"impression_weight"`
+	ClickWeight      float64       `mapstructure:"click_weight"`
+	MaxImpressions   float64       `mapstructure:"max_impressions"`
+	SnapshotInterval time.Duration `mapstructure:"snapshot_interval"`
+}
+
 type LoggingConfig struct {
 	Level  string `mapstructure:"level"`
 	Format string `mapstructure:"format"`
@@ -129,6 +146,17 @@ func setDefaults() {
 	viper.SetDefault("kafka.max_message_size", 1000000)
 	viper.SetDefault("kafka.compression", "snappy")
 
+	viper.SetDefault("auction.default_type", "second-price")
+	viper.SetDefault("auction.tracking_base_url", "http://localhost:8080/api/v1")
+	viper.SetDefault("auction.billing_timeout", "5m")
+
+	viper.SetDefault("prediction.prior_ctr", 0.001)
+	viper.SetDefault("prediction.prior_cvr", 0.01)
+	viper.SetDefault("prediction.impression_weight", 1000)
+	viper.SetDefault("prediction.click_weight", 100)
+	viper.SetDefault("prediction.max_impressions", 1000000)
+	viper.SetDefault("prediction.snapshot_interval", "30s")
+
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
 	viper.SetDefault("logging.output", "stdout")
@@ -0,0 +1,121 @@
+package auction
+
+import (
+	"strings"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+// requestCategories returns the IAB categories of the site or app, its
+// section and page, and its content.
+func requestCategories(request *models.BidRequest) []string {
+	var categories []string
+	if request.Site != nil {
+		categories = append(categories, request.Site.Cat...)
+		categories = append(categories, request.Site.SectionCat...)
+		categories = append(categories, request.Site.PageCat...)
+	} else if request.App != nil {
+		categories = append(categories, request.App.Cat...)
+		categories = append(categories, request.App.SectionCat...)
+		categories = append(categories, request.App.PageCat...)
+	}
+	if content := request.RequestContent(); content != nil {
+		categories = append(categories, content.Cat...)
+	}
+	return categories
+}
+
+// requestKeywords returns the lower-cased keywords of the site or app and its
+// content, which OpenRTB sends as comma-separated lists.
+func requestKeywords(request *models.BidRequest) []string {
+	var lists []string
+	if request.Site != nil {
+		lists = append(lists, request.Site.Keywords)
+	} else if request.App != nil {
+		lists = append(lists, request.App.Keywords)
+	}
+	if content := request.RequestContent(); content != nil {
+		lists = append(lists, content.Keywords)
+	}
+
+	var keywords []string
+	for _, list := range lists {
+		for _, keyword := range strings.Split(list, ",") {
+			if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+				keywords = append(keywords, keyword)
+			}
+		}
+	}
+	return keywords
+}
+
+func matchesContent(rules *models.ContentTargeting, request *models.BidRequest) bool {
+	if rules == nil {
+		return true
+	}
+
+	if len(rules.IncludeCategories) > 0 || len(rules.ExcludeCategories) > 0 {
+		categories := requestCategories(request)
+		if len(rules.IncludeCategories) > 0 && !anyCategory(rules.IncludeCategories, categories) {
+			return false
+		}
+		if anyCategory(rules.ExcludeCategories, categories) {
+			return false
+		}
+	}
+
+	if len(rules.IncludeKeywords) > 0 || len(rules.ExcludeKeywords) > 0 {
+		keywords := requestKeywords(request)
+		if len(rules.IncludeKeywords) > 0 && !containsFold(rules.IncludeKeywords, keywords) {
+			return false
+		}
+		if containsFold(rules.ExcludeKeywords, keywords) {
+			return false
+		}
+	}
+
+	content := request.RequestContent()
+	if content == nil {
+		content = &models.Content{}
+	}
+
+	if len(rules.Languages) > 0 && !containsFold(rules.Languages, []string{content.Language}) {
+		return false
+	}
+	if len(rules.Genres) > 0 && !containsFold(rules.Genres, []string{content.Genre}) {
+		return false
+	}
+	if len(rules.Ratings) > 0 && !containsFold(rules.Ratings, []string{content.ContentRating}) {
+		return false
+	}
+	if rules.MaxMediaRating > 0 && (content.QAGMediaRating == 0 || content.QAGMediaRating > rules.MaxMediaRating) {
+		return false
+	}
+	if rules.LiveStream != nil && *rules.LiveStream != (content.LiveStream == 1) {
+		return false
+	}
+
+	return true
+}
+
+// anyCategory reports whether any of the request's categories is in rules or
+// is a subcategory of one of them.
+func anyCategory(rules, categories []string) bool {
+	for _, category := range categories {
+		if matchesCategory(rules, category) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(wanted, have []string) bool {
+	for _, w := range wanted {
+		for _, h := range have {
+			if h != "" && strings.EqualFold(w, h) {
+				return true
+			}
+		}
+	}
+	return false
+}
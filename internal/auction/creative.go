@@ -0,0 +1,162 @@
+package auction
+
+import (
+	"fmt"
+	"html"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+type creativeMatch struct {
+	Creative      *models.AdCreative
+	W             int
+	H             int
+	AdM           string
+	Protocol      int
+	VASTVersion   string
+	SkipOffset    string
+	Sequence      int
+	NativeRequest *models.NativeRequest
+	NativeAssets  []models.NativeResponseAsset
+}
+
+func selectCreative(imp *models.Impression, creatives []*models.AdCreative) *creativeMatch {
+	for _, creative := range creatives {
+		if creative.Status != "" && creative.Status != models.CreativeStatusActive {
+			continue
+		}
+
+		if match := matchCreative(imp, creative); match != nil {
+			return match
+		}
+	}
+
+	return nil
+}
+
+func matchCreative(imp *models.Impression, creative *models.AdCreative) *creativeMatch {
+	switch creative.Type {
+	case models.CreativeTypeBanner:
+		if imp.Banner == nil {
+			return nil
+		}
+		w, h, ok := fitBanner(imp.Banner, creative)
+		if !ok {
+			return nil
+		}
+		return &creativeMatch{Creative: creative, W: w, H: h, AdM: bannerMarkup(creative, w, h)}
+	case models.CreativeTypeVideo:
+		if imp.Video == nil {
+			return nil
+		}
+		return matchVideo(imp.Video, creative)
+	case models.CreativeTypeNative:
+		if imp.Native == nil {
+			return nil
+		}
+		return matchNative(imp.Native, creative)
+	case models.CreativeTypeAudio:
+		if imp.Audio == nil {
+			return nil
+		}
+		return &creativeMatch{Creative: creative}
+	}
+
+	return nil
+}
+
+// matchVideo checks a video creative against the player's MIME types,
+// duration bounds or required durations, VAST protocols and skip settings.
+func matchVideo(video *models.Video, creative *models.AdCreative) *creativeMatch {
+	if len(video.MIMEs) > 0 && !contains(video.MIMEs, creative.MIMEType) {
+		return nil
+	}
+
+	if video.MinDuration > 0 && creative.Duration < video.MinDuration {
+		return nil
+	}
+	if video.MaxDuration > 0 && creative.Duration > video.MaxDuration {
+		return nil
+	}
+	if len(video.RqdDurs) > 0 && !containsInt(video.RqdDurs, creative.Duration) {
+		return nil
+	}
+
+	protocol, version, ok := vastVersion(video.Protocols)
+	if !ok {
+		return nil
+	}
+
+	match := &creativeMatch{
+		Creative:    creative,
+		W:           video.W,
+		H:           video.H,
+		Protocol:    protocol,
+		VASTVersion: version,
+	}
+
+	if creative.Skippable {
+		if video.Skip != 1 {
+			return nil
+		}
+		if creative.Duration > video.SkipMin {
+			offset := creative.SkipOffset
+			if video.SkipAfter > offset {
+				offset = video.SkipAfter
+			}
+			match.SkipOffset = formatVASTDuration(offset)
+		}
+	}
+
+	return match
+}
+
+func containsInt(slice []int, item int) bool {
+	for _, n := range slice {
+		if n == item {
+			return true
+		}
+	}
+	return false
+}
+
+func fitBanner(banner *models.Banner, creative *models.AdCreative) (int, int, bool) {
+	if creative.Format == models.CreativeFormatResponsive {
+		if banner.W > 0 && banner.H > 0 {
+			return banner.W, banner.H, true
+		}
+		for _, format := range banner.Format {
+			if format.W > 0 && format.H > 0 {
+				return format.W, format.H, true
+			}
+		}
+		return 0, 0, false
+	}
+
+	if banner.W == creative.Width && banner.H == creative.Height {
+		return creative.Width, creative.Height, true
+	}
+
+	for _, format := range banner.Format {
+		if format.W == creative.Width && format.H == creative.Height {
+			return creative.Width, creative.Height, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+func bannerMarkup(creative *models.AdCreative, w, h int) string {
+	markup := creative.HTML
+	if markup == "" {
+		markup = fmt.Sprintf(`<a href="%s" target="_blank"><img src="%s" width="%d" height="%d" border="0"/></a>`,
+			html.EscapeString(creative.ClickURL), html.EscapeString(creative.AssetURL), w, h)
+	}
+
+	if creative.ImpressionURL != "" {
+		markup += fmt.Sprintf(`<img src="%s" width="1" height="1" style="display:none"/>`,
+			html.EscapeString(creative.ImpressionURL))
+	}
+
+	return markup
+}
@@ -0,0 +1,39 @@
+package auction
+
+import (
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+// dayPartTime returns now on the clock a campaign's day parts are evaluated
+// on: the user's local time when userTime is set and the request carries a
+// UTC offset, otherwise location. An offset of 0 is indistinguishable from
+// a missing one and falls back to location.
+func dayPartTime(location *time.Location, userTime bool, request *models.BidRequest, now time.Time) time.Time {
+	if userTime {
+		if geo := requestGeo(request); geo != nil && geo.UTCOffset != 0 {
+			return now.In(time.FixedZone("", geo.UTCOffset*60))
+		}
+	}
+	return now.In(location)
+}
+
+// campaignTime returns now on the campaign's day-parting clock. It reports
+// false when the campaign's timezone can't be loaded.
+func campaignTime(rules *models.TargetingRules, request *models.BidRequest, now time.Time) (time.Time, bool) {
+	location, err := rules.DayPartLocation()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return dayPartTime(location, rules.DayPartUserTime, request, now), true
+}
+
+func matchesDayParts(rules []models.DayPartRule, local time.Time) bool {
+	for _, rule := range rules {
+		if rule.Covers(local.Weekday(), local.Hour()) {
+			return true
+		}
+	}
+	return false
+}
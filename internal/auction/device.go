@@ -0,0 +1,108 @@
+package auction
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+func matchesDevice(rules *models.DeviceTargeting, request *models.BidRequest) bool {
+	if rules == nil {
+		return true
+	}
+
+	device := &request.Device
+	os, osv := device.Platform()
+	if !matchesOS(rules.OS, os, osv) {
+		return false
+	}
+
+	connection := ""
+	if device.ConnectionType != 0 {
+		connection = strconv.Itoa(device.ConnectionType)
+	}
+
+	if !passesFilter(rules.Make, device.Make, strings.EqualFold) ||
+		!passesFilter(rules.Model, device.Model, strings.EqualFold) ||
+		!passesFilter(rules.ConnectionTypes, connection, strings.EqualFold) ||
+		!passesFilter(rules.Carrier, device.Carrier, strings.EqualFold) ||
+		!passesFilter(rules.MCCMNC, device.MCCMNC, strings.EqualFold) ||
+		!passesFilter(rules.Language, device.Language, strings.EqualFold) {
+		return false
+	}
+
+	switch rules.InventoryType {
+	case models.InventoryApp:
+		if request.App == nil {
+			return false
+		}
+	case models.InventorySite:
+		if request.Site == nil {
+			return false
+		}
+	}
+
+	var bundle, domain string
+	if request.App != nil {
+		bundle = request.App.Bundle
+	}
+	if request.Site != nil {
+		domain = request.Site.Domain
+	}
+
+	return passesFilter(rules.AppBundles, bundle, strings.EqualFold) &&
+		passesFilter(rules.SiteDomains, domain, matchesDomain)
+}
+
+// passesFilter applies an include/exclude list to value using match.
+func passesFilter(filter *models.Filter, value string, match func(value, entry string) bool) bool {
+	if filter == nil {
+		return true
+	}
+
+	matchesAny := func(entries []string) bool {
+		if value == "" {
+			return false
+		}
+		for _, entry := range entries {
+			if match(value, entry) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(filter.Include) > 0 && !matchesAny(filter.Include) {
+		return false
+	}
+	return !matchesAny(filter.Exclude)
+}
+
+// matchesDomain reports whether domain is entry or one of its subdomains.
+func matchesDomain(domain, entry string) bool {
+	domain, entry = strings.ToLower(domain), strings.ToLower(entry)
+	return domain == entry || strings.HasSuffix(domain, "."+entry)
+}
+
+func matchesOS(filter *models.OSFilter, os, version string) bool {
+	if filter == nil {
+		return true
+	}
+
+	for _, r := range filter.Exclude {
+		if matched, known := r.Contains(os, version); matched || !known {
+			return false
+		}
+	}
+
+	if len(filter.Include) == 0 {
+		return true
+	}
+	for _, r := range filter.Include {
+		if matched, _ := r.Contains(os, version); matched {
+			return true
+		}
+	}
+	return false
+}
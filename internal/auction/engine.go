@@ -2,55 +2,144 @@ package auction
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"math"
 	"math/rand"
+	"net/url"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ad-delivery-simulator/internal/bidding"
 	"github.com/ad-delivery-simulator/internal/campaign"
+	"github.com/ad-delivery-simulator/internal/creative"
+	"github.com/ad-delivery-simulator/internal/deal"
+	"github.com/ad-delivery-simulator/internal/inventory"
 	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/prediction"
 	"github.com/ad-delivery-simulator/pkg/kafka"
 	"github.com/ad-delivery-simulator/pkg/redis"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
+const resultCacheTTL = 5 * time.Minute
+
+// profileDataID marks the user data entry holding profile segments from Redis.
+const profileDataID = "profile"
+
 type Engine struct {
 	campaignService *campaign.Service
+	dealService     *deal.Service
+	creativeService *creative.Service
+	inventory       *inventory.Service
+	predictor       *prediction.Model
 	redis           *redis.Client
 	kafka           *kafka.Producer
 	brokers         []string
 	logger          *logrus.Logger
 	auctionTimeout  time.Duration
+	auctionType     models.AuctionType
+	trackingBaseURL string
+	billingTimeout  time.Duration
+
+	// targeting is swapped in whole when rebuilt; targetingBuild lets one
+	// auction rebuild it at a time.
+	targeting      atomic.Pointer[targetingIndex]
+	targetingBuild sync.Mutex
+
+	// expressions caches compiled targeting expressions by source.
+	expressions sync.Map
+}
+
+type Config struct {
+	DefaultAuctionType models.AuctionType
+	TrackingBaseURL    string
+	BillingTimeout     time.Duration
 }
 
 type BidEntry struct {
-	Bid        *models.Bid
-	Campaign   *models.Campaign
+	Bid      *models.Bid
+	Campaign *models.Campaign
+	Deal     *models.Deal
+	// Tier is the campaign's priority tier; Priority orders deals within it.
+	Tier       int
+	Priority   int
+	Floor      float64
 	Score      float64
 	IsEligible bool
+	// Duration is the video creative's length in seconds.
+	Duration int
+
+	trace *ImpressionTrace
+	match *creativeMatch
 }
 
 func NewEngine(
 	campaignService *campaign.Service,
+	dealService *deal.Service,
+	creativeService *creative.Service,
+	inventoryService *inventory.Service,
+	predictor *prediction.Model,
 	redisClient *redis.Client,
 	kafkaProducer *kafka.Producer,
 	brokers []string,
+	cfg Config,
 	logger *logrus.Logger,
 ) *Engine {
+	auctionType := cfg.DefaultAuctionType
+	if auctionType != models.AuctionTypeFirstPrice {
+		auctionType = models.AuctionTypeSecondPrice
+	}
+
+	billingTimeout := cfg.BillingTimeout
+	if billingTimeout <= 0 {
+		billingTimeout = 5 * time.Minute
+	}
+
 	return &Engine{
 		campaignService: campaignService,
+		dealService:     dealService,
+		creativeService: creativeService,
+		inventory:       inventoryService,
+		predictor:       predictor,
 		redis:           redisClient,
 		kafka:           kafkaProducer,
 		brokers:         brokers,
 		logger:          logger,
 		auctionTimeout:  100 * time.Millisecond,
+		auctionType:     auctionType,
+		trackingBaseURL: strings.TrimRight(cfg.TrackingBaseURL, "/"),
+		billingTimeout:  billingTimeout,
 	}
 }
 
+type impressionAuction struct {
+	Imp         *models.Impression
+	Winner      *BidEntry
+	AuctionType models.AuctionType
+	SecondPrice float64
+	FinalPrice  float64
+	TotalBids   int
+	// PodID is set on the ads of an ad pod, which are returned together.
+	PodID string
+}
+
+// RunAuction runs the auction for every impression in request. Test requests
+// (test=1) run the full auction but hold no budget, publish to the test-
+// Kafka topics and are marked as tests in the response ext.
 func (e *Engine) RunAuction(ctx context.Context, request *models.BidRequest) (*models.BidResponse, error) {
+	response, err := e.runAuction(ctx, request)
+	if response != nil && request.Test == 1 {
+		response.Ext = &models.BidResponseExt{Test: 1}
+	}
+	return response, err
+}
+
+func (e *Engine) runAuction(ctx context.Context, request *models.BidRequest) (*models.BidResponse, error) {
 	startTime := time.Now()
 	
 	auctionCtx, cancel := context.WithTimeout(ctx, e.auctionTimeout)
@@ -58,114 +147,653 @@ func (e *Engine) RunAuction(ctx context.Context, request *models.BidRequest) (*m
 
 	e.publishBidRequest(ctx, request)
 
-	activeCampaigns, err := e.campaignService.ListActiveCampaigns(auctionCtx)
-	if err != nil {
-		e.logger.WithError(err).Error("Failed to get active campaigns")
-		return nil, fmt.Errorf("failed to get active campaigns: %w", err)
+	if len(request.Imp) == 0 {
+		return e.createNoBidResponse(request.ID), nil
+	}
+
+	// The profile only matters to segment-targeted campaigns, so it isn't
+	// read unless the index has some, or isn't loaded to tell.
+	idx := e.currentTargeting()
+	if idx == nil || idx.segmentTargeted {
+		e.addProfileSegments(auctionCtx, request)
+	}
+
+	// Traced auctions skip the targeting index so every campaign gets a reason.
+	traced := request.Test == 1 || traceRequested(ctx)
+
+	var activeCampaigns []*models.Campaign
+	if idx != nil && !traced {
+		activeCampaigns = e.candidateCampaigns(idx, request)
+	} else {
+		var err error
+		activeCampaigns, err = e.campaignService.ListActiveCampaigns(auctionCtx)
+		if err != nil {
+			e.logger.WithError(err).Error("Failed to get active campaigns")
+			return nil, fmt.Errorf("failed to get active campaigns: %w", err)
+		}
+	}
+
+	// An auction without candidates still saves its (empty) trace, so the
+	// trace endpoint shows it ran.
+	var trace *Trace
+	if traced {
+		trace = newTrace(request, len(activeCampaigns))
+		defer e.saveTrace(trace)
 	}
 
 	if len(activeCampaigns) == 0 {
 		return e.createNoBidResponse(request.ID), nil
 	}
 
-	bidEntries := e.collectBids(auctionCtx, request, activeCampaigns)
+	bidEntries := e.collectBids(auctionCtx, request, activeCampaigns, trace)
 	
 	if len(bidEntries) == 0 {
 		return e.createNoBidResponse(request.ID), nil
 	}
 
-	winner, secondPrice := e.selectWinner(bidEntries)
-	
-	if winner == nil {
-		return e.createNoBidResponse(request.ID), nil
-	}
+	auctions := e.runImpressionAuctions(request, bidEntries)
 
-	finalPrice := e.determineFinalPrice(winner.Bid.Price, secondPrice, request.Imp[0].BidFloor)
+	auctions = e.settleBudgets(ctx, request, auctions)
 	
-	allowed, err := e.campaignService.CheckAndDecrementBudget(ctx, winner.Campaign.ID, finalPrice)
-	if err != nil || !allowed {
-		e.logger.WithError(err).WithField("campaign_id", winner.Campaign.ID).Warn("Budget check failed for winner")
+	if len(auctions) == 0 {
 		return e.createNoBidResponse(request.ID), nil
 	}
 
-	response := e.createBidResponse(request, winner, finalPrice)
+	response := e.createBidResponse(request, auctions)
 	
-	e.recordAuctionResult(ctx, request, winner, finalPrice, secondPrice, len(bidEntries), time.Since(startTime))
+	e.recordAuctionResults(ctx, request, auctions, time.Since(startTime))
 	
-	e.publishBidResponse(ctx, response)
+	e.publishBidResponse(ctx, request, response)
 
 	return response, nil
 }
 
-func (e *Engine) collectBids(ctx context.Context, request *models.BidRequest, campaigns []*models.Campaign) []*BidEntry {
+// addProfileSegments adds the user's stored profile segments to the
+// request's user data, so segment targeting sees them alongside the segments
+// the exchange sent. A lookup that fails or outlasts ctx adds nothing.
+func (e *Engine) addProfileSegments(ctx context.Context, request *models.BidRequest) {
+	if request.User.ID == "" {
+		return
+	}
+
+	segments, err := e.campaignService.UserSegments(ctx, request.User.ID)
+	if err != nil {
+		e.logger.WithError(err).WithField("user_id", request.User.ID).Warn("Failed to load user profile")
+		return
+	}
+	if len(segments) == 0 {
+		return
+	}
+
+	request.User.Data = withProfileSegments(request.User.Data, segments)
+}
+
+// withProfileSegments returns a copy of userData with segments as its
+// profile entry, replacing any profile entry from an earlier run so a
+// reused request doesn't collect duplicates.
+func withProfileSegments(userData []models.Data, segments []string) []models.Data {
+	data := make([]models.Data, 0, len(userData)+1)
+	for _, d := range userData {
+		if d.ID != profileDataID {
+			data = append(data, d)
+		}
+	}
+
+	profile := models.Data{ID: profileDataID, Name: "user profile", Segment: make([]models.Segment, len(segments))}
+	for i, segment := range segments {
+		profile.Segment[i] = models.Segment{ID: segment}
+	}
+	return append(data, profile)
+}
+
+func (e *Engine) runImpressionAuctions(request *models.BidRequest, bidEntries []*BidEntry) []*impressionAuction {
+	entriesByImp := make(map[string][]*BidEntry)
+	for _, entry := range bidEntries {
+		entriesByImp[entry.Bid.ImpID] = append(entriesByImp[entry.Bid.ImpID], entry)
+	}
+
+	auctionType := e.resolveAuctionType(request)
+
+	pods := requestPods(request)
+	podImps := make(map[string]bool)
+	for _, pod := range pods {
+		for _, imp := range pod.Slots {
+			podImps[imp.ID] = true
+		}
+	}
+
+	var slots [][]*slotCandidate
+	for i := range request.Imp {
+		imp := &request.Imp[i]
+		entries := entriesByImp[imp.ID]
+		if len(entries) == 0 || podImps[imp.ID] {
+			continue
+		}
+
+		rankEntries(entries)
+		candidates := make([]*slotCandidate, len(entries))
+		for rank := range entries {
+			candidates[rank] = &slotCandidate{
+				auction: e.priceEntry(imp, entries, rank, auctionType),
+				keys:    separationKeys(entries[rank].Campaign),
+			}
+		}
+		slots = append(slots, candidates)
+	}
+
+	// Pods are filled first and each ad joins the separation search as a
+	// slot of its own, so pod ads keep apart from the other winners too. A
+	// pod ad that loses to separation leaves its position empty.
+	podStart := len(slots)
+	for _, pod := range pods {
+		for _, a := range e.runPodAuction(request, pod, entriesByImp, auctionType) {
+			slots = append(slots, []*slotCandidate{{auction: a, keys: separationKeys(a.Winner.Campaign)}})
+		}
+	}
+
+	chosen := separateWinners(slots)
+
+	var auctions []*impressionAuction
+	for s, candidates := range slots {
+		if s >= podStart {
+			if chosen[s] < 0 {
+				settleSeparated(candidates[0], s, slots, chosen)
+				if trace := candidates[0].auction.Winner.trace; trace != nil {
+					trace.ClearingPrice = 0
+				}
+				continue
+			}
+			auctions = append(auctions, candidates[0].auction)
+			continue
+		}
+
+		if chosen[s] < 0 {
+			for _, c := range candidates {
+				settleSeparated(c, s, slots, chosen)
+			}
+			continue
+		}
+
+		won := candidates[chosen[s]].auction
+		winner := won.Winner
+		for rank, c := range candidates {
+			switch {
+			case rank < chosen[s]:
+				settleSeparated(c, s, slots, chosen)
+			case rank > chosen[s]:
+				c.auction.Winner.trace.settle(TraceOutcomeLost, "outbid by campaign %s at %.4f", winner.Bid.CID, winner.Bid.Price)
+			}
+		}
+
+		winner.trace.settle(TraceOutcomeWon, "%s auction", won.AuctionType)
+		if winner.trace != nil {
+			winner.trace.ClearingPrice = won.FinalPrice
+		}
+
+		auctions = append(auctions, won)
+	}
+
+	return auctions
+}
+
+// priceEntry prices the auction for imp as if the entry at rank in the ranked
+// entries won it, with the entries below it setting the second price.
+func (e *Engine) priceEntry(imp *models.Impression, entries []*BidEntry, rank int, auctionType models.AuctionType) *impressionAuction {
+	return e.clearAuction(imp, entries[rank], secondPriceAt(entries, rank), len(entries), auctionType)
+}
+
+// clearAuction prices winner's win of imp against secondPrice, applying the
+// winner's deal floor and auction type.
+func (e *Engine) clearAuction(imp *models.Impression, winner *BidEntry, secondPrice float64, totalBids int, auctionType models.AuctionType) *impressionAuction {
+	floor := imp.BidFloor
+	winnerAuctionType := auctionType
+	if winner.Deal != nil {
+		floor = winner.Floor
+		winnerAuctionType = dealAuctionType(winner.Deal, auctionType)
+	}
+	if isHouse(winner) {
+		floor = 0
+	}
+
+	return &impressionAuction{
+		Imp:         imp,
+		Winner:      winner,
+		AuctionType: winnerAuctionType,
+		SecondPrice: secondPrice,
+		FinalPrice:  e.determineClearingPrice(winnerAuctionType, winner.Bid.Price, secondPrice, floor),
+		TotalBids:   totalBids,
+	}
+}
+
+// settleBudgets holds each winner's clearing price against its campaign's
+// budget. The hold is billed by the burl notice or released when no billing
+// notice arrives within the billing timeout. Test winners hold no budget,
+// but their hold records that the bid is a test for its notices. A pod's ads
+// are held together: if one can't be held, the whole pod is dropped.
+func (e *Engine) settleBudgets(ctx context.Context, request *models.BidRequest, auctions []*impressionAuction) []*impressionAuction {
+	settled := auctions[:0]
+	for start := 0; start < len(auctions); {
+		end := start + 1
+		if podID := auctions[start].PodID; podID != "" {
+			for end < len(auctions) && auctions[end].PodID == podID {
+				end++
+			}
+		}
+
+		if e.holdBudgets(ctx, request, auctions[start:end]) {
+			settled = append(settled, auctions[start:end]...)
+		}
+		start = end
+	}
+
+	return settled
+}
+
+// holdBudgets places a hold for each winner in group, all or none. When a
+// hold fails, the ones already placed are released and every winner in the
+// group is rejected.
+func (e *Engine) holdBudgets(ctx context.Context, request *models.BidRequest, group []*impressionAuction) bool {
+	for i, a := range group {
+		if isHouse(a.Winner) {
+			continue
+		}
+
+		campaignID := a.Winner.Campaign.ID
+		allowed, err := e.campaignService.HoldBudget(ctx, &models.BudgetHold{
+			BidID:      a.Winner.Bid.ID,
+			CampaignID: campaignID,
+			AuctionID:  request.ID,
+			Amount:     a.FinalPrice,
+			Test:       request.Test == 1,
+		}, e.billingTimeout)
+		if err == nil && allowed {
+			continue
+		}
+
+		e.logger.WithError(err).WithField("campaign_id", campaignID).Warn("Budget check failed for winner")
+		for _, held := range group[:i] {
+			if isHouse(held.Winner) {
+				continue
+			}
+			if _, err := e.campaignService.ReleaseBudgetHold(ctx, held.Winner.Bid.ID); err != nil {
+				e.logger.WithError(err).WithField("bid_id", held.Winner.Bid.ID).Error("Failed to release budget hold")
+			}
+		}
+		for _, other := range group {
+			if other != a {
+				other.Winner.trace.settle(TraceOutcomeRejected, "budget hold failed for campaign %s in pod %s", a.Winner.Bid.CID, a.PodID)
+			}
+		}
+		a.Winner.trace.settle(TraceOutcomeRejected, "budget hold of %.4f failed", a.FinalPrice)
+		return false
+	}
+	return true
+}
+
+func isHouse(entry *BidEntry) bool {
+	return entry.Campaign != nil && entry.Campaign.Priority == models.PriorityHouse
+}
+
+func (e *Engine) collectBids(ctx context.Context, request *models.BidRequest, campaigns []*models.Campaign, trace *Trace) []*BidEntry {
 	var wg sync.WaitGroup
-	bidChan := make(chan *BidEntry, len(campaigns))
+	bidChan := make(chan []*BidEntry, len(campaigns))
+
+	podImps := make(map[string]bool)
+	for _, pod := range requestPods(request) {
+		for _, imp := range pod.Slots {
+			podImps[imp.ID] = true
+		}
+	}
 
 	for _, campaign := range campaigns {
 		wg.Add(1)
-		go func(c *models.Campaign) {
+		go func(c *models.Campaign, ct *CampaignTrace) {
 			defer wg.Done()
 			
-			if entry := e.createBidEntry(ctx, request, c); entry != nil && entry.IsEligible {
-				bidChan <- entry
+			if entries := e.createBidEntries(ctx, request, c, podImps, ct); len(entries) > 0 {
+				bidChan <- entries
 			}
-		}(campaign)
+		}(campaign, trace.campaign(campaign))
 	}
 
 	wg.Wait()
 	close(bidChan)
 
 	var bidEntries []*BidEntry
-	for entry := range bidChan {
-		bidEntries = append(bidEntries, entry)
+	for entries := range bidChan {
+		bidEntries = append(bidEntries, entries...)
 	}
 
 	return bidEntries
 }
 
-func (e *Engine) createBidEntry(ctx context.Context, request *models.BidRequest, campaign *models.Campaign) *BidEntry {
+// createBidEntries bids the campaign on each impression it can serve. On ad
+// pod impressions it bids once per creative length, so the pod can be filled
+// with the mix of lengths that fits best.
+func (e *Engine) createBidEntries(ctx context.Context, request *models.BidRequest, campaign *models.Campaign, podImps map[string]bool, trace *CampaignTrace) []*BidEntry {
 	if !e.checkTargeting(request, campaign) {
+		trace.filter("targeting")
+		return nil
+	}
+
+	if !e.checkBlockLists(request, campaign) {
+		e.logger.WithField("campaign_id", campaign.ID).Debug("Blocked by request block lists")
+		trace.filter("block lists")
 		return nil
 	}
 
+	if rules := campaign.TargetingRules; rules != nil && rules.InventoryLists != nil && e.inventory != nil {
+		if allowed, reason := e.inventory.Allowed(rules.InventoryLists, inventory.ValuesFor(request)); !allowed {
+			trace.filter("inventory lists: %s", reason)
+			return nil
+		}
+	}
+
 	if request.User.ID != "" {
 		allowed, err := e.campaignService.CheckFrequencyCap(ctx, request.User.ID, campaign.ID, "impression")
 		if err != nil || !allowed {
 			e.logger.WithField("campaign_id", campaign.ID).Debug("Frequency cap exceeded")
+			trace.filter("frequency cap")
 			return nil
 		}
 	}
 
 	pacingRate, _ := e.campaignService.CalculatePacingRate(ctx, campaign.ID)
-	if rand.Float64() > pacingRate {
+	if roll := rand.Float64(); roll > pacingRate {
 		e.logger.WithField("campaign_id", campaign.ID).Debug("Pacing check failed")
+		trace.filter("pacing: rolled %.3f against rate %.3f", roll, pacingRate)
 		return nil
 	}
 
-	bidAmount := e.calculateBidAmount(campaign, request)
+	strategy, err := bidding.ForCampaign(campaign)
+	if err != nil {
+		e.logger.WithError(err).WithField("campaign_id", campaign.ID).Warn("Invalid bidding strategy")
+		trace.filter("bidding strategy: %v", err)
+		return nil
+	}
+
+	creatives := e.creativeService.ActiveCreatives(campaign.ID)
+	if len(creatives) == 0 {
+		e.logger.WithField("campaign_id", campaign.ID).Debug("No active creatives")
+		trace.filter("no active creatives")
+		return nil
+	}
+
+	var entries []*BidEntry
+	for i := range request.Imp {
+		imp := &request.Imp[i]
+		impTrace := trace.impression(imp.ID)
+
+		candidates := [][]*models.AdCreative{creatives}
+		if podImps[imp.ID] {
+			candidates = creativesByDuration(creatives)
+		}
+		for _, group := range candidates {
+			if entry := e.createBidEntry(request, imp, campaign, strategy, group, impTrace); entry != nil && entry.IsEligible {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return entries
+}
+
+func (e *Engine) createBidEntry(
+	request *models.BidRequest,
+	imp *models.Impression,
+	campaign *models.Campaign,
+	strategy bidding.Strategy,
+	creatives []*models.AdCreative,
+	trace *ImpressionTrace,
+) *BidEntry {
+	if !matchesFormat(imp, campaign) {
+		trace.noBid("ad size not targeted")
+		return nil
+	}
+
+	if campaign.TargetingRules != nil && !matchesKeyValues(campaign.TargetingRules, requestKeyValues(request, imp)) {
+		trace.noBid("key-value targeting")
+		return nil
+	}
+
+	match := selectCreative(imp, creatives)
+	if match == nil {
+		trace.noBid("no eligible creative")
+		return nil
+	}
+
+	bidCtx := &bidding.BidContext{
+		Campaign: campaign,
+		Request:  request,
+		Imp:      imp,
+	}
+	if e.predictor != nil {
+		bidCtx.PredictedCTR, bidCtx.PredictedCVR = e.predictor.Predict(prediction.RequestKey(campaign.ID, request))
+	}
+
+	bidAmount := strategy.Bid(bidCtx)
+
+	deal, priority, floor := e.selectDeal(imp, campaign, bidAmount)
+	if deal == nil {
+		if imp.PMP != nil && imp.PMP.PrivateAuction == 1 {
+			trace.noBid("private auction without an eligible deal")
+			return nil
+		}
+		floor = imp.BidFloor
+	}
 	
-	if len(request.Imp) > 0 && bidAmount < request.Imp[0].BidFloor {
+	price := bidAmount
+	house := campaign.Priority == models.PriorityHouse
+	if house {
+		// House ads only fill slots no paid bid wants, so they ignore floors
+		// and are never charged.
+		floor, price = 0, 0
+	}
+
+	if bidAmount < floor {
+		trace.noBid("bid %.4f below floor %.4f", bidAmount, floor)
 		return nil
 	}
 
+	bidID := uuid.New().String()
 	bid := &models.Bid{
-		ID:    uuid.New().String(),
-		ImpID: request.Imp[0].ID,
-		Price: bidAmount,
-		AdID:  campaign.ID.String(),
-		CID:   campaign.ID.String(),
-		CrID:  fmt.Sprintf("creative_%s", campaign.ID.String()),
-		NURL:  fmt.Sprintf("/track/win?bid=${AUCTION_PRICE}&campaign=%s", campaign.ID),
-		IURL:  fmt.Sprintf("/track/impression?campaign=%s", campaign.ID),
-		ADomain: []string{"example.com"},
-	}
-
-	return &BidEntry{
+		ID:      bidID,
+		ImpID:   imp.ID,
+		Price:   price,
+		AdID:    campaign.ID.String(),
+		CID:     campaign.ID.String(),
+		CrID:    match.Creative.ID.String(),
+		W:       match.W,
+		H:       match.H,
+		AdM:     match.AdM,
+		NURL:    e.noticeURL(request, "win", bidID, campaign, "price", models.MacroAuctionPrice),
+		BURL:    e.noticeURL(request, "billing", bidID, campaign, "price", models.MacroAuctionPrice),
+		LURL:    e.noticeURL(request, "loss", bidID, campaign, "reason", models.MacroAuctionLoss),
+		IURL:    match.Creative.AssetURL,
+		ADomain: campaign.AdvertiserDomains,
+		Cat:     campaign.Categories,
+		Bundle:  campaign.AppBundle,
+		MType:   models.MarkupType(match.Creative.Type),
+	}
+
+	if deal != nil {
+		bid.DealID = deal.ID
+	}
+	if house {
+		bid.BURL = ""
+	}
+	if match.Creative.Type == models.CreativeTypeVideo || match.Creative.Type == models.CreativeTypeAudio {
+		bid.Dur = match.Creative.Duration
+	}
+
+	if match.VASTVersion != "" {
+		adm, err := e.buildVAST(request, bid, campaign, match)
+		if err != nil {
+			e.logger.WithError(err).WithField("campaign_id", campaign.ID).Error("Failed to build VAST")
+			trace.noBid("VAST generation failed")
+			return nil
+		}
+		bid.AdM = adm
+		bid.Protocol = match.Protocol
+	}
+
+	if match.NativeRequest != nil {
+		adm, err := e.buildNativeResponse(request, bid, campaign, match)
+		if err != nil {
+			e.logger.WithError(err).WithField("campaign_id", campaign.ID).Error("Failed to build native response")
+			trace.noBid("native response generation failed")
+			return nil
+		}
+		bid.AdM = adm
+	}
+
+	entry := &BidEntry{
 		Bid:        bid,
 		Campaign:   campaign,
-		Score:      e.calculateBidScore(campaign, bidAmount, request),
+		Deal:       deal,
+		Tier:       campaign.Priority.Tier(),
+		Priority:   priority,
+		Floor:      floor,
+		Score:      e.calculateBidScore(campaign, strategy.Score(bidCtx, bidAmount)),
 		IsEligible: true,
+		Duration:   match.Creative.Duration,
+		trace:      trace,
+		match:      match,
+	}
+	trace.bid(entry)
+
+	return entry
+}
+
+// noticeURL builds a win, billing or loss notice URL. The ${...} macros are
+// left for the exchange to substitute before it calls the URL.
+func (e *Engine) noticeURL(request *models.BidRequest, notice, bidID string, campaign *models.Campaign, key, macro string) string {
+	target := fmt.Sprintf("%s/track/%s?bid_id=%s&campaign_id=%s&auction_id=%s&%s=%s",
+		e.trackingBaseURL, notice, bidID, campaign.ID, models.MacroAuctionID, key, macro)
+	if request.Test == 1 {
+		target += "&test=1"
+	}
+	return target
+}
+
+// trackingParams identifies the bid on impression and event trackers. The
+// site and device type let the prediction model learn rates per context.
+func trackingParams(request *models.BidRequest, bid *models.Bid, campaign *models.Campaign, creative *models.AdCreative) url.Values {
+	key := prediction.RequestKey(campaign.ID, request)
+
+	params := url.Values{}
+	params.Set("campaign_id", campaign.ID.String())
+	params.Set("creative_id", creative.ID.String())
+	params.Set("bid_id", bid.ID)
+	if key.SiteID != "" {
+		params.Set("site_id", key.SiteID)
+	}
+	if key.DeviceType != 0 {
+		params.Set("device_type", strconv.Itoa(key.DeviceType))
+	}
+	if request.Test == 1 {
+		params.Set("test", "1")
+	}
+	return params
+}
+
+// selectDeal picks the highest-priority deal in the impression's PMP that the
+// campaign is linked to and allowed to bid on. Deal bids get a priority above
+// zero so they always outrank open-auction bids.
+func (e *Engine) selectDeal(imp *models.Impression, campaign *models.Campaign, bidAmount float64) (*models.Deal, int, float64) {
+	if imp.PMP == nil || len(campaign.DealIDs) == 0 {
+		return nil, 0, 0
+	}
+
+	var best *models.Deal
+	var bestPriority int
+	var bestFloor float64
+
+	for i := range imp.PMP.Deals {
+		deal := &imp.PMP.Deals[i]
+		if !contains(campaign.DealIDs, deal.ID) {
+			continue
+		}
+
+		priority := 1
+		floor := deal.BidFloor
+		if e.dealService != nil {
+			stored, exists := e.dealService.Lookup(deal.ID)
+			if !exists || !stored.IsLive(time.Now()) {
+				continue
+			}
+			priority += stored.Priority
+			floor = math.Max(floor, stored.BidFloor)
+		}
+
+		if bidAmount < floor {
+			continue
+		}
+
+		if len(deal.WSeat) > 0 && !contains(deal.WSeat, campaign.SeatID()) {
+			continue
+		}
+
+		if len(deal.WAdomain) > 0 && !containsAny(deal.WAdomain, campaign.AdvertiserDomains) {
+			continue
+		}
+
+		if best == nil || priority > bestPriority {
+			best = deal
+			bestPriority = priority
+			bestFloor = floor
+		}
+	}
+
+	return best, bestPriority, bestFloor
+}
+
+func dealAuctionType(deal *models.Deal, fallback models.AuctionType) models.AuctionType {
+	switch deal.AT {
+	case 1:
+		return models.AuctionTypeFirstPrice
+	case 2:
+		return models.AuctionTypeSecondPrice
+	case 3:
+		return models.AuctionTypeFixedPrice
+	default:
+		return fallback
+	}
+}
+
+func matchesFormat(imp *models.Impression, campaign *models.Campaign) bool {
+	if campaign.TargetingRules == nil || len(campaign.TargetingRules.AdSizes) == 0 {
+		return true
+	}
+
+	for _, size := range impressionSizes(imp) {
+		if contains(campaign.TargetingRules.AdSizes, size) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func impressionSizes(imp *models.Impression) []string {
+	var sizes []string
+
+	if imp.Banner != nil {
+		if imp.Banner.W > 0 && imp.Banner.H > 0 {
+			sizes = append(sizes, fmt.Sprintf("%dx%d", imp.Banner.W, imp.Banner.H))
+		}
+		for _, format := range imp.Banner.Format {
+			if format.W > 0 && format.H > 0 {
+				sizes = append(sizes, fmt.Sprintf("%dx%d", format.W, format.H))
+			}
+		}
 	}
+
+	if imp.Video != nil && imp.Video.W > 0 && imp.Video.H > 0 {
+		sizes = append(sizes, fmt.Sprintf("%dx%d", imp.Video.W, imp.Video.H))
+	}
+
+	return sizes
 }
 
 func (e *Engine) checkTargeting(request *models.BidRequest, campaign *models.Campaign) bool {
@@ -174,11 +802,12 @@ func (e *Engine) checkTargeting(request *models.BidRequest, campaign *models.Cam
 	}
 
 	rules := campaign.TargetingRules
+	if rules.Expression != "" {
+		return e.matchesExpression(request, campaign)
+	}
 
-	if len(rules.GeoTargeting) > 0 && request.Device.Geo != nil {
-		if !contains(rules.GeoTargeting, request.Device.Geo.Country) {
-			return false
-		}
+	if !matchesGeo(rules.GeoRules(), requestGeo(request)) {
+		return false
 	}
 
 	if len(rules.DeviceTypes) > 0 {
@@ -188,19 +817,21 @@ func (e *Engine) checkTargeting(request *models.BidRequest, campaign *models.Cam
 		}
 	}
 
+	if !matchesDevice(rules.Device, request) {
+		return false
+	}
+
+	if len(rules.UserSegments) > 0 && !containsAny(rules.UserSegments, requestSegments(request)) {
+		return false
+	}
+
+	if !matchesContent(rules.Content, request) {
+		return false
+	}
+
 	if len(rules.DayParting) > 0 {
-		now := time.Now()
-		dayOfWeek := int(now.Weekday())
-		hour := now.Hour()
-		
-		isAllowed := false
-		for _, rule := range rules.DayParting {
-			if rule.DayOfWeek == dayOfWeek && hour >= rule.StartHour && hour < rule.EndHour {
-				isAllowed = true
-				break
-			}
-		}
-		if !isAllowed {
+		local, ok := campaignTime(rules, request, time.Now())
+		if !ok || !matchesDayParts(rules.DayParting, local) {
 			return false
 		}
 	}
@@ -208,31 +839,46 @@ func (e *Engine) checkTargeting(request *models.BidRequest, campaign *models.Cam
 	return true
 }
 
-func (e *Engine) calculateBidAmount(campaign *models.Campaign, request *models.BidRequest) float64 {
-	baseBid := campaign.BidAmount
-	
-	multiplier := 1.0
-	
-	if request.Device.DeviceType == 1 {
-		multiplier *= 1.2
+func (e *Engine) checkBlockLists(request *models.BidRequest, campaign *models.Campaign) bool {
+	seat := campaign.SeatID()
+
+	if len(request.WSeat) > 0 && !contains(request.WSeat, seat) {
+		return false
 	}
-	
-	if request.Site != nil && len(request.Site.Cat) > 0 {
-		multiplier *= 1.1
+
+	if contains(request.BSeat, seat) {
+		return false
 	}
-	
-	return baseBid * multiplier
+
+	if containsAny(request.BAdv, campaign.AdvertiserDomains) {
+		return false
+	}
+
+	if campaign.AppBundle != "" && contains(request.BApp, campaign.AppBundle) {
+		return false
+	}
+
+	for _, category := range campaign.Categories {
+		if matchesCategory(request.BCat, category) {
+			return false
+		}
+	}
+
+	return true
 }
 
-func (e *Engine) calculateBidScore(campaign *models.Campaign, bidAmount float64, request *models.BidRequest) float64 {
-	score := bidAmount
-	
-	if campaign.BidType == models.BidTypeCPC {
-		score *= 0.8
-	} else if campaign.BidType == models.BidTypeCPA {
-		score *= 0.6
+// matchesCategory reports whether category or its IAB parent (IAB1 for
+// IAB1-2) appears in the list.
+func matchesCategory(categories []string, category string) bool {
+	for _, c := range categories {
+		if c == category || strings.HasPrefix(category, c+"-") {
+			return true
+		}
 	}
-	
+	return false
+}
+
+func (e *Engine) calculateBidScore(campaign *models.Campaign, score float64) float64 {
 	remainingBudget := campaign.BudgetDaily - campaign.SpentDaily
 	if remainingBudget < campaign.BudgetDaily*0.2 {
 		score *= 0.9
@@ -246,20 +892,58 @@ func (e *Engine) selectWinner(bidEntries []*BidEntry) (*BidEntry, float64) {
 		return nil, 0
 	}
 
-	sort.Slice(bidEntries, func(i, j int) bool {
+	rankEntries(bidEntries)
+
+	return bidEntries[0], secondPriceAt(bidEntries, 0)
+}
+
+// rankEntries sorts bids for one impression by campaign tier, deal priority,
+// then score.
+func rankEntries(bidEntries []*BidEntry) {
+	sort.SliceStable(bidEntries, func(i, j int) bool {
+		if bidEntries[i].Tier != bidEntries[j].Tier {
+			return bidEntries[i].Tier > bidEntries[j].Tier
+		}
+		if bidEntries[i].Priority != bidEntries[j].Priority {
+			return bidEntries[i].Priority > bidEntries[j].Priority
+		}
 		return bidEntries[i].Score > bidEntries[j].Score
 	})
+}
 
-	winner := bidEntries[0]
-	
-	var secondPrice float64
-	if len(bidEntries) > 1 {
-		secondPrice = bidEntries[1].Bid.Price
-	} else {
-		secondPrice = winner.Bid.Price * 0.8
+// secondPriceAt is the second price for the ranked entry at rank: the next
+// bid at the same tier and priority, or 80% of its own bid when there is none.
+func secondPriceAt(bidEntries []*BidEntry, rank int) float64 {
+	winner := bidEntries[rank]
+	if next := rank + 1; next < len(bidEntries) && bidEntries[next].Tier == winner.Tier && bidEntries[next].Priority == winner.Priority {
+		return bidEntries[rank+1].Bid.Price
 	}
+	return winner.Bid.Price * 0.8
+}
 
-	return winner, secondPrice
+func (e *Engine) resolveAuctionType(request *models.BidRequest) models.AuctionType {
+	switch request.AT {
+	case 1:
+		return models.AuctionTypeFirstPrice
+	case 2:
+		return models.AuctionTypeSecondPrice
+	default:
+		if e.auctionType == "" {
+			return models.AuctionTypeSecondPrice
+		}
+		return e.auctionType
+	}
+}
+
+func (e *Engine) determineClearingPrice(auctionType models.AuctionType, winningBid, secondPrice, bidFloor float64) float64 {
+	switch auctionType {
+	case models.AuctionTypeFirstPrice:
+		return math.Max(winningBid, bidFloor)
+	case models.AuctionTypeFixedPrice:
+		return bidFloor
+	}
+
+	return e.determineFinalPrice(winningBid, secondPrice, bidFloor)
 }
 
 func (e *Engine) determineFinalPrice(winningBid, secondPrice, bidFloor float64) float64 {
@@ -276,19 +960,45 @@ func (e *Engine) determineFinalPrice(winningBid, secondPrice, bidFloor float64)
 	return finalPrice
 }
 
-func (e *Engine) createBidResponse(request *models.BidRequest, winner *BidEntry, finalPrice float64) *models.BidResponse {
-	winner.Bid.Price = finalPrice
+// createBidResponse groups winning bids by seat. The ads of a pod share one
+// seat bid, won or lost as a group, with the seat set when they agree on it.
+func (e *Engine) createBidResponse(request *models.BidRequest, auctions []*impressionAuction) *models.BidResponse {
+	var seatBids []models.SeatBid
+	seatIndex := make(map[string]int)
+	podIndex := make(map[string]int)
+
+	for _, a := range auctions {
+		bid := *a.Winner.Bid
+		bid.Price = a.FinalPrice
+
+		seat := a.Winner.Campaign.SeatID()
+		if a.PodID != "" {
+			idx, exists := podIndex[a.PodID]
+			if !exists {
+				idx = len(seatBids)
+				podIndex[a.PodID] = idx
+				seatBids = append(seatBids, models.SeatBid{Seat: seat, Group: 1})
+			} else if seatBids[idx].Seat != seat {
+				seatBids[idx].Seat = ""
+			}
+			seatBids[idx].Bid = append(seatBids[idx].Bid, bid)
+			continue
+		}
+
+		idx, exists := seatIndex[seat]
+		if !exists {
+			idx = len(seatBids)
+			seatIndex[seat] = idx
+			seatBids = append(seatBids, models.SeatBid{Seat: seat})
+		}
+		seatBids[idx].Bid = append(seatBids[idx].Bid, bid)
+	}
 	
 	return &models.BidResponse{
-		ID:    request.ID,
-		BidID: uuid.New().String(),
-		Cur:   "USD",
-		SeatBid: []models.SeatBid{
-			{
-				Bid:  []models.Bid{*winner.Bid},
-				Seat: "advertiser-1",
-			},
-		},
+		ID:      request.ID,
+		BidID:   uuid.New().String(),
+		Cur:     "USD",
+		SeatBid: seatBids,
 	}
 }
 
@@ -301,51 +1011,69 @@ func (e *Engine) createNoBidResponse(requestID string) *models.BidResponse {
 	}
 }
 
-func (e *Engine) recordAuctionResult(
+func (e *Engine) recordAuctionResults(
 	ctx context.Context,
 	request *models.BidRequest,
-	winner *BidEntry,
-	finalPrice, secondPrice float64,
-	totalBids int,
+	auctions []*impressionAuction,
 	processingTime time.Duration,
 ) {
-	var winningBidID *uuid.UUID
-	if winner != nil {
-		id := uuid.MustParse(winner.Bid.ID)
-		winningBidID = &id
-	}
+	results := make([]*models.AuctionResult, 0, len(auctions))
+	for _, a := range auctions {
+		winningBidID := uuid.MustParse(a.Winner.Bid.ID)
 
-	result := &models.AuctionResult{
-		ID:             uuid.New(),
-		BidRequestID:   request.ID,
-		WinningBidID:   winningBidID,
-		WinningPrice:   finalPrice,
-		SecondPrice:    secondPrice,
-		TotalBids:      totalBids,
-		AuctionType:    "second-price",
-		ProcessingTime: processingTime.Milliseconds(),
-		Timestamp:      time.Now(),
+		results = append(results, &models.AuctionResult{
+			ID:             uuid.New(),
+			BidRequestID:   request.ID,
+			ImpID:          a.Imp.ID,
+			WinningBidID:   &winningBidID,
+			WinningPrice:   a.FinalPrice,
+			WinningBid:     a.Winner.Bid.Price,
+			SecondPrice:    a.SecondPrice,
+			TotalBids:      a.TotalBids,
+			AuctionType:    a.AuctionType,
+			ProcessingTime: processingTime.Milliseconds(),
+			Timestamp:      time.Now(),
+		})
 	}
 
-	if err := e.redis.CacheBidRequest(request.ID, result, 5*time.Minute); err != nil {
+	if err := e.redis.CacheBidRequest(request.ID, results, resultCacheTTL); err != nil {
 		e.logger.WithError(err).Error("Failed to cache auction result")
 	}
 
-	e.kafka.PublishEvent(ctx, e.brokers, "auction-results", result)
+	for _, result := range results {
+		e.kafka.PublishEvent(ctx, e.brokers, eventTopic(request, "auction-results"), result)
+	}
 }
 
 func (e *Engine) publishBidRequest(ctx context.Context, request *models.BidRequest) {
-	if err := e.kafka.PublishBidRequest(ctx, e.brokers, request); err != nil {
+	if err := e.kafka.PublishEvent(ctx, e.brokers, eventTopic(request, "bid-requests"), request); err != nil {
 		e.logger.WithError(err).Error("Failed to publish bid request")
 	}
 }
 
-func (e *Engine) publishBidResponse(ctx context.Context, response *models.BidResponse) {
-	if err := e.kafka.PublishBidResponse(ctx, e.brokers, response); err != nil {
+func (e *Engine) publishBidResponse(ctx context.Context, request *models.BidRequest, response *models.BidResponse) {
+	if err := e.kafka.PublishEvent(ctx, e.brokers, eventTopic(request, "bid-responses"), response); err != nil {
 		e.logger.WithError(err).Error("Failed to publish bid response")
 	}
 }
 
+// eventTopic routes test requests to the test copy of topic.
+func eventTopic(request *models.BidRequest, topic string) string {
+	if request.Test == 1 {
+		return kafka.TestTopic(topic)
+	}
+	return topic
+}
+
+func containsAny(slice []string, items []string) bool {
+	for _, item := range items {
+		if contains(slice, item) {
+			return true
+		}
+	}
+	return false
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
@@ -2,13 +2,27 @@ package auction
 
 import (
 	"context"
+	"encoding/json"
+	"math/rand"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ad-delivery-simulator/internal/bidding"
+	"github.com/ad-delivery-simulator/internal/campaign"
+	"github.com/ad-delivery-simulator/internal/creative"
+	"github.com/ad-delivery-simulator/internal/deal"
+	"github.com/ad-delivery-simulator/internal/inventory"
 	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/sqltest"
+	"github.com/ad-delivery-simulator/pkg/kafka"
+	"github.com/ad-delivery-simulator/pkg/redis"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockCampaignService struct {
@@ -99,7 +113,7 @@ func TestEngine_SelectWinner(t *testing.T) {
 				assert.Equal(t, tt.expectedWinner.Score, winner.Score)
 			}
 			
-			assert.Equal(t, tt.expectedSecond, secondPrice)
+			assert.InDelta(t, tt.expectedSecond, secondPrice, 0.001)
 		})
 	}
 }
@@ -238,75 +252,1305 @@ func TestEngine_CheckTargeting(t *testing.T) {
 	}
 }
 
-func TestEngine_CalculateBidAmount(t *testing.T) {
+func TestMatchesGeo(t *testing.T) {
+	springfield := &models.Geo{Country: "US", Region: "IL", City: "Springfield", ZIP: "62701", Lat: 39.80, Lon: -89.65}
+
+	tests := []struct {
+		name     string
+		rules    []models.GeoRule
+		geo      *models.Geo
+		expected bool
+	}{
+		{"No rules", nil, nil, true},
+		{"Unknown geo", []models.GeoRule{{Mode: models.GeoModeInclude, Country: "US"}}, nil, false},
+		{"Country and city", []models.GeoRule{{Mode: models.GeoModeInclude, Country: "us", City: "springfield", Region: "IL"}}, springfield, true},
+		{"Same city in another region", []models.GeoRule{{Mode: models.GeoModeInclude, City: "Springfield", Region: "MA"}}, springfield, false},
+		{"Any of several includes", []models.GeoRule{
+			{Mode: models.GeoModeInclude, ZIP: "10001"},
+			{Mode: models.GeoModeInclude, ZIP: "62701"},
+		}, springfield, true},
+		{"Excluded metro", []models.GeoRule{{Mode: models.GeoModeExclude, Region: "IL"}}, springfield, false},
+		{"Exclude only", []models.GeoRule{{Mode: models.GeoModeExclude, Region: "NY"}}, springfield, true},
+		{"Exclude that can't be checked", []models.GeoRule{{Mode: models.GeoModeExclude, Metro: "501"}}, springfield, false},
+		{"Include without the field", []models.GeoRule{{Mode: models.GeoModeInclude, Metro: "648"}}, springfield, false},
+		{"Within radius", []models.GeoRule{{Mode: models.GeoModeInclude, Lat: 39.78, Lon: -89.60, RadiusKM: 10}}, springfield, true},
+		{"Outside radius", []models.GeoRule{{Mode: models.GeoModeInclude, Lat: 41.88, Lon: -87.63, RadiusKM: 100}}, springfield, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, matchesGeo(tt.rules, tt.geo))
+		})
+	}
+}
+
+func TestEngine_CheckTargeting_GeoFallback(t *testing.T) {
+	engine := &Engine{}
+	campaign := &models.Campaign{TargetingRules: &models.TargetingRules{GeoTargeting: []string{"US"}}}
+
+	assert.False(t, engine.checkTargeting(&models.BidRequest{}, campaign))
+	assert.True(t, engine.checkTargeting(&models.BidRequest{User: models.User{Geo: &models.Geo{Country: "US"}}}, campaign))
+
+	radius := &models.Campaign{TargetingRules: &models.TargetingRules{
+		Geo: []models.GeoRule{{Mode: models.GeoModeInclude, Country: "US", Lat: 40.71, Lon: -74.00, RadiusKM: 25}},
+	}}
+	request := &models.BidRequest{
+		Device: models.Device{Geo: &models.Geo{Lat: 40.73, Lon: -73.99}},
+		User:   models.User{Geo: &models.Geo{Country: "US"}},
+	}
+	assert.True(t, engine.checkTargeting(request, radius))
+}
+
+func TestEngine_CheckTargeting_UserSegments(t *testing.T) {
+	engine := &Engine{}
+	campaign := &models.Campaign{TargetingRules: &models.TargetingRules{UserSegments: []string{"auto-intender"}}}
+
+	assert.False(t, engine.checkTargeting(&models.BidRequest{}, campaign))
+
+	request := &models.BidRequest{User: models.User{Data: []models.Data{
+		{ID: "dmp", Segment: []models.Segment{{ID: "sports"}}},
+		{ID: profileDataID, Segment: []models.Segment{{ID: "auto-intender"}}},
+	}}}
+	assert.True(t, engine.checkTargeting(request, campaign))
+}
+
+func TestWithProfileSegments(t *testing.T) {
+	exchange := []models.Data{{ID: "dmp", Segment: []models.Segment{{ID: "sports"}}}}
+
+	data := withProfileSegments(exchange, []string{"auto-intender"})
+	data = withProfileSegments(data, []string{"auto-intender", "traveler"})
+
+	assert.Len(t, data, 2, "a second run replaces the profile entry")
+	assert.Equal(t, "dmp", data[0].ID)
+	assert.Equal(t, profileDataID, data[1].ID)
+	assert.Equal(t, []models.Segment{{ID: "auto-intender"}, {ID: "traveler"}}, data[1].Segment)
+	assert.Equal(t, []models.Data{{ID: "dmp", Segment: []models.Segment{{ID: "sports"}}}}, exchange)
+}
+
+func TestEngine_CheckTargeting_Expression(t *testing.T) {
+	engine := &Engine{}
+	campaign := &models.Campaign{TargetingRules: &models.TargetingRules{
+		DeviceTypes: []string{"1"},
+		Expression:  `(geo.country in ["US","CA"] and device.type == 4) or segment("sports")`,
+	}}
+
+	ctv := &models.BidRequest{Device: models.Device{DeviceType: 4}, User: models.User{Geo: &models.Geo{Country: "ca"}}}
+	assert.True(t, engine.checkTargeting(ctv, campaign), "expression replaces device_types")
+
+	fan := &models.BidRequest{
+		Device: models.Device{DeviceType: 2},
+		User:   models.User{Data: []models.Data{{Segment: []models.Segment{{ID: "sports"}}}}},
+	}
+	assert.True(t, engine.checkTargeting(fan, campaign))
+	assert.False(t, engine.checkTargeting(&models.BidRequest{Device: models.Device{DeviceType: 4}}, campaign))
+
+	kv := &models.Campaign{TargetingRules: &models.TargetingRules{Expression: `kv("section", "sports") and imp.size == "300x250"`}}
+	request := &models.BidRequest{
+		Site: &models.Site{Ext: map[string]interface{}{"section": "sports"}},
+		Imp:  []models.Impression{{ID: "1", Banner: &models.Banner{W: 300, H: 250}}},
+	}
+	assert.True(t, engine.checkTargeting(request, kv))
+}
+
+func TestMatchesDayParts(t *testing.T) {
+	lateNight := []models.DayPartRule{{DayOfWeek: 5, StartHour: 22, EndHour: 2}}
+	saturday := []models.DayPartRule{{DayOfWeek: 6, StartHour: 0, EndHour: 24}}
+	sundayNight := []models.DayPartRule{{DayOfWeek: 0, StartHour: 23, EndHour: 1}}
+
+	at := func(day, hour int) time.Time {
+		return time.Date(2024, 1, 7+day, hour, 30, 0, 0, time.UTC) // 2024-01-07 is a Sunday
+	}
+
+	assert.False(t, matchesDayParts(lateNight, at(5, 21)))
+	assert.True(t, matchesDayParts(lateNight, at(5, 22)))
+	assert.True(t, matchesDayParts(lateNight, at(6, 1)))
+	assert.False(t, matchesDayParts(lateNight, at(6, 2)))
+	assert.True(t, matchesDayParts(saturday, at(6, 23)))
+	assert.False(t, matchesDayParts(saturday, at(0, 0)))
+	assert.True(t, matchesDayParts(sundayNight, at(1, 0)), "Sunday night runs into Monday")
+	assert.False(t, matchesDayParts(sundayNight, at(6, 23)))
+}
+
+func TestDayPartTime(t *testing.T) {
+	now := time.Date(2024, 1, 12, 3, 30, 0, 0, time.UTC) // Friday 03:30 UTC
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	local := dayPartTime(newYork, false, &models.BidRequest{}, now)
+	assert.Equal(t, time.Thursday, local.Weekday())
+	assert.Equal(t, 22, local.Hour())
+
+	tokyo := &models.BidRequest{Device: models.Device{Geo: &models.Geo{Country: "JP", UTCOffset: 540}}}
+	local = dayPartTime(newYork, true, tokyo, now)
+	assert.Equal(t, time.Friday, local.Weekday())
+	assert.Equal(t, 12, local.Hour())
+
+	local = dayPartTime(newYork, true, &models.BidRequest{}, now)
+	assert.Equal(t, 22, local.Hour(), "no utcoffset falls back to the campaign timezone")
+}
+
+func TestEngine_CheckTargeting_DayPartTimezone(t *testing.T) {
+	engine := &Engine{}
+	now := time.Now()
+
+	// A window covering only the current hour in Tokyo, checked with the
+	// user's offset and with the campaign's timezone.
+	tokyoNow := now.In(time.FixedZone("", 540*60))
+	window := []models.DayPartRule{{DayOfWeek: int(tokyoNow.Weekday()), StartHour: tokyoNow.Hour(), EndHour: (tokyoNow.Hour() + 1) % 24}}
+	request := &models.BidRequest{User: models.User{Geo: &models.Geo{UTCOffset: 540}}}
+
+	userTime := &models.Campaign{TargetingRules: &models.TargetingRules{DayParting: window, DayPartTimezone: "UTC", DayPartUserTime: true}}
+	assert.True(t, engine.checkTargeting(request, userTime))
+
+	zoned := &models.Campaign{TargetingRules: &models.TargetingRules{DayParting: window, DayPartTimezone: "Asia/Tokyo"}}
+	assert.True(t, engine.checkTargeting(&models.BidRequest{}, zoned))
+
+	elsewhere := &models.Campaign{TargetingRules: &models.TargetingRules{DayParting: window, DayPartTimezone: "America/Sao_Paulo"}}
+	assert.False(t, engine.checkTargeting(&models.BidRequest{}, elsewhere))
+
+	unknown := &models.Campaign{TargetingRules: &models.TargetingRules{DayParting: window, DayPartTimezone: "Mars/Olympus_Mons"}}
+	assert.False(t, engine.checkTargeting(&models.BidRequest{}, unknown))
+}
+
+func TestMatchesContent(t *testing.T) {
+	live := true
+	request := &models.BidRequest{Site: &models.Site{
+		Cat:      []string{"IAB17"},
+		PageCat:  []string{"IAB17-3"},
+		Keywords: "Football, Premier League",
+		Content: &models.Content{
+			Language:       "en",
+			Genre:          "Sports",
+			ContentRating:  "TV-PG",
+			QAGMediaRating: 1,
+			Keywords:       "highlights",
+			LiveStream:     1,
+		},
+	}}
+
+	tests := []struct {
+		name     string
+		rules    *models.ContentTargeting
+		expected bool
+	}{
+		{"No rules", nil, true},
+		{"Included parent category", &models.ContentTargeting{IncludeCategories: []string{"IAB17"}}, true},
+		{"Included subcategory", &models.ContentTargeting{IncludeCategories: []string{"IAB17-3"}}, true},
+		{"Category not included", &models.ContentTargeting{IncludeCategories: []string{"IAB2"}}, false},
+		{"Excluded page category", &models.ContentTargeting{ExcludeCategories: []string{"IAB17-3"}}, false},
+		{"Included keyword", &models.ContentTargeting{IncludeKeywords: []string{"premier league"}}, true},
+		{"Content keyword", &models.ContentTargeting{IncludeKeywords: []string{"Highlights"}}, true},
+		{"Excluded keyword", &models.ContentTargeting{ExcludeKeywords: []string{"football"}}, false},
+		{"Language and rating", &models.ContentTargeting{Languages: []string{"EN", "fr"}, Ratings: []string{"TV-PG"}}, true},
+		{"Wrong language", &models.ContentTargeting{Languages: []string{"de"}}, false},
+		{"Media rating", &models.ContentTargeting{MaxMediaRating: 1}, true},
+		{"Live only", &models.ContentTargeting{LiveStream: &live, Genres: []string{"sports"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, matchesContent(tt.rules, request))
+		})
+	}
+
+	bare := &models.BidRequest{App: &models.App{}}
+	assert.False(t, matchesContent(&models.ContentTargeting{IncludeCategories: []string{"IAB17"}}, bare))
+	assert.True(t, matchesContent(&models.ContentTargeting{ExcludeKeywords: []string{"football"}}, bare))
+	assert.False(t, matchesContent(&models.ContentTargeting{Languages: []string{"en"}}, bare))
+}
+
+func TestEngine_CheckTargeting_ContentWithGeo(t *testing.T) {
 	engine := &Engine{}
+	campaign := &models.Campaign{TargetingRules: &models.TargetingRules{
+		GeoTargeting: []string{"US"},
+		Content:      &models.ContentTargeting{IncludeCategories: []string{"IAB17"}},
+	}}
+	expression := &models.Campaign{TargetingRules: &models.TargetingRules{
+		Expression: `geo.country == "US" and category("IAB17") and not keywords == "betting" and content.language == "en"`,
+	}}
+
+	request := &models.BidRequest{
+		Site:   &models.Site{PageCat: []string{"IAB17-12"}, Content: &models.Content{Language: "en"}, Keywords: "tennis"},
+		Device: models.Device{Geo: &models.Geo{Country: "US"}},
+	}
+	assert.True(t, engine.checkTargeting(request, campaign))
+	assert.True(t, engine.checkTargeting(request, expression))
+
+	request.Site.Keywords = "tennis,Betting"
+	assert.False(t, engine.checkTargeting(request, expression))
+
+	request.Device.Geo.Country = "CA"
+	assert.False(t, engine.checkTargeting(request, campaign))
+}
+
+func TestMatchesDevice(t *testing.T) {
+	request := &models.BidRequest{
+		App: &models.App{Bundle: "com.example.game"},
+		Device: models.Device{
+			OS:             "iOS",
+			OSV:            "16.4.1",
+			Make:           "Apple",
+			Model:          "iPhone14,2",
+			ConnectionType: 6,
+			Carrier:        "Verizon",
+			MCCMNC:         "311-480",
+			Language:       "en",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		rules    *models.DeviceTargeting
+		expected bool
+	}{
+		{"No rules", nil, true},
+		{"OS in range", &models.DeviceTargeting{OS: &models.OSFilter{Include: []models.OSRange{{OS: "ios", MinVersion: "15", MaxVersion: "16"}}}}, true},
+		{"OS below range", &models.DeviceTargeting{OS: &models.OSFilter{Include: []models.OSRange{{OS: "iOS", MinVersion: "16.5"}}}}, false},
+		{"Other OS", &models.DeviceTargeting{OS: &models.OSFilter{Include: []models.OSRange{{OS: "Android"}}}}, false},
+		{"Excluded old iOS", &models.DeviceTargeting{OS: &models.OSFilter{Exclude: []models.OSRange{{OS: "iOS", MaxVersion: "14"}}}}, true},
+		{"Excluded iOS 16", &models.DeviceTargeting{OS: &models.OSFilter{Exclude: []models.OSRange{{OS: "iOS", MinVersion: "16.0"}}}}, false},
+		{"Make and model", &models.DeviceTargeting{Make: &models.Filter{Include: []string{"apple"}}, Model: &models.Filter{Exclude: []string{"iPhone8,1"}}}, true},
+		{"Excluded make", &models.DeviceTargeting{Make: &models.Filter{Exclude: []string{"Apple"}}}, false},
+		{"Cellular connection", &models.DeviceTargeting{ConnectionTypes: &models.Filter{Include: []string{"4", "5", "6"}}}, true},
+		{"Wifi only", &models.DeviceTargeting{ConnectionTypes: &models.Filter{Include: []string{"2"}}}, false},
+		{"Carrier and MCCMNC", &models.DeviceTargeting{Carrier: &models.Filter{Include: []string{"verizon"}}, MCCMNC: &models.Filter{Include: []string{"311-480"}}}, true},
+		{"Excluded language", &models.DeviceTargeting{Language: &models.Filter{Exclude: []string{"en"}}}, false},
+		{"App inventory", &models.DeviceTargeting{InventoryType: models.InventoryApp, AppBundles: &models.Filter{Include: []string{"com.example.game"}}}, true},
+		{"Site inventory", &models.DeviceTargeting{InventoryType: models.InventorySite}, false},
+		{"Site domains on app", &models.DeviceTargeting{SiteDomains: &models.Filter{Include: []string{"example.com"}}}, false},
+		{"Excluded site domains on app", &models.DeviceTargeting{SiteDomains: &models.Filter{Exclude: []string{"example.com"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, matchesDevice(tt.rules, request))
+		})
+	}
+
+	site := &models.BidRequest{Site: &models.Site{Domain: "news.example.com"}}
+	assert.True(t, matchesDevice(&models.DeviceTargeting{SiteDomains: &models.Filter{Include: []string{"example.com"}}}, site))
+	assert.False(t, matchesDevice(&models.DeviceTargeting{SiteDomains: &models.Filter{Exclude: []string{"Example.com"}}}, site))
+	assert.False(t, matchesDevice(&models.DeviceTargeting{SiteDomains: &models.Filter{Include: []string{"ample.com"}}}, site))
+
+	noVersion := &models.BidRequest{Device: models.Device{OS: "iOS"}}
+	assert.False(t, matchesDevice(&models.DeviceTargeting{OS: &models.OSFilter{Exclude: []models.OSRange{{OS: "iOS", MaxVersion: "14"}}}}, noVersion), "unknown version fails a bounded exclude")
+	assert.True(t, matchesDevice(&models.DeviceTargeting{OS: &models.OSFilter{Include: []models.OSRange{{OS: "iOS"}}}}, noVersion))
+
+	clientHints := &models.BidRequest{Device: models.Device{SUA: &models.UserAgent{
+		Platform: &models.BrandVersion{Brand: "Android", Version: []string{"13", "0", "0"}},
+	}}}
+	assert.True(t, matchesDevice(&models.DeviceTargeting{OS: &models.OSFilter{Include: []models.OSRange{{OS: "android", MinVersion: "12"}}}}, clientHints), "sua fills in a missing os and osv")
+	assert.False(t, matchesDevice(&models.DeviceTargeting{OS: &models.OSFilter{Include: []models.OSRange{{OS: "android", MaxVersion: "12"}}}}, clientHints))
+}
+
+func TestMatchesKeyValues(t *testing.T) {
+	request := &models.BidRequest{Site: &models.Site{Ext: map[string]interface{}{
+		"section": "sports",
+		"tags":    []interface{}{"football", "live"},
+	}}}
+	imp := &models.Impression{Ext: map[string]interface{}{"position": float64(1), "sticky": true}}
+	values := requestKeyValues(request, imp)
 
 	tests := []struct {
 		name     string
+		rules    *models.TargetingRules
+		expected bool
+	}{
+		{"No rules", &models.TargetingRules{}, true},
+		{"Legacy custom targeting", &models.TargetingRules{CustomTargeting: map[string]string{"section": "sports", "position": "1"}}, true},
+		{"Legacy custom targeting mismatch", &models.TargetingRules{CustomTargeting: map[string]string{"section": "news"}}, false},
+		{"All keys match", &models.TargetingRules{KeyValues: &models.KeyValueTargeting{Values: map[string][]string{
+			"tags": {"tennis", "live"}, "sticky": {"true"},
+		}}}, true},
+		{"All keys with one missing", &models.TargetingRules{KeyValues: &models.KeyValueTargeting{Values: map[string][]string{
+			"tags": {"live"}, "genre": {"comedy"},
+		}}}, false},
+		{"Any key matches", &models.TargetingRules{KeyValues: &models.KeyValueTargeting{Match: models.KeyValueMatchAny, Values: map[string][]string{
+			"tags": {"live"}, "genre": {"comedy"},
+		}}}, true},
+		{"Any key without a match", &models.TargetingRules{KeyValues: &models.KeyValueTargeting{Match: models.KeyValueMatchAny, Values: map[string][]string{
+			"genre": {"comedy"},
+		}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, matchesKeyValues(tt.rules, values))
+		})
+	}
+}
+
+func TestEngine_RunImpressionAuctions(t *testing.T) {
+	engine := &Engine{}
+
+	request := &models.BidRequest{
+		Imp: []models.Impression{
+			{ID: "1", BidFloor: 1.00},
+			{ID: "2", BidFloor: 0.50},
+			{ID: "3", BidFloor: 0.50},
+		},
+	}
+
+	bidEntries := []*BidEntry{
+		{Bid: &models.Bid{ImpID: "1", Price: 2.00}, Score: 2.00},
+		{Bid: &models.Bid{ImpID: "1", Price: 1.50}, Score: 1.50},
+		{Bid: &models.Bid{ImpID: "2", Price: 1.00}, Score: 1.00},
+	}
+
+	auctions := engine.runImpressionAuctions(request, bidEntries)
+
+	assert.Len(t, auctions, 2)
+	assert.Equal(t, "1", auctions[0].Imp.ID)
+	assert.Equal(t, 2, auctions[0].TotalBids)
+	assert.InDelta(t, 1.51, auctions[0].FinalPrice, 0.001)
+	assert.Equal(t, "2", auctions[1].Imp.ID)
+	assert.Equal(t, 1, auctions[1].TotalBids)
+	assert.InDelta(t, 0.81, auctions[1].FinalPrice, 0.001)
+}
+
+func TestEngine_RunImpressionAuctions_CompetitiveSeparation(t *testing.T) {
+	engine := &Engine{}
+
+	advertiserA := &models.Campaign{ID: uuid.New(), AdvertiserID: "a"}
+	advertiserB := &models.Campaign{ID: uuid.New(), AdvertiserID: "b", Categories: []string{"IAB2"}}
+	advertiserC := &models.Campaign{ID: uuid.New(), AdvertiserID: "c", CompetitiveLabels: []string{"airline"}}
+	advertiserD := &models.Campaign{ID: uuid.New(), AdvertiserID: "d", Categories: []string{"IAB2"}}
+	advertiserE := &models.Campaign{ID: uuid.New(), AdvertiserID: "e", CompetitiveLabels: []string{"airline"}}
+
+	entry := func(impID string, campaign *models.Campaign, price float64) *BidEntry {
+		return &BidEntry{Bid: &models.Bid{ImpID: impID, CID: campaign.ID.String(), Price: price}, Campaign: campaign, Score: price}
+	}
+	winners := func(auctions []*impressionAuction) map[string]*models.Campaign {
+		won := make(map[string]*models.Campaign)
+		for _, a := range auctions {
+			won[a.Imp.ID] = a.Winner.Campaign
+		}
+		return won
+	}
+	request := &models.BidRequest{AT: 1, Imp: []models.Impression{{ID: "1"}, {ID: "2"}}}
+
+	t.Run("Same advertiser goes where it earns most", func(t *testing.T) {
+		auctions := engine.runImpressionAuctions(request, []*BidEntry{
+			entry("1", advertiserA, 3.00), entry("1", advertiserB, 2.50),
+			entry("2", advertiserA, 2.00), entry("2", advertiserE, 0.50),
+		})
+
+		won := winners(auctions)
+		assert.Equal(t, advertiserB, won["1"])
+		assert.Equal(t, advertiserA, won["2"])
+	})
+
+	t.Run("Shared category and label", func(t *testing.T) {
+		auctions := engine.runImpressionAuctions(request, []*BidEntry{
+			entry("1", advertiserB, 3.00), entry("1", advertiserC, 1.00),
+			entry("2", advertiserD, 2.00), entry("2", advertiserE, 0.50),
+		})
+
+		won := winners(auctions)
+		assert.Equal(t, advertiserB, won["1"])
+		assert.Equal(t, advertiserE, won["2"])
+	})
+
+	t.Run("Slot left empty when every bid clashes", func(t *testing.T) {
+		auctions := engine.runImpressionAuctions(request, []*BidEntry{
+			entry("1", advertiserA, 3.00),
+			entry("2", advertiserA, 1.00),
+		})
+
+		assert.Len(t, auctions, 1)
+		assert.Equal(t, advertiserA, winners(auctions)["1"])
+	})
+
+	t.Run("Top bids win without clashes", func(t *testing.T) {
+		auctions := engine.runImpressionAuctions(request, []*BidEntry{
+			entry("1", advertiserA, 3.00), entry("1", advertiserB, 2.50),
+			entry("2", advertiserC, 2.00), entry("2", advertiserD, 0.50),
+		})
+
+		won := winners(auctions)
+		assert.Equal(t, advertiserA, won["1"])
+		assert.Equal(t, advertiserC, won["2"])
+	})
+}
+
+func TestEngine_RunImpressionAuctions_PriorityTiers(t *testing.T) {
+	engine := &Engine{}
+
+	sponsorship := &models.Campaign{ID: uuid.New(), AdvertiserID: "s", Priority: models.PrioritySponsorship}
+	openA := &models.Campaign{ID: uuid.New(), AdvertiserID: "a"}
+	openB := &models.Campaign{ID: uuid.New(), AdvertiserID: "b", Priority: models.PriorityPricePriority}
+	house := &models.Campaign{ID: uuid.New(), AdvertiserID: "h", Priority: models.PriorityHouse}
+
+	entry := func(impID string, campaign *models.Campaign, price float64) *BidEntry {
+		return &BidEntry{
+			Bid:      &models.Bid{ImpID: impID, CID: campaign.ID.String(), Price: price},
+			Campaign: campaign,
+			Tier:     campaign.Priority.Tier(),
+			Score:    price,
+		}
+	}
+
+	request := &models.BidRequest{Imp: []models.Impression{
+		{ID: "1", BidFloor: 0.50},
+		{ID: "2", BidFloor: 0.50},
+	}}
+
+	auctions := engine.runImpressionAuctions(request, []*BidEntry{
+		entry("1", openA, 5.00), entry("1", sponsorship, 1.00), entry("1", openB, 4.00), entry("1", house, 0),
+		entry("2", house, 0),
+	})
+
+	assert.Len(t, auctions, 2)
+	assert.Equal(t, sponsorship, auctions[0].Winner.Campaign, "higher tier wins regardless of price")
+	assert.InDelta(t, 0.81, auctions[0].FinalPrice, 0.001, "no other sponsorship bid sets the second price")
+	assert.Equal(t, house, auctions[1].Winner.Campaign, "house ad fills the slot nothing else bid on")
+	assert.Equal(t, 0.0, auctions[1].FinalPrice)
+}
+
+func TestEngine_RunImpressionAuctions_SeparationKeepsTiers(t *testing.T) {
+	engine := &Engine{}
+
+	sponsorship := &models.Campaign{ID: uuid.New(), AdvertiserID: "x", Priority: models.PrioritySponsorship}
+	pricePriority := &models.Campaign{ID: uuid.New(), AdvertiserID: "x", Priority: models.PriorityPricePriority}
+	openC := &models.Campaign{ID: uuid.New(), AdvertiserID: "c", Priority: models.PriorityPricePriority}
+	house := &models.Campaign{ID: uuid.New(), AdvertiserID: "h", Priority: models.PriorityHouse}
+
+	entry := func(impID string, campaign *models.Campaign, price float64) *BidEntry {
+		return &BidEntry{
+			Bid:      &models.Bid{ImpID: impID, CID: campaign.ID.String(), Price: price},
+			Campaign: campaign,
+			Tier:     campaign.Priority.Tier(),
+			Score:    price,
+		}
+	}
+
+	request := &models.BidRequest{AT: 1, Imp: []models.Impression{
+		{ID: "1", BidFloor: 0.50},
+		{ID: "2", BidFloor: 0.50},
+	}}
+
+	// Giving up the sponsorship for openC would let the pricier
+	// price-priority bid win slot 2 and earn more overall.
+	auctions := engine.runImpressionAuctions(request, []*BidEntry{
+		entry("1", sponsorship, 1.00), entry("1", openC, 2.00),
+		entry("2", pricePriority, 5.00), entry("2", house, 0),
+	})
+
+	require.Len(t, auctions, 2)
+	assert.Equal(t, sponsorship, auctions[0].Winner.Campaign, "a sponsorship bid is never dropped for lower-tier revenue")
+	assert.Equal(t, house, auctions[1].Winner.Campaign)
+}
+
+func TestEngine_CreateBidEntry_House(t *testing.T) {
+	engine := &Engine{}
+	strategy, _ := bidding.New(bidding.DefaultStrategy, nil)
+
+	house := &models.Campaign{ID: uuid.New(), BidAmount: 0.10, Priority: models.PriorityHouse}
+	creatives := []*models.AdCreative{
+		{ID: uuid.New(), Type: models.CreativeTypeBanner, Width: 300, Height: 250},
+	}
+	request := &models.BidRequest{Imp: []models.Impression{{
+		ID:       "1",
+		Banner:   &models.Banner{W: 300, H: 250},
+		BidFloor: 1.00,
+	}}}
+
+	entry := engine.createBidEntry(request, &request.Imp[0], house, strategy, creatives, nil)
+
+	assert.NotNil(t, entry, "house ads ignore the floor")
+	assert.Equal(t, 0.0, entry.Bid.Price)
+	assert.Empty(t, entry.Bid.BURL, "house ads are never billed")
+	assert.Equal(t, 0, entry.Tier)
+}
+
+func TestEngine_CreateBidEntry_MarkupType(t *testing.T) {
+	engine := &Engine{trackingBaseURL: "https://ads.example.com/api/v1"}
+	strategy, _ := bidding.New(bidding.DefaultStrategy, nil)
+
+	campaign := &models.Campaign{ID: uuid.New(), BidAmount: 2.00}
+	creatives := []*models.AdCreative{
+		{ID: uuid.New(), Type: models.CreativeTypeBanner, Width: 300, Height: 250},
+		{ID: uuid.New(), Type: models.CreativeTypeVideo, Duration: 15, MIMEType: "video/mp4"},
+	}
+	request := &models.BidRequest{Imp: []models.Impression{
+		{ID: "1", Banner: &models.Banner{W: 300, H: 250}},
+		{ID: "2", Video: &models.Video{MIMEs: []string{"video/mp4"}}},
+	}}
+
+	banner := engine.createBidEntry(request, &request.Imp[0], campaign, strategy, creatives, nil)
+	assert.Equal(t, models.MarkupBanner, banner.Bid.MType)
+	assert.Equal(t, 0, banner.Bid.Dur)
+
+	video := engine.createBidEntry(request, &request.Imp[1], campaign, strategy, creatives, nil)
+	assert.Equal(t, models.MarkupVideo, video.Bid.MType)
+	assert.Equal(t, 15, video.Bid.Dur)
+}
+
+func TestSeparateWinners_MatchesExhaustiveSearch(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	keys := []string{"advertiser:a", "advertiser:b", "advertiser:c", "cat:IAB2", "cat:IAB3", "label:airline"}
+
+	for iteration := 0; iteration < 300; iteration++ {
+		slots := make([][]*slotCandidate, 1+rng.Intn(4))
+		for s := range slots {
+			slots[s] = make([]*slotCandidate, 1+rng.Intn(4))
+			for rank := range slots[s] {
+				candidate := &slotCandidate{auction: &impressionAuction{
+					Winner:     &BidEntry{Bid: &models.Bid{CID: uuid.New().String()}, Tier: rng.Intn(4)},
+					FinalPrice: float64(1 + rng.Intn(20)),
+				}}
+				for _, key := range keys {
+					if rng.Intn(3) == 0 {
+						candidate.keys = append(candidate.keys, key)
+					}
+				}
+				slots[s][rank] = candidate
+			}
+		}
+
+		options := make([][]int, len(slots))
+		for s := range slots {
+			options[s] = separationOptions(slots[s])
+		}
+
+		value := func(chosen []int) tierValue {
+			var v tierValue
+			for slot, rank := range chosen {
+				if rank >= 0 {
+					v = v.addPrice(slots[slot][rank].auction)
+				}
+			}
+			return v
+		}
+
+		var best tierValue
+		chosen := make([]int, len(slots))
+		var enumerate func(s int)
+		enumerate = func(s int) {
+			if s == len(slots) {
+				if consistentWinners(slots, options, chosen) && best.less(value(chosen)) {
+					best = value(chosen)
+				}
+				return
+			}
+			for rank := -1; rank < len(slots[s]); rank++ {
+				chosen[s] = rank
+				enumerate(s + 1)
+			}
+		}
+		enumerate(0)
+
+		result := separateWinners(slots)
+		assert.True(t, consistentWinners(slots, options, result))
+
+		top := make([]int, len(slots))
+		if consistentWinners(slots, nil, top) {
+			assert.Equal(t, top, result, "iteration %d", iteration)
+			continue
+		}
+
+		assert.Equal(t, best, value(result), "iteration %d", iteration)
+	}
+}
+
+func TestMatchesFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		imp      *models.Impression
 		campaign *models.Campaign
-		request  *models.BidRequest
-		expected float64
+		expected bool
 	}{
 		{
-			name: "Base bid only",
-			campaign: &models.Campaign{
-				BidAmount: 1.00,
-			},
-			request: &models.BidRequest{
-				Device: models.Device{
-					DeviceType: 2,
-				},
-			},
-			expected: 1.00,
+			name:     "No size targeting",
+			imp:      &models.Impression{Banner: &models.Banner{W: 728, H: 90}},
+			campaign: &models.Campaign{},
+			expected: true,
 		},
 		{
-			name: "Mobile device multiplier",
+			name: "Banner size match",
+			imp:  &models.Impression{Banner: &models.Banner{W: 300, H: 250}},
 			campaign: &models.Campaign{
-				BidAmount: 1.00,
+				TargetingRules: &models.TargetingRules{AdSizes: []string{"300x250"}},
 			},
-			request: &models.BidRequest{
-				Device: models.Device{
-					DeviceType: 1,
-				},
-			},
-			expected: 1.20,
+			expected: true,
 		},
 		{
-			name: "Site category multiplier",
+			name: "Banner format match",
+			imp: &models.Impression{Banner: &models.Banner{
+				Format: []models.Format{{W: 728, H: 90}, {W: 300, H: 250}},
+			}},
 			campaign: &models.Campaign{
-				BidAmount: 1.00,
+				TargetingRules: &models.TargetingRules{AdSizes: []string{"300x250"}},
 			},
-			request: &models.BidRequest{
-				Device: models.Device{
-					DeviceType: 2,
-				},
-				Site: &models.Site{
-					Cat: []string{"IAB1"},
-				},
-			},
-			expected: 1.10,
+			expected: true,
 		},
 		{
-			name: "Combined multipliers",
+			name: "Banner size mismatch",
+			imp:  &models.Impression{Banner: &models.Banner{W: 728, H: 90}},
 			campaign: &models.Campaign{
-				BidAmount: 1.00,
+				TargetingRules: &models.TargetingRules{AdSizes: []string{"300x250"}},
 			},
-			request: &models.BidRequest{
-				Device: models.Device{
-					DeviceType: 1,
-				},
-				Site: &models.Site{
-					Cat: []string{"IAB1"},
-				},
-			},
-			expected: 1.32,
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, matchesFormat(tt.imp, tt.campaign))
+		})
+	}
+}
+
+func TestEngine_ResolveAuctionType(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultType models.AuctionType
+		at          int
+		expected    models.AuctionType
+	}{
+		{"AT=1 selects first price", models.AuctionTypeSecondPrice, 1, models.AuctionTypeFirstPrice},
+		{"AT=2 selects second price", models.AuctionTypeFirstPrice, 2, models.AuctionTypeSecondPrice},
+		{"Missing AT uses configured default", models.AuctionTypeFirstPrice, 0, models.AuctionTypeFirstPrice},
+		{"Missing AT without default", "", 0, models.AuctionTypeSecondPrice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &Engine{auctionType: tt.defaultType}
+			assert.Equal(t, tt.expected, engine.resolveAuctionType(&models.BidRequest{AT: tt.at}))
+		})
+	}
+}
+
+func TestEngine_DetermineClearingPrice(t *testing.T) {
+	engine := &Engine{}
+
+	assert.Equal(t, 2.00, engine.determineClearingPrice(models.AuctionTypeFirstPrice, 2.00, 1.50, 1.00))
+	assert.Equal(t, 1.51, engine.determineClearingPrice(models.AuctionTypeSecondPrice, 2.00, 1.50, 1.00))
+}
+
+func TestEngine_CreateBidEntry_Deals(t *testing.T) {
+	engine := &Engine{}
+	strategy, _ := bidding.New(bidding.DefaultStrategy, nil)
+
+	dealCampaign := &models.Campaign{
+		ID:           uuid.New(),
+		AdvertiserID: "seat-1",
+		BidAmount:    3.00,
+		DealIDs:      []string{"deal-1"},
+	}
+	openCampaign := &models.Campaign{
+		ID:        uuid.New(),
+		BidAmount: 3.00,
+	}
+
+	tests := []struct {
+		name       string
+		pmp        *models.PMP
+		campaign   *models.Campaign
+		expectBid  bool
+		expectDeal string
+	}{
+		{
+			name:       "Linked deal wins deal ID",
+			pmp:        &models.PMP{Deals: []models.Deal{{ID: "deal-1", BidFloor: 2.00}}},
+			campaign:   dealCampaign,
+			expectBid:  true,
+			expectDeal: "deal-1",
+		},
+		{
+			name:      "Deal floor above bid falls back to open auction",
+			pmp:       &models.PMP{Deals: []models.Deal{{ID: "deal-1", BidFloor: 5.00}}},
+			campaign:  dealCampaign,
+			expectBid: true,
+		},
+		{
+			name: "Deal seat restriction",
+			pmp: &models.PMP{PrivateAuction: 1, Deals: []models.Deal{
+				{ID: "deal-1", WSeat: []string{"seat-2"}},
+			}},
+			campaign:  dealCampaign,
+			expectBid: false,
+		},
+		{
+			name:      "Private auction excludes open bids",
+			pmp:       &models.PMP{PrivateAuction: 1, Deals: []models.Deal{{ID: "deal-1"}}},
+			campaign:  openCampaign,
+			expectBid: false,
+		},
+	}
+
+	creatives := []*models.AdCreative{
+		{ID: uuid.New(), Type: models.CreativeTypeBanner, Width: 300, Height: 250},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &models.BidRequest{Imp: []models.Impression{{
+				ID:       "1",
+				Banner:   &models.Banner{W: 300, H: 250},
+				BidFloor: 1.00,
+				PMP:      tt.pmp,
+			}}}
+
+			entry := engine.createBidEntry(request, &request.Imp[0], tt.campaign, strategy, creatives, nil)
+			if !tt.expectBid {
+				assert.Nil(t, entry)
+				return
+			}
+
+			assert.NotNil(t, entry)
+			assert.Equal(t, tt.expectDeal, entry.Bid.DealID)
+		})
+	}
+}
+
+func TestEngine_CreateBidEntry_NoticeURLs(t *testing.T) {
+	engine := &Engine{trackingBaseURL: "https://ads.example.com/api/v1"}
+	strategy, _ := bidding.New(bidding.DefaultStrategy, nil)
+	campaign := &models.Campaign{ID: uuid.New(), BidAmount: 2.00}
+	creatives := []*models.AdCreative{
+		{ID: uuid.New(), Type: models.CreativeTypeBanner, Width: 300, Height: 250},
+	}
+	request := &models.BidRequest{Imp: []models.Impression{{ID: "1", Banner: &models.Banner{W: 300, H: 250}}}}
+
+	entry := engine.createBidEntry(request, &request.Imp[0], campaign, strategy, creatives, nil)
+	assert.NotNil(t, entry)
+
+	bid := entry.Bid
+	query := "bid_id=" + bid.ID + "&campaign_id=" + campaign.ID.String() + "&auction_id=${AUCTION_ID}"
+	assert.Equal(t, "https://ads.example.com/api/v1/track/win?"+query+"&price=${AUCTION_PRICE}", bid.NURL)
+	assert.Equal(t, "https://ads.example.com/api/v1/track/billing?"+query+"&price=${AUCTION_PRICE}", bid.BURL)
+	assert.Equal(t, "https://ads.example.com/api/v1/track/loss?"+query+"&reason=${AUCTION_LOSS}", bid.LURL)
+}
+
+func TestEngine_TestRequests(t *testing.T) {
+	engine := &Engine{trackingBaseURL: "https://ads.example.com/api/v1"}
+	strategy, _ := bidding.New(bidding.DefaultStrategy, nil)
+	campaign := &models.Campaign{ID: uuid.New(), BidAmount: 2.00}
+	creatives := []*models.AdCreative{
+		{ID: uuid.New(), Type: models.CreativeTypeBanner, Width: 300, Height: 250},
+	}
+	request := &models.BidRequest{Test: 1, Imp: []models.Impression{{ID: "1", Banner: &models.Banner{W: 300, H: 250}}}}
+
+	entry := engine.createBidEntry(request, &request.Imp[0], campaign, strategy, creatives, nil)
+	assert.NotNil(t, entry)
+	assert.True(t, strings.HasSuffix(entry.Bid.NURL, "&test=1"))
+	assert.True(t, strings.HasSuffix(entry.Bid.BURL, "&test=1"))
+	assert.True(t, strings.HasSuffix(entry.Bid.LURL, "&test=1"))
+	assert.Equal(t, "1", trackingParams(request, entry.Bid, campaign, creatives[0]).Get("test"))
+
+	assert.Equal(t, "test-bid-responses", eventTopic(request, "bid-responses"))
+	assert.Equal(t, "bid-responses", eventTopic(&models.BidRequest{}, "bid-responses"))
+}
+
+func TestTrace_RecordsOutcomes(t *testing.T) {
+	engine := &Engine{auctionType: models.AuctionTypeSecondPrice}
+	strategy, _ := bidding.New(bidding.DefaultStrategy, nil)
+	creatives := []*models.AdCreative{
+		{ID: uuid.New(), Type: models.CreativeTypeBanner, Width: 300, Height: 250},
+	}
+	high := &models.Campaign{ID: uuid.New(), Name: "high", BidAmount: 4.00}
+	low := &models.Campaign{ID: uuid.New(), Name: "low", BidAmount: 2.00}
+	cheap := &models.Campaign{ID: uuid.New(), Name: "cheap", BidAmount: 0.50}
+
+	request := &models.BidRequest{ID: "req-1", Test: 1, Imp: []models.Impression{
+		{ID: "1", Banner: &models.Banner{W: 300, H: 250}, BidFloor: 1.00},
+	}}
+	trace := newTrace(request, 3)
+
+	var entries []*BidEntry
+	for _, c := range []*models.Campaign{high, low, cheap} {
+		ct := trace.campaign(c)
+		if entry := engine.createBidEntry(request, &request.Imp[0], c, strategy, creatives, ct.impression("1")); entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	engine.runImpressionAuctions(request, entries)
+
+	assert.True(t, trace.Test)
+	assert.Len(t, trace.Campaigns, 3)
+	assert.Equal(t, TraceOutcomeWon, trace.Campaigns[0].Impressions[0].Outcome)
+	assert.Greater(t, trace.Campaigns[0].Impressions[0].ClearingPrice, 0.0)
+	assert.Equal(t, TraceOutcomeLost, trace.Campaigns[1].Impressions[0].Outcome)
+	assert.Equal(t, TraceOutcomeNoBid, trace.Campaigns[2].Impressions[0].Outcome)
+	assert.Contains(t, trace.Campaigns[2].Impressions[0].Reason, "below floor")
+
+	var untraced *Trace
+	assert.Nil(t, untraced.campaign(high))
+}
+
+func TestEngine_SelectWinner_DealPriority(t *testing.T) {
+	engine := &Engine{}
+
+	dealEntry := &BidEntry{Bid: &models.Bid{Price: 2.00}, Score: 2.00, Priority: 1, Deal: &models.Deal{ID: "deal-1"}}
+	bidEntries := []*BidEntry{
+		{Bid: &models.Bid{Price: 4.00}, Score: 4.00},
+		dealEntry,
+	}
+
+	winner, secondPrice := engine.selectWinner(bidEntries)
+
+	assert.Equal(t, dealEntry, winner)
+	assert.InDelta(t, 1.60, secondPrice, 0.001)
+}
+
+func TestEngine_CheckBlockLists(t *testing.T) {
+	engine := &Engine{}
+
+	campaign := &models.Campaign{
+		AdvertiserID:      "advertiser-1",
+		Seat:              "seat-1",
+		AdvertiserDomains: []string{"brand.com"},
+		Categories:        []string{"IAB2-3"},
+		AppBundle:         "com.brand.app",
+	}
+
+	tests := []struct {
+		name     string
+		request  *models.BidRequest
+		expected bool
+	}{
+		{"No block lists", &models.BidRequest{}, true},
+		{"Seat allowed", &models.BidRequest{WSeat: []string{"seat-1"}}, true},
+		{"Seat not in allow list", &models.BidRequest{WSeat: []string{"seat-2"}}, false},
+		{"Seat blocked", &models.BidRequest{BSeat: []string{"seat-1"}}, false},
+		{"Advertiser domain blocked", &models.BidRequest{BAdv: []string{"brand.com"}}, false},
+		{"Parent category blocked", &models.BidRequest{BCat: []string{"IAB2"}}, false},
+		{"Sibling category allowed", &models.BidRequest{BCat: []string{"IAB2-4"}}, true},
+		{"App bundle blocked", &models.BidRequest{BApp: []string{"com.brand.app"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, engine.checkBlockLists(tt.request, campaign))
+		})
+	}
+}
+
+func TestEngine_CreateBidResponse_GroupsBySeat(t *testing.T) {
+	engine := &Engine{}
+
+	seatA := &models.Campaign{Seat: "seat-a"}
+	seatB := &models.Campaign{AdvertiserID: "advertiser-b"}
+
+	auctions := []*impressionAuction{
+		{Winner: &BidEntry{Bid: &models.Bid{ImpID: "1", Price: 3.00}, Campaign: seatA}, FinalPrice: 2.00},
+		{Winner: &BidEntry{Bid: &models.Bid{ImpID: "2", Price: 3.00}, Campaign: seatB}, FinalPrice: 1.50},
+		{Winner: &BidEntry{Bid: &models.Bid{ImpID: "3", Price: 3.00}, Campaign: seatA}, FinalPrice: 1.00},
+	}
+
+	response := engine.createBidResponse(&models.BidRequest{ID: "req-1"}, auctions)
+
+	assert.Len(t, response.SeatBid, 2)
+	assert.Equal(t, "seat-a", response.SeatBid[0].Seat)
+	assert.Len(t, response.SeatBid[0].Bid, 2)
+	assert.Equal(t, 2.00, response.SeatBid[0].Bid[0].Price)
+	assert.Equal(t, "advertiser-b", response.SeatBid[1].Seat)
+}
+
+func TestSelectCreative(t *testing.T) {
+	leaderboard := &models.AdCreative{
+		ID: uuid.New(), Type: models.CreativeTypeBanner, Width: 728, Height: 90,
+		AssetURL: "https://cdn.example.com/728x90.png", ClickURL: "https://brand.com",
+	}
+	rectangle := &models.AdCreative{
+		ID: uuid.New(), Type: models.CreativeTypeBanner, Width: 300, Height: 250,
+		HTML: "<div>ad</div>",
+	}
+	responsive := &models.AdCreative{
+		ID: uuid.New(), Type: models.CreativeTypeBanner, Format: models.CreativeFormatResponsive,
+		AssetURL: "https://cdn.example.com/any.png",
+	}
+	video := &models.AdCreative{ID: uuid.New(), Type: models.CreativeTypeVideo}
+
+	tests := []struct {
+		name      string
+		imp       *models.Impression
+		creatives []*models.AdCreative
+		expected  *models.AdCreative
+		w, h      int
+	}{
+		{
+			name:      "Banner size match",
+			imp:       &models.Impression{Banner: &models.Banner{W: 300, H: 250}},
+			creatives: []*models.AdCreative{leaderboard, rectangle},
+			expected:  rectangle,
+			w:         300,
+			h:         250,
+		},
+		{
+			name: "Banner format list match",
+			imp: &models.Impression{Banner: &models.Banner{
+				Format: []models.Format{{W: 160, H: 600}, {W: 728, H: 90}},
+			}},
+			creatives: []*models.AdCreative{rectangle, leaderboard},
+			expected:  leaderboard,
+			w:         728,
+			h:         90,
+		},
+		{
+			name:      "Responsive creative takes the slot size",
+			imp:       &models.Impression{Banner: &models.Banner{W: 320, H: 50}},
+			creatives: []*models.AdCreative{rectangle, responsive},
+			expected:  responsive,
+			w:         320,
+			h:         50,
+		},
+		{
+			name:      "Banner creative cannot fill video slot",
+			imp:       &models.Impression{Video: &models.Video{W: 640, H: 480}},
+			creatives: []*models.AdCreative{rectangle},
+			expected:  nil,
+		},
+		{
+			name:      "Video creative fills video slot",
+			imp:       &models.Impression{Video: &models.Video{W: 640, H: 480}},
+			creatives: []*models.AdCreative{rectangle, video},
+			expected:  video,
+			w:         640,
+			h:         480,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			amount := engine.calculateBidAmount(tt.campaign, tt.request)
-			assert.InDelta(t, tt.expected, amount, 0.01)
+			match := selectCreative(tt.imp, tt.creatives)
+			if tt.expected == nil {
+				assert.Nil(t, match)
+				return
+			}
+
+			assert.NotNil(t, match)
+			assert.Equal(t, tt.expected.ID, match.Creative.ID)
+			assert.Equal(t, tt.w, match.W)
+			assert.Equal(t, tt.h, match.H)
 		})
 	}
-}
\ No newline at end of file
+
+	match := selectCreative(&models.Impression{Banner: &models.Banner{W: 728, H: 90}}, []*models.AdCreative{leaderboard})
+	assert.Contains(t, match.AdM, `src="https://cdn.example.com/728x90.png"`)
+	assert.Contains(t, match.AdM, `href="https://brand.com"`)
+}
+
+func TestMatchVideo(t *testing.T) {
+	creative := &models.AdCreative{
+		ID: uuid.New(), Type: models.CreativeTypeVideo, Duration: 30,
+		MIMEType: "video/mp4", AssetURL: "https://cdn.example.com/spot.mp4",
+		Skippable: true, SkipOffset: 5,
+	}
+
+	tests := []struct {
+		name       string
+		video      *models.Video
+		eligible   bool
+		version    string
+		skipOffset string
+	}{
+		{
+			name:       "VAST 4.2 preferred over 3.0",
+			video:      &models.Video{MIMEs: []string{"video/mp4"}, Protocols: []int{2, 3, 13}, Skip: 1, SkipAfter: 10},
+			eligible:   true,
+			version:    "4.2",
+			skipOffset: "00:00:10",
+		},
+		{
+			name:     "MIME type not supported",
+			video:    &models.Video{MIMEs: []string{"video/webm"}, Skip: 1},
+			eligible: false,
+		},
+		{
+			name:     "Too long for the slot",
+			video:    &models.Video{MaxDuration: 15, Skip: 1},
+			eligible: false,
+		},
+		{
+			name:     "Only VAST 2.0 supported",
+			video:    &models.Video{Protocols: []int{2, 5}, Skip: 1},
+			eligible: false,
+		},
+		{
+			name:     "Skippable creative in non-skippable player",
+			video:    &models.Video{},
+			eligible: false,
+		},
+		{
+			name:     "Shorter than skipmin plays unskippable",
+			video:    &models.Video{Skip: 1, SkipMin: 30},
+			eligible: true,
+			version:  "3.0",
+		},
+		{
+			name:     "Required duration",
+			video:    &models.Video{RqdDurs: []int{15, 30}, Skip: 1, SkipMin: 30},
+			eligible: true,
+			version:  "3.0",
+		},
+		{
+			name:     "Not a required duration",
+			video:    &models.Video{RqdDurs: []int{15, 60}, Skip: 1},
+			eligible: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := matchVideo(tt.video, creative)
+			if !tt.eligible {
+				assert.Nil(t, match)
+				return
+			}
+
+			assert.NotNil(t, match)
+			assert.Equal(t, tt.version, match.VASTVersion)
+			assert.Equal(t, tt.skipOffset, match.SkipOffset)
+		})
+	}
+}
+
+func TestBuildVAST(t *testing.T) {
+	engine := &Engine{trackingBaseURL: "https://ads.example.com/api/v1"}
+	campaign := &models.Campaign{ID: uuid.New()}
+	creative := &models.AdCreative{
+		ID: uuid.New(), Name: "Spot", Type: models.CreativeTypeVideo, Duration: 75,
+		MIMEType: "video/mp4", AssetURL: "https://cdn.example.com/spot.mp4", ClickURL: "https://brand.com",
+	}
+	bid := &models.Bid{ID: "bid-1"}
+
+	match := matchVideo(&models.Video{W: 640, H: 360, Protocols: []int{3, 7}}, creative)
+	assert.NotNil(t, match)
+
+	request := &models.BidRequest{Site: &models.Site{ID: "site-1"}, Device: models.Device{DeviceType: 2}}
+	adm, err := engine.buildVAST(request, bid, campaign, match)
+	assert.NoError(t, err)
+	assert.Contains(t, adm, `<VAST version="4.0">`)
+	assert.Contains(t, adm, `<Duration>00:01:15</Duration>`)
+	assert.Contains(t, adm, `<AdServingId>bid-1</AdServingId>`)
+	assert.Contains(t, adm, `type="video/mp4" width="640" height="360"`)
+	assert.Contains(t, adm, "https://ads.example.com/api/v1/track/impression?bid_id=bid-1&campaign_id="+campaign.ID.String())
+	for _, event := range []string{"start", "firstQuartile", "midpoint", "thirdQuartile", "complete"} {
+		assert.Contains(t, adm, `<Tracking event="`+event+`">`)
+	}
+	assert.Contains(t, adm, "event=video_midpoint")
+	assert.Contains(t, adm, "device_type=2&site_id=site-1")
+}
+
+func TestMatchNative(t *testing.T) {
+	creative := &models.AdCreative{
+		ID: uuid.New(), Type: models.CreativeTypeNative, ClickURL: "https://brand.com",
+		Native: &models.NativeCreative{
+			Title: "Holiday Sale", Body: "Up to 50% off everything", CTA: "Shop now",
+			Image: &models.NativeImage{URL: "https://cdn.example.com/main.jpg", W: 1200, H: 627},
+			Icon:  &models.NativeImage{URL: "https://cdn.example.com/icon.png", W: 80, H: 80},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		request  string
+		eligible bool
+		assets   int
+	}{
+		{
+			name:     "All required assets filled, optional sponsored skipped",
+			request:  `{"ver":"1.2","assets":[{"id":1,"required":1,"title":{"len":25}},{"id":2,"required":1,"img":{"type":3,"wmin":600,"hmin":300}},{"id":3,"img":{"type":1,"w":80,"h":80}},{"id":4,"data":{"type":1}}]}`,
+			eligible: true,
+			assets:   3,
+		},
+		{
+			name:     "Title too long",
+			request:  `{"assets":[{"id":1,"required":1,"title":{"len":5}}]}`,
+			eligible: false,
+		},
+		{
+			name:     "Main image too small",
+			request:  `{"assets":[{"id":1,"required":1,"img":{"type":3,"wmin":1600,"hmin":900}}]}`,
+			eligible: false,
+		},
+		{
+			name:     "Native 1.0 envelope",
+			request:  `{"native":{"assets":[{"id":1,"required":1,"data":{"type":12,"len":15}}]}}`,
+			eligible: true,
+			assets:   1,
+		},
+		{
+			name:     "Malformed request",
+			request:  `{"assets":`,
+			eligible: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := matchNative(&models.Native{Request: tt.request}, creative)
+			if !tt.eligible {
+				assert.Nil(t, match)
+				return
+			}
+
+			assert.NotNil(t, match)
+			assert.Len(t, match.NativeAssets, tt.assets)
+		})
+	}
+}
+
+func TestBuildNativeResponse(t *testing.T) {
+	engine := &Engine{trackingBaseURL: "https://ads.example.com/api/v1"}
+	campaign := &models.Campaign{ID: uuid.New()}
+	creative := &models.AdCreative{
+		ID: uuid.New(), Type: models.CreativeTypeNative, ClickURL: "https://brand.com",
+		Native: &models.NativeCreative{Title: "Holiday Sale"},
+	}
+	native := &models.Native{Request: `{"ver":"1.2","assets":[{"id":7,"required":1,"title":{"len":90}}],"eventtrackers":[{"event":1,"methods":[1,2]}]}`}
+
+	match := matchNative(native, creative)
+	assert.NotNil(t, match)
+
+	adm, err := engine.buildNativeResponse(&models.BidRequest{}, &models.Bid{ID: "bid-1"}, campaign, match)
+	assert.NoError(t, err)
+
+	var response models.NativeResponse
+	assert.NoError(t, json.Unmarshal([]byte(adm), &response))
+	assert.Equal(t, "1.2", response.Ver)
+	assert.Equal(t, 7, response.Assets[0].ID)
+	assert.Equal(t, "Holiday Sale", response.Assets[0].Title.Text)
+	assert.Equal(t, "https://brand.com", response.Link.URL)
+	assert.Len(t, response.EventTrackers, 1)
+	assert.Contains(t, response.EventTrackers[0].URL, "/track/impression?bid_id=bid-1")
+	assert.Empty(t, response.ImpTrackers)
+}
+
+// newTestEngine wires an engine to services backed by an in-memory database
+// and Redis, with Kafka publishing to a broker that isn't there.
+func newTestEngine(t testing.TB) (*Engine, *sqltest.DB, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	logger := logrus.New()
+	redisClient, err := redis.NewClient(server.Addr(), "", 0, logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { redisClient.Close() })
+
+	db, mock := sqltest.Open(t)
+	brokers := []string{"127.0.0.1:1"}
+	producer := kafka.NewProducer(brokers, logger)
+	campaignService := campaign.NewService(db, redisClient, producer, brokers, logger)
+
+	engine := NewEngine(campaignService, deal.NewService(db, logger), creative.NewService(db, logger),
+		inventory.NewService(db, logger), nil, redisClient, producer, brokers,
+		Config{TrackingBaseURL: "https://ads.example.com/api/v1"}, logger)
+	return engine, mock, server
+}
+
+func TestEngine_RunAuction_TracesAuctionsWithoutCandidates(t *testing.T) {
+	engine, mock, _ := newTestEngine(t)
+	mock.OnQuery("FROM campaigns", nil)
+
+	request := &models.BidRequest{ID: "req-1", Imp: []models.Impression{{ID: "1", Banner: &models.Banner{W: 300, H: 250}}}}
+	response, err := engine.RunAuction(WithTrace(context.Background()), request)
+	require.NoError(t, err)
+	assert.Equal(t, 2, response.NBR)
+
+	data, err := engine.redis.GetAuctionTrace("req-1")
+	require.NoError(t, err)
+	require.NotNil(t, data, "the auction is traced though no campaign could bid")
+
+	var trace Trace
+	require.NoError(t, json.Unmarshal(data, &trace))
+	assert.Equal(t, "req-1", trace.AuctionID)
+	assert.NotNil(t, trace.Campaigns)
+	assert.Empty(t, trace.Campaigns)
+}
+
+func TestEngine_RunAuction_ProfileLookup(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    *models.TargetingRules
+		expected bool
+	}{
+		{"No segment targeting", &models.TargetingRules{GeoTargeting: []string{"US"}}, false},
+		{"Segment rule", &models.TargetingRules{UserSegments: []string{"sports"}}, true},
+		{"Segment expression", &models.TargetingRules{Expression: `geo.country == "US" and segment("sports")`}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newIndexedEngine(t, []*models.Campaign{{ID: uuid.New(), BidAmount: 2, TargetingRules: tt.rules}})
+			ctx := context.Background()
+			require.NoError(t, engine.campaignService.SetUserSegments(ctx, "user-1", []string{"sports"}, time.Hour))
+
+			request := &models.BidRequest{
+				ID:     "req-1",
+				Imp:    []models.Impression{{ID: "1", Banner: &models.Banner{W: 300, H: 250}}},
+				Device: models.Device{Geo: &models.Geo{Country: "US"}},
+				User:   models.User{ID: "user-1"},
+			}
+			response, err := engine.RunAuction(ctx, request)
+			require.NoError(t, err)
+			assert.NotEmpty(t, response.SeatBid)
+
+			var profiled bool
+			for _, data := range request.User.Data {
+				profiled = profiled || data.ID == profileDataID
+			}
+			assert.Equal(t, tt.expected, profiled)
+		})
+	}
+}
+
+func TestEngine_AddProfileSegments_BoundedByContext(t *testing.T) {
+	engine, _, _ := newTestEngine(t)
+	require.NoError(t, engine.campaignService.SetUserSegments(context.Background(), "user-1", []string{"sports"}, time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	request := &models.BidRequest{User: models.User{ID: "user-1"}}
+	engine.addProfileSegments(ctx, request)
+	assert.Empty(t, request.User.Data, "an expired auction doesn't wait for the profile")
+
+	engine.addProfileSegments(context.Background(), request)
+	assert.Len(t, request.User.Data, 1)
+}
+
+func TestEngine_SettleBudgets_PodHoldsAllOrNone(t *testing.T) {
+	engine, _, server := newTestEngine(t)
+	ctx := context.Background()
+
+	won := func(campaign *models.Campaign, podID string, price float64) *impressionAuction {
+		return &impressionAuction{
+			Winner: &BidEntry{
+				Bid:      &models.Bid{ID: uuid.NewString(), CID: campaign.ID.String(), Price: price},
+				Campaign: campaign,
+				trace:    &ImpressionTrace{},
+			},
+			FinalPrice: price,
+			PodID:      podID,
+		}
+	}
+
+	banner := &models.Campaign{ID: uuid.New()}
+	first := &models.Campaign{ID: uuid.New()}
+	second := &models.Campaign{ID: uuid.New()}
+	house := &models.Campaign{ID: uuid.New(), Priority: models.PriorityHouse}
+	require.NoError(t, engine.redis.SetCampaignBudget(banner.ID.String(), 10, 100))
+	require.NoError(t, engine.redis.SetCampaignBudget(first.ID.String(), 10, 100))
+	require.NoError(t, engine.redis.SetCampaignBudget(second.ID.String(), 1, 100))
+
+	bannerAd := won(banner, "", 2)
+	pod := []*impressionAuction{won(first, "1", 2), won(house, "1", 0), won(second, "1", 3)}
+	auctions := append([]*impressionAuction{bannerAd}, pod...)
+
+	settled := engine.settleBudgets(ctx, &models.BidRequest{ID: "req-1"}, auctions)
+	assert.Equal(t, []*impressionAuction{bannerAd}, settled, "a pod with an ad over budget is dropped whole")
+
+	hold, err := engine.campaignService.BudgetHold(ctx, pod[0].Winner.Bid.ID)
+	require.NoError(t, err)
+	assert.Nil(t, hold, "the pod's placed holds are released")
+	daily, err := server.Get("campaign:budget:daily:" + first.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "10", daily)
+
+	for _, a := range pod {
+		assert.Equal(t, TraceOutcomeRejected, a.Winner.trace.Outcome)
+	}
+	assert.Equal(t, "budget hold failed for campaign "+second.ID.String()+" in pod 1", pod[0].Winner.trace.Reason)
+}
@@ -0,0 +1,67 @@
+package auction
+
+import (
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/targeting"
+)
+
+type compiledExpression struct {
+	program *targeting.Program
+	err     error
+}
+
+// matchesExpression evaluates the campaign's targeting expression in place
+// of its structured rules. Expressions are validated when a campaign is
+// saved, so one that fails to compile here is logged and never matches.
+func (e *Engine) matchesExpression(request *models.BidRequest, campaign *models.Campaign) bool {
+	rules := campaign.TargetingRules
+	program, err := e.compileExpression(rules.Expression)
+	if err != nil {
+		e.logger.WithError(err).WithField("campaign_id", campaign.ID).Warn("Invalid targeting expression")
+		return false
+	}
+
+	// hour and day follow the campaign's day-parting clock.
+	now, ok := campaignTime(rules, request, time.Now())
+	if !ok {
+		return false
+	}
+	return program.Eval(targetingEnv(request, now))
+}
+
+func (e *Engine) compileExpression(source string) (*targeting.Program, error) {
+	if cached, ok := e.expressions.Load(source); ok {
+		compiled := cached.(*compiledExpression)
+		return compiled.program, compiled.err
+	}
+
+	program, err := targeting.Compile(source)
+	e.expressions.Store(source, &compiledExpression{program: program, err: err})
+	return program, err
+}
+
+// targetingEnv collects the request attributes expressions can refer to.
+// Sizes and key-values are gathered across all impressions.
+func targetingEnv(request *models.BidRequest, now time.Time) *targeting.Env {
+	env := &targeting.Env{
+		Request:    request,
+		Geo:        requestGeo(request),
+		Segments:   requestSegments(request),
+		KeyValues:  make(map[string][]string),
+		Categories: requestCategories(request),
+		Keywords:   requestKeywords(request),
+		Now:        now,
+	}
+
+	if request.Site != nil {
+		addExtValues(env.KeyValues, request.Site.Ext)
+	}
+	for i := range request.Imp {
+		env.Sizes = append(env.Sizes, impressionSizes(&request.Imp[i])...)
+		addExtValues(env.KeyValues, request.Imp[i].Ext)
+	}
+
+	return env
+}
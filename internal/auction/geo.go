@@ -0,0 +1,120 @@
+package auction
+
+import (
+	"strings"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/targeting"
+)
+
+// requestGeo returns the device's location with any fields it lacks filled in
+// from the user's home location, or nil when the request has neither.
+func requestGeo(request *models.BidRequest) *models.Geo {
+	device, user := request.Device.Geo, request.User.Geo
+	if device == nil {
+		return user
+	}
+	if user == nil {
+		return device
+	}
+
+	geo := *device
+	fill := func(field *string, fallback string) {
+		if *field == "" {
+			*field = fallback
+		}
+	}
+	fill(&geo.Country, user.Country)
+	fill(&geo.Region, user.Region)
+	fill(&geo.Metro, user.Metro)
+	fill(&geo.City, user.City)
+	fill(&geo.ZIP, user.ZIP)
+	if !hasLocation(&geo) {
+		geo.Lat, geo.Lon = user.Lat, user.Lon
+	}
+	return &geo
+}
+
+// matchesGeo applies include and exclude rules. The request must match an
+// include rule when there are any, and must not match any exclude rule.
+// Requests whose location is unknown, or too incomplete to tell whether an
+// exclude rule applies, never match.
+func matchesGeo(rules []models.GeoRule, geo *models.Geo) bool {
+	if len(rules) == 0 {
+		return true
+	}
+	if geo == nil {
+		return false
+	}
+
+	included, hasIncludes := false, false
+	for _, rule := range rules {
+		matched, known := matchGeoRule(rule, geo)
+		if rule.Excludes() {
+			if matched || !known {
+				return false
+			}
+			continue
+		}
+
+		hasIncludes = true
+		if matched {
+			included = true
+		}
+	}
+
+	return included || !hasIncludes
+}
+
+// matchGeoRule reports whether geo satisfies every field the rule sets. known
+// is false when no field disagrees but at least one can't be checked because
+// the request doesn't carry it.
+func matchGeoRule(rule models.GeoRule, geo *models.Geo) (matched, known bool) {
+	known = true
+
+	check := func(want, have string) bool {
+		if want == "" {
+			return true
+		}
+		if have == "" {
+			known = false
+			return true
+		}
+		return strings.EqualFold(want, have)
+	}
+
+	if !check(rule.Country, geo.Country) || !check(rule.Region, geo.Region) ||
+		!check(rule.Metro, geo.Metro) || !check(rule.City, geo.City) || !check(rule.ZIP, geo.ZIP) {
+		return false, true
+	}
+
+	if rule.RadiusKM > 0 {
+		if !hasLocation(geo) {
+			known = false
+		} else if targeting.DistanceKM(rule.Lat, rule.Lon, geo.Lat, geo.Lon) > rule.RadiusKM {
+			return false, true
+		}
+	}
+
+	return known, known
+}
+
+func hasLocation(geo *models.Geo) bool {
+	return geo.Lat != 0 || geo.Lon != 0
+}
+
+// geoCountries returns the countries a campaign's geo rules confine it to, or
+// nil when an include rule doesn't name a country or there are no includes.
+func geoCountries(rules []models.GeoRule) []string {
+	var countries []string
+	for _, rule := range rules {
+		if rule.Excludes() {
+			continue
+		}
+		if rule.Country == "" {
+			return nil
+		}
+		countries = append(countries, strings.ToUpper(rule.Country))
+	}
+	return countries
+}
@@ -0,0 +1,77 @@
+package auction
+
+import (
+	"strconv"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+// requestKeyValues collects the top-level values in site.ext and imp.ext by
+// key. Arrays contribute each element; nested objects are ignored.
+func requestKeyValues(request *models.BidRequest, imp *models.Impression) map[string][]string {
+	values := make(map[string][]string)
+	if request.Site != nil {
+		addExtValues(values, request.Site.Ext)
+	}
+	addExtValues(values, imp.Ext)
+	return values
+}
+
+func addExtValues(values map[string][]string, ext interface{}) {
+	fields, ok := ext.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for key, raw := range fields {
+		if list, ok := raw.([]interface{}); ok {
+			for _, item := range list {
+				if value, ok := extValue(item); ok {
+					values[key] = append(values[key], value)
+				}
+			}
+			continue
+		}
+		if value, ok := extValue(raw); ok {
+			values[key] = append(values[key], value)
+		}
+	}
+}
+
+func extValue(raw interface{}) (string, bool) {
+	switch v := raw.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+func matchesKeyValues(rules *models.TargetingRules, values map[string][]string) bool {
+	for key, want := range rules.CustomTargeting {
+		if !contains(values[key], want) {
+			return false
+		}
+	}
+
+	kv := rules.KeyValues
+	if kv == nil || len(kv.Values) == 0 {
+		return true
+	}
+
+	matchAny := kv.Match == models.KeyValueMatchAny
+	for key, wanted := range kv.Values {
+		matched := containsAny(values[key], wanted)
+		if matchAny && matched {
+			return true
+		}
+		if !matchAny && !matched {
+			return false
+		}
+	}
+
+	return !matchAny
+}
@@ -0,0 +1,149 @@
+package auction
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+// matchNative parses the impression's native request and fills its assets
+// from the creative. The creative is only eligible when every required asset
+// can be filled; optional assets are included when they fit.
+func matchNative(native *models.Native, creative *models.AdCreative) *creativeMatch {
+	if creative.Native == nil {
+		return nil
+	}
+
+	request, err := native.ParseRequest()
+	if err != nil {
+		return nil
+	}
+
+	assets := make([]models.NativeResponseAsset, 0, len(request.Assets))
+	for _, asset := range request.Assets {
+		filled, ok := fillNativeAsset(asset, creative.Native)
+		if !ok {
+			if asset.Required == 1 {
+				return nil
+			}
+			continue
+		}
+		assets = append(assets, filled)
+	}
+
+	if len(assets) == 0 {
+		return nil
+	}
+
+	return &creativeMatch{Creative: creative, NativeRequest: request, NativeAssets: assets}
+}
+
+func fillNativeAsset(asset models.NativeRequestAsset, creative *models.NativeCreative) (models.NativeResponseAsset, bool) {
+	filled := models.NativeResponseAsset{ID: asset.ID, Required: asset.Required}
+
+	switch {
+	case asset.Title != nil:
+		if !fitsLength(creative.Title, asset.Title.Len) {
+			return filled, false
+		}
+		filled.Title = &models.NativeTitleResp{Text: creative.Title}
+	case asset.Img != nil:
+		image := creative.Image
+		if asset.Img.Type == models.NativeImageTypeIcon {
+			image = creative.Icon
+		}
+		if image == nil || !fitsImage(image, asset.Img) {
+			return filled, false
+		}
+		filled.Img = &models.NativeImageResp{Type: asset.Img.Type, URL: image.URL, W: image.W, H: image.H}
+	case asset.Data != nil:
+		var value string
+		switch asset.Data.Type {
+		case models.NativeDataTypeSponsored:
+			value = creative.Sponsored
+		case models.NativeDataTypeDesc:
+			value = creative.Body
+		case models.NativeDataTypeCTAText:
+			value = creative.CTA
+		}
+		if !fitsLength(value, asset.Data.Len) {
+			return filled, false
+		}
+		filled.Data = &models.NativeDataResp{Type: asset.Data.Type, Value: value}
+	default:
+		return filled, false
+	}
+
+	return filled, true
+}
+
+func fitsLength(value string, maxLen int) bool {
+	if value == "" {
+		return false
+	}
+	return maxLen <= 0 || utf8.RuneCountInString(value) <= maxLen
+}
+
+// fitsImage applies the Native 1.2 size rules: wmin/hmin are lower bounds,
+// otherwise w/h are exact sizes.
+func fitsImage(image *models.NativeImage, req *models.NativeImageReq) bool {
+	if req.WMin > 0 {
+		if image.W < req.WMin {
+			return false
+		}
+	} else if req.W > 0 && image.W != req.W {
+		return false
+	}
+
+	if req.HMin > 0 {
+		if image.H < req.HMin {
+			return false
+		}
+	} else if req.H > 0 && image.H != req.H {
+		return false
+	}
+
+	return true
+}
+
+func (e *Engine) buildNativeResponse(request *models.BidRequest, bid *models.Bid, campaign *models.Campaign, match *creativeMatch) (string, error) {
+	creative := match.Creative
+	params := trackingParams(request, bid, campaign, creative)
+
+	trackers := []string{e.trackingBaseURL + "/track/impression?" + params.Encode()}
+	if creative.ImpressionURL != "" {
+		trackers = append(trackers, creative.ImpressionURL)
+	}
+
+	response := models.NativeResponse{
+		Ver:    "1.2",
+		Assets: match.NativeAssets,
+		Link:   models.NativeLink{URL: creative.ClickURL},
+	}
+
+	if match.NativeRequest.SupportsEventTracker(models.NativeEventImpression, models.NativeMethodImage) {
+		for _, tracker := range trackers {
+			response.EventTrackers = append(response.EventTrackers, models.NativeEventTrackerResp{
+				Event:  models.NativeEventImpression,
+				Method: models.NativeMethodImage,
+				URL:    tracker,
+			})
+		}
+	} else {
+		response.ImpTrackers = trackers
+	}
+
+	var payload interface{} = response
+	if match.NativeRequest.Wrapped {
+		payload = map[string]interface{}{"native": response}
+	}
+
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal native response: %w", err)
+	}
+
+	return string(out), nil
+}
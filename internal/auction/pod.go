@@ -0,0 +1,395 @@
+package auction
+
+import (
+	"sort"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+// maxPodNodes bounds the pod search; past it the best fill found so far wins.
+const maxPodNodes = 50000
+
+// adPod is one ad break. A structured pod offers one impression per
+// position; a dynamic pod offers one impression that takes up to maxseq ads.
+type adPod struct {
+	ID      string
+	Slots   []*models.Impression
+	Dynamic bool
+	// MaxDuration is the pod's total length in seconds, 0 for no limit.
+	MaxDuration int
+}
+
+// requestPods finds the ad pods in a request. Video impressions with a
+// sequence or a podid form structured pods, grouped by podid; it takes two
+// or more to make a pod. A video impression with maxseq above one is a
+// dynamic pod on its own.
+func requestPods(request *models.BidRequest) []*adPod {
+	live := false
+	if content := request.RequestContent(); content != nil {
+		live = content.LiveStream == 1
+	}
+
+	var pods []*adPod
+	structured := make(map[string]*adPod)
+	for i := range request.Imp {
+		imp := &request.Imp[i]
+		if imp.Video == nil {
+			continue
+		}
+
+		video := imp.Video
+		if video.MaxSeq > 1 {
+			pod := &adPod{ID: video.PodID, Dynamic: true, MaxDuration: podDuration(video, live)}
+			if pod.ID == "" {
+				pod.ID = imp.ID
+			}
+			for n := 0; n < video.MaxSeq; n++ {
+				pod.Slots = append(pod.Slots, imp)
+			}
+			pods = append(pods, pod)
+			continue
+		}
+
+		if video.Sequence <= 0 && video.PodID == "" {
+			continue
+		}
+		pod, exists := structured[video.PodID]
+		if !exists {
+			pod = &adPod{ID: video.PodID}
+			structured[video.PodID] = pod
+			pods = append(pods, pod)
+		}
+		pod.Slots = append(pod.Slots, imp)
+		if limit := podDuration(video, live); limit > pod.MaxDuration {
+			pod.MaxDuration = limit
+		}
+	}
+
+	kept := pods[:0]
+	for _, pod := range pods {
+		if pod.Dynamic {
+			kept = append(kept, pod)
+			continue
+		}
+		if len(pod.Slots) < 2 {
+			continue
+		}
+		sort.SliceStable(pod.Slots, func(i, j int) bool {
+			return slotBefore(pod.Slots[i].Video, pod.Slots[j].Video)
+		})
+		if pod.ID == "" {
+			pod.ID = pod.Slots[0].ID
+		}
+		kept = append(kept, pod)
+	}
+
+	return kept
+}
+
+// slotBefore orders a structured pod's slots: the slotinpod first slot,
+// then the rest by sequence, then the slotinpod last slot.
+func slotBefore(a, b *models.Video) bool {
+	if slotRank(a) != slotRank(b) {
+		return slotRank(a) < slotRank(b)
+	}
+	return a.Sequence < b.Sequence
+}
+
+func slotRank(video *models.Video) int {
+	switch video.SlotInPod {
+	case models.SlotInPodFirst:
+		return 0
+	case models.SlotInPodLast:
+		return 2
+	}
+	return 1
+}
+
+// podDuration is the total length a pod's ads may run to. On-demand content
+// may run past poddur by video.maxextended (-1 for any length); a live
+// stream goes back to the broadcast on time, so its limit is strict.
+func podDuration(video *models.Video, live bool) int {
+	if video.PodDur <= 0 {
+		return 0
+	}
+	if live {
+		return video.PodDur
+	}
+	if video.MaxExtended < 0 {
+		return 0
+	}
+	return video.PodDur + video.MaxExtended
+}
+
+// tierValue sums an amount per priority tier: bid scores for pod fills,
+// clearing prices for competitive separation. Values compare tier by tier
+// from the top, so a higher-tier ad is never dropped for lower-tier revenue.
+type tierValue [4]float64
+
+func (v tierValue) add(entry *BidEntry) tierValue {
+	v[entry.Tier] += entry.Score
+	return v
+}
+
+func (v tierValue) addPrice(a *impressionAuction) tierValue {
+	v[a.Winner.Tier] += a.FinalPrice
+	return v
+}
+
+func (v tierValue) less(other tierValue) bool {
+	for tier := len(v) - 1; tier >= 0; tier-- {
+		if v[tier] != other[tier] {
+			return v[tier] < other[tier]
+		}
+	}
+	return false
+}
+
+func (v tierValue) plus(other tierValue) tierValue {
+	for tier := range v {
+		v[tier] += other[tier]
+	}
+	return v
+}
+
+// podSearch fills a pod's slots with at most one ad each, no two sharing an
+// advertiser, campaign or other separation key, within the pod's total
+// duration.
+type podSearch struct {
+	pod        *adPod
+	candidates [][]*BidEntry
+	keys       map[*BidEntry][]string
+	// bound[s] is the most value slots s and later could add.
+	bound []tierValue
+	used  map[string]int
+	nodes int
+
+	duration  int
+	current   []int
+	best      []int
+	bestValue tierValue
+	found     bool
+}
+
+// fillPod returns the entry chosen for each slot of the pod, nil where the
+// slot stays empty.
+func fillPod(pod *adPod, entriesByImp map[string][]*BidEntry) []*BidEntry {
+	search := &podSearch{
+		pod:        pod,
+		candidates: make([][]*BidEntry, len(pod.Slots)),
+		keys:       make(map[*BidEntry][]string),
+		bound:      make([]tierValue, len(pod.Slots)+1),
+		used:       make(map[string]int),
+		current:    make([]int, len(pod.Slots)),
+	}
+
+	for s, imp := range pod.Slots {
+		entries := entriesByImp[imp.ID]
+		rankEntries(entries)
+		search.candidates[s] = entries
+
+		var best tierValue
+		for _, entry := range entries {
+			if _, exists := search.keys[entry]; !exists {
+				search.keys[entry] = podKeys(entry)
+			}
+			best[entry.Tier] = maxFloat(best[entry.Tier], entry.Score)
+		}
+		search.bound[s] = best
+	}
+	for s := len(pod.Slots) - 1; s >= 0; s-- {
+		search.bound[s] = search.bound[s].plus(search.bound[s+1])
+	}
+
+	search.visit(0, -1, tierValue{})
+
+	chosen := make([]*BidEntry, len(pod.Slots))
+	for s, index := range search.best {
+		if index >= 0 {
+			chosen[s] = search.candidates[s][index]
+		}
+	}
+	return chosen
+}
+
+func podKeys(entry *BidEntry) []string {
+	keys := separationKeys(entry.Campaign)
+	if entry.Campaign != nil {
+		keys = append(keys, "campaign:"+entry.Campaign.ID.String())
+	}
+	return keys
+}
+
+// visit fills slot onward. Dynamic pod slots are interchangeable, so each
+// takes a lower-ranked candidate than the slot before it (after is the
+// previous slot's pick) and an empty slot leaves the rest empty.
+func (s *podSearch) visit(slot, after int, value tierValue) {
+	s.nodes++
+	if s.nodes > maxPodNodes && s.found {
+		return
+	}
+
+	if slot == len(s.pod.Slots) {
+		if !s.found || s.bestValue.less(value) {
+			s.best = append([]int(nil), s.current...)
+			s.bestValue = value
+			s.found = true
+		}
+		return
+	}
+	if s.found && !s.bestValue.less(value.plus(s.bound[slot])) {
+		return
+	}
+
+	start := 0
+	if s.pod.Dynamic {
+		start = after + 1
+	}
+	for index := start; index < len(s.candidates[slot]); index++ {
+		entry := s.candidates[slot][index]
+		if s.pod.MaxDuration > 0 && s.duration+entry.Duration > s.pod.MaxDuration {
+			continue
+		}
+		if s.clashes(s.keys[entry]) {
+			continue
+		}
+
+		s.current[slot] = index
+		s.duration += entry.Duration
+		for _, key := range s.keys[entry] {
+			s.used[key]++
+		}
+		s.visit(slot+1, index, value.add(entry))
+		for _, key := range s.keys[entry] {
+			s.used[key]--
+		}
+		s.duration -= entry.Duration
+	}
+
+	if s.pod.Dynamic {
+		for rest := slot; rest < len(s.pod.Slots); rest++ {
+			s.current[rest] = -1
+		}
+		s.visit(len(s.pod.Slots), after, value)
+		return
+	}
+	s.current[slot] = -1
+	s.visit(slot+1, after, value)
+}
+
+func (s *podSearch) clashes(keys []string) bool {
+	for _, key := range keys {
+		if s.used[key] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// creativesByDuration groups video creatives by length, in the order their
+// lengths first appear. Other creatives are left out.
+func creativesByDuration(creatives []*models.AdCreative) [][]*models.AdCreative {
+	var groups [][]*models.AdCreative
+	index := make(map[int]int)
+	for _, creative := range creatives {
+		if creative.Type != models.CreativeTypeVideo {
+			continue
+		}
+		i, exists := index[creative.Duration]
+		if !exists {
+			i = len(groups)
+			index[creative.Duration] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], creative)
+	}
+	return groups
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// runPodAuction fills a pod and prices each ad in it. An ad's second price
+// is the best bid in its tier, up to its own, that the pod left out.
+func (e *Engine) runPodAuction(request *models.BidRequest, pod *adPod, entriesByImp map[string][]*BidEntry, auctionType models.AuctionType) []*impressionAuction {
+	chosen := fillPod(pod, entriesByImp)
+
+	selected := make(map[*BidEntry]bool)
+	for _, entry := range chosen {
+		if entry != nil {
+			selected[entry] = true
+		}
+	}
+
+	var unselected []*BidEntry
+	totalBids := 0
+	seen := make(map[string]bool)
+	for _, imp := range pod.Slots {
+		if seen[imp.ID] {
+			continue
+		}
+		seen[imp.ID] = true
+
+		for _, entry := range entriesByImp[imp.ID] {
+			totalBids++
+			if !selected[entry] {
+				unselected = append(unselected, entry)
+				entry.trace.settle(TraceOutcomeLost, "not selected for pod %s", pod.ID)
+			}
+		}
+	}
+
+	var auctions []*impressionAuction
+	for s, winner := range chosen {
+		if winner == nil {
+			continue
+		}
+
+		secondPrice, found := 0.0, false
+		for _, entry := range unselected {
+			if entry.Tier == winner.Tier && entry.Bid.Price <= winner.Bid.Price && entry.Bid.Price >= secondPrice {
+				secondPrice, found = entry.Bid.Price, true
+			}
+		}
+		if !found {
+			secondPrice = winner.Bid.Price * 0.8
+		}
+
+		sequence := s + 1
+		if !pod.Dynamic && pod.Slots[s].Video.Sequence > 0 {
+			sequence = pod.Slots[s].Video.Sequence
+		}
+		e.setPodSequence(request, winner, sequence)
+
+		a := e.clearAuction(pod.Slots[s], winner, secondPrice, totalBids, auctionType)
+		a.PodID = pod.ID
+		winner.trace.settle(TraceOutcomeWon, "%s auction, pod %s position %d", a.AuctionType, pod.ID, sequence)
+		if winner.trace != nil {
+			winner.trace.ClearingPrice = a.FinalPrice
+		}
+		auctions = append(auctions, a)
+	}
+
+	return auctions
+}
+
+// setPodSequence marks a pod bid with its position, in bid.ext and in the
+// sequence attribute of its VAST Ad.
+func (e *Engine) setPodSequence(request *models.BidRequest, entry *BidEntry, sequence int) {
+	entry.Bid.Ext = &models.BidExt{Sequence: sequence}
+
+	if entry.match == nil || entry.match.VASTVersion == "" {
+		return
+	}
+	entry.match.Sequence = sequence
+	adm, err := e.buildVAST(request, entry.Bid, entry.Campaign, entry.match)
+	if err != nil {
+		e.logger.WithError(err).WithField("campaign_id", entry.Campaign.ID).Error("Failed to build VAST")
+		return
+	}
+	entry.Bid.AdM = adm
+}
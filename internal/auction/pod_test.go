@@ -0,0 +1,187 @@
+package auction
+
+import (
+	"testing"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestPods(t *testing.T) {
+	request := &models.BidRequest{
+		Site: &models.Site{Content: &models.Content{LiveStream: 0}},
+		Imp: []models.Impression{
+			{ID: "a2", Video: &models.Video{Sequence: 2, MaxDuration: 30, PodID: "break-1", PodDur: 60}},
+			{ID: "a1", Video: &models.Video{Sequence: 1, MaxDuration: 30, PodID: "break-1", PodDur: 60}},
+			{ID: "lone", Video: &models.Video{Sequence: 1, PodID: "break-2", PodDur: 30}},
+			{ID: "dyn", Video: &models.Video{MaxDuration: 30, MaxExtended: 10, PodDur: 90, MaxSeq: 4}},
+			{ID: "last", Video: &models.Video{PodID: "break-3", SlotInPod: models.SlotInPodLast}},
+			{ID: "middle", Video: &models.Video{PodID: "break-3"}},
+			{ID: "first", Video: &models.Video{PodID: "break-3", SlotInPod: models.SlotInPodFirst}},
+			{ID: "banner", Banner: &models.Banner{W: 300, H: 250}},
+		},
+	}
+
+	pods := requestPods(request)
+	assert.Len(t, pods, 3)
+
+	assert.Equal(t, "break-1", pods[0].ID)
+	assert.False(t, pods[0].Dynamic)
+	assert.Equal(t, "a1", pods[0].Slots[0].ID, "slots follow video.sequence")
+	assert.Equal(t, "a2", pods[0].Slots[1].ID)
+	assert.Equal(t, 60, pods[0].MaxDuration)
+
+	assert.Equal(t, "dyn", pods[1].ID)
+	assert.True(t, pods[1].Dynamic)
+	assert.Len(t, pods[1].Slots, 4)
+	assert.Equal(t, 100, pods[1].MaxDuration, "on-demand pods may run into maxextended")
+
+	assert.Equal(t, "break-3", pods[2].ID)
+	assert.Equal(t, "first", pods[2].Slots[0].ID, "slots follow video.slotinpod")
+	assert.Equal(t, "middle", pods[2].Slots[1].ID)
+	assert.Equal(t, "last", pods[2].Slots[2].ID)
+
+	request.Site.Content.LiveStream = 1
+	pods = requestPods(request)
+	assert.Equal(t, 90, pods[1].MaxDuration, "live pods end on time")
+}
+
+func podEntry(impID string, campaign *models.Campaign, duration int, price float64) *BidEntry {
+	return &BidEntry{
+		Bid:      &models.Bid{ID: uuid.New().String(), ImpID: impID, CID: campaign.ID.String(), Price: price},
+		Campaign: campaign,
+		Tier:     campaign.Priority.Tier(),
+		Score:    price,
+		Duration: duration,
+	}
+}
+
+func TestFillPod_Dynamic(t *testing.T) {
+	a := &models.Campaign{ID: uuid.New(), AdvertiserID: "a"}
+	b := &models.Campaign{ID: uuid.New(), AdvertiserID: "b"}
+	c := &models.Campaign{ID: uuid.New(), AdvertiserID: "c"}
+	d := &models.Campaign{ID: uuid.New(), AdvertiserID: "d"}
+
+	imp := &models.Impression{ID: "1"}
+	pod := &adPod{ID: "1", Slots: []*models.Impression{imp, imp, imp}, Dynamic: true, MaxDuration: 60}
+	a30, a15 := podEntry("1", a, 30, 10), podEntry("1", a, 15, 9)
+	b30, c15, d15 := podEntry("1", b, 30, 8), podEntry("1", c, 15, 7), podEntry("1", d, 15, 6)
+
+	chosen := fillPod(pod, map[string][]*BidEntry{"1": {a30, a15, b30, c15, d15}})
+
+	assert.Equal(t, []*BidEntry{a15, b30, c15}, chosen, "the best mix, not the best bids, fills the pod")
+}
+
+func TestFillPod_StructuredTiers(t *testing.T) {
+	sponsor := &models.Campaign{ID: uuid.New(), AdvertiserID: "s", Priority: models.PrioritySponsorship}
+	open := &models.Campaign{ID: uuid.New(), AdvertiserID: "o"}
+	other := &models.Campaign{ID: uuid.New(), AdvertiserID: "x"}
+
+	slot1, slot2 := &models.Impression{ID: "1"}, &models.Impression{ID: "2"}
+	pod := &adPod{ID: "break", Slots: []*models.Impression{slot1, slot2}, MaxDuration: 45}
+
+	sponsorAd := podEntry("2", sponsor, 30, 1)
+	openLong1, openLong2 := podEntry("1", open, 30, 20), podEntry("2", open, 30, 20)
+	otherShort := podEntry("1", other, 15, 2)
+
+	chosen := fillPod(pod, map[string][]*BidEntry{
+		"1": {openLong1, otherShort},
+		"2": {openLong2, sponsorAd},
+	})
+
+	assert.Equal(t, []*BidEntry{otherShort, sponsorAd}, chosen, "the sponsorship ad stays in whatever it costs the pod")
+}
+
+func TestEngine_RunImpressionAuctions_Pod(t *testing.T) {
+	engine := &Engine{}
+
+	a := &models.Campaign{ID: uuid.New(), AdvertiserID: "a", Seat: "seat-1"}
+	b := &models.Campaign{ID: uuid.New(), AdvertiserID: "b", Seat: "seat-1"}
+	c := &models.Campaign{ID: uuid.New(), AdvertiserID: "c", Seat: "seat-1"}
+	request := &models.BidRequest{
+		ID: "req-1",
+		Imp: []models.Impression{
+			{ID: "1", Video: &models.Video{PodDur: 60, MaxSeq: 3}},
+			{ID: "2", Banner: &models.Banner{W: 300, H: 250}},
+		},
+	}
+
+	auctions := engine.runImpressionAuctions(request, []*BidEntry{
+		podEntry("1", a, 30, 5.00), podEntry("1", a, 15, 4.00), podEntry("1", b, 30, 3.00),
+		podEntry("2", c, 0, 1.00),
+	})
+
+	assert.Len(t, auctions, 3)
+	response := engine.createBidResponse(request, auctions)
+
+	assert.Len(t, response.SeatBid, 2)
+	banner, pod := response.SeatBid[0], response.SeatBid[1]
+	assert.Equal(t, 0, banner.Group)
+	assert.Equal(t, 1, pod.Group)
+	assert.Equal(t, "seat-1", pod.Seat)
+	assert.Len(t, pod.Bid, 2)
+	for i, bid := range pod.Bid {
+		assert.Equal(t, "1", bid.ImpID)
+		assert.Equal(t, &models.BidExt{Sequence: i + 1}, bid.Ext)
+	}
+	assert.Equal(t, a.ID.String(), pod.Bid[0].CID)
+	assert.InDelta(t, 4.01, pod.Bid[0].Price, 0.001, "priced against the best ad the pod left out")
+}
+
+func TestEngine_RunImpressionAuctions_PodSeparation(t *testing.T) {
+	engine := &Engine{}
+
+	a := &models.Campaign{ID: uuid.New(), AdvertiserID: "a"}
+	b := &models.Campaign{ID: uuid.New(), AdvertiserID: "b"}
+	c := &models.Campaign{ID: uuid.New(), AdvertiserID: "c"}
+	sponsorship := &models.Campaign{ID: uuid.New(), AdvertiserID: "b", Priority: models.PrioritySponsorship}
+	request := &models.BidRequest{
+		AT: 1,
+		Imp: []models.Impression{
+			{ID: "1", Video: &models.Video{PodDur: 60, MaxSeq: 2}},
+			{ID: "2", Banner: &models.Banner{W: 300, H: 250}},
+		},
+	}
+	won := func(auctions []*impressionAuction) []*models.Campaign {
+		var campaigns []*models.Campaign
+		for _, a := range auctions {
+			campaigns = append(campaigns, a.Winner.Campaign)
+		}
+		return campaigns
+	}
+
+	t.Run("Other slots keep clear of pod ads", func(t *testing.T) {
+		auctions := engine.runImpressionAuctions(request, []*BidEntry{
+			podEntry("1", a, 30, 5.00), podEntry("1", b, 30, 4.00),
+			podEntry("2", a, 0, 2.00), podEntry("2", c, 0, 1.00),
+		})
+
+		assert.Equal(t, []*models.Campaign{c, a, b}, won(auctions))
+	})
+
+	t.Run("Pod ad loses to a higher tier", func(t *testing.T) {
+		auctions := engine.runImpressionAuctions(request, []*BidEntry{
+			podEntry("1", a, 30, 5.00), podEntry("1", b, 30, 4.00),
+			podEntry("2", sponsorship, 0, 1.00),
+		})
+
+		assert.Equal(t, []*models.Campaign{sponsorship, a}, won(auctions), "the pod's second position is left empty")
+	})
+}
+
+func TestBuildVAST_PodSequence(t *testing.T) {
+	engine := &Engine{trackingBaseURL: "https://ads.example.com/api/v1"}
+	campaign := &models.Campaign{ID: uuid.New()}
+	creative := &models.AdCreative{ID: uuid.New(), Type: models.CreativeTypeVideo, Duration: 15, MIMEType: "video/mp4"}
+
+	entry := &BidEntry{
+		Bid:      &models.Bid{ID: "bid-1"},
+		Campaign: campaign,
+		match:    matchVideo(&models.Video{}, creative),
+	}
+	engine.setPodSequence(&models.BidRequest{}, entry, 2)
+
+	assert.Contains(t, entry.Bid.AdM, `<Ad id="bid-1" sequence="2">`)
+	assert.Equal(t, &models.BidExt{Sequence: 2}, entry.Bid.Ext)
+}
@@ -0,0 +1,236 @@
+package auction
+
+import (
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+const (
+	// maxSeparationOptions caps how many bids per impression the competitive
+	// separation search considers.
+	maxSeparationOptions = 16
+	// maxSeparationNodes bounds the search; past it the best assignment
+	// found so far wins.
+	maxSeparationNodes = 50000
+)
+
+// slotCandidate is a bid for one impression, priced as if it won.
+type slotCandidate struct {
+	auction *impressionAuction
+	keys    []string
+}
+
+// separationKeys returns what keeps a campaign's bids out of the other
+// slots of a request another bid with the same key won: its advertiser, each
+// of its IAB categories and each of its competitive labels.
+func separationKeys(campaign *models.Campaign) []string {
+	if campaign == nil {
+		return nil
+	}
+
+	var keys []string
+	if campaign.AdvertiserID != "" {
+		keys = append(keys, "advertiser:"+campaign.AdvertiserID)
+	}
+	for _, category := range campaign.Categories {
+		keys = append(keys, "cat:"+category)
+	}
+	for _, label := range campaign.CompetitiveLabels {
+		keys = append(keys, "label:"+label)
+	}
+	return keys
+}
+
+func sharesKey(a, b []string) bool {
+	for _, key := range a {
+		if contains(b, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func subsetOf(a, b []string) bool {
+	for _, key := range a {
+		if !contains(b, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// separateWinners picks the winning rank for each slot, or -1 for none, so
+// that no two winners share a separation key. Every slot still goes to its
+// best-ranked bid that doesn't clash with another slot's winner; among the
+// assignments where that holds, the one with the most revenue in the highest
+// tier wins, then in the next tier down. A sponsorship bid is never given up
+// for price-priority revenue, and house ads, priced at 0, never keep a paid
+// bid out. When the top bids don't clash, they all win.
+func separateWinners(slots [][]*slotCandidate) []int {
+	chosen := make([]int, len(slots))
+	if consistentWinners(slots, nil, chosen) {
+		return chosen
+	}
+
+	search := &separationSearch{
+		slots:   slots,
+		options: make([][]int, len(slots)),
+		bound:   make([]tierValue, len(slots)+1),
+		used:    make(map[string]int),
+		current: make([]int, len(slots)),
+		best:    chosen,
+	}
+	for s := len(slots) - 1; s >= 0; s-- {
+		search.options[s] = separationOptions(slots[s])
+
+		var best tierValue
+		for _, rank := range search.options[s] {
+			a := slots[s][rank].auction
+			best[a.Winner.Tier] = maxFloat(best[a.Winner.Tier], a.FinalPrice)
+		}
+		search.bound[s] = best.plus(search.bound[s+1])
+	}
+
+	search.visit(0, tierValue{})
+
+	return search.best
+}
+
+// separationOptions returns the ranks worth trying for a slot. A bid whose
+// keys include all of a better-ranked bid's keys can never win: whatever
+// rules out the better bid rules it out too. Bids past the first
+// maxSeparationOptions options are not considered.
+func separationOptions(candidates []*slotCandidate) []int {
+	var options []int
+	for rank, candidate := range candidates {
+		dominated := false
+		for _, kept := range options {
+			if subsetOf(candidates[kept].keys, candidate.keys) {
+				dominated = true
+				break
+			}
+		}
+		if dominated {
+			continue
+		}
+
+		options = append(options, rank)
+		if len(options) == maxSeparationOptions {
+			break
+		}
+	}
+	return options
+}
+
+// consistentWinners reports whether chosen keeps winners apart and gives
+// each slot its best-ranked option that no other slot's winner rules out.
+// With nil options only the winners are checked.
+func consistentWinners(slots [][]*slotCandidate, options [][]int, chosen []int) bool {
+	for s, candidates := range slots {
+		if chosen[s] >= 0 && separatedBy(candidates[chosen[s]], s, slots, chosen) != "" {
+			return false
+		}
+		if options == nil {
+			continue
+		}
+
+		for _, rank := range options[s] {
+			if chosen[s] >= 0 && rank >= chosen[s] {
+				break
+			}
+			if separatedBy(candidates[rank], s, slots, chosen) == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// separatedBy returns the campaign ID of a winner in another slot that shares
+// a separation key with candidate, or "" when there is none.
+func separatedBy(candidate *slotCandidate, slot int, slots [][]*slotCandidate, chosen []int) string {
+	if len(candidate.keys) == 0 {
+		return ""
+	}
+	for s, rank := range chosen {
+		if s == slot || rank < 0 {
+			continue
+		}
+		if winner := slots[s][rank]; sharesKey(candidate.keys, winner.keys) {
+			return winner.auction.Winner.Bid.CID
+		}
+	}
+	return ""
+}
+
+// settleSeparated traces a bid that lost its slot to competitive separation.
+func settleSeparated(candidate *slotCandidate, slot int, slots [][]*slotCandidate, chosen []int) {
+	if by := separatedBy(candidate, slot, slots, chosen); by != "" {
+		candidate.auction.Winner.trace.settle(TraceOutcomeLost, "competitive separation with campaign %s", by)
+		return
+	}
+	candidate.auction.Winner.trace.settle(TraceOutcomeLost, "past the competitive separation search limit")
+}
+
+// separationSearch is a branch and bound search over one rank per slot.
+// Ranks that clash with an earlier slot's winner are skipped as it goes; the
+// rest of consistentWinners is checked on complete assignments.
+type separationSearch struct {
+	slots   [][]*slotCandidate
+	options [][]int
+	// bound[s] is the most revenue slots s and later could add per tier.
+	bound []tierValue
+	used  map[string]int
+	nodes int
+
+	current   []int
+	best      []int
+	bestValue tierValue
+	found     bool
+}
+
+func (s *separationSearch) visit(slot int, value tierValue) {
+	s.nodes++
+	if s.nodes > maxSeparationNodes && s.found {
+		return
+	}
+
+	if slot == len(s.slots) {
+		if (!s.found || s.bestValue.less(value)) && consistentWinners(s.slots, s.options, s.current) {
+			s.best = append([]int(nil), s.current...)
+			s.bestValue = value
+			s.found = true
+		}
+		return
+	}
+	if s.found && !s.bestValue.less(value.plus(s.bound[slot])) {
+		return
+	}
+
+	for _, rank := range s.options[slot] {
+		candidate := s.slots[slot][rank]
+		if s.clashes(candidate.keys) {
+			continue
+		}
+
+		s.current[slot] = rank
+		for _, key := range candidate.keys {
+			s.used[key]++
+		}
+		s.visit(slot+1, value.addPrice(candidate.auction))
+		for _, key := range candidate.keys {
+			s.used[key]--
+		}
+	}
+
+	s.current[slot] = -1
+	s.visit(slot+1, value)
+}
+
+func (s *separationSearch) clashes(keys []string) bool {
+	for _, key := range keys {
+		if s.used[key] > 0 {
+			return true
+		}
+	}
+	return false
+}
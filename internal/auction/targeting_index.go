@@ -0,0 +1,301 @@
+package auction
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/targeting"
+	"github.com/google/uuid"
+)
+
+// bitset holds one bit per campaign ordinal in a targetingIndex.
+type bitset []uint64
+
+func newBitset(size int) bitset {
+	return make(bitset, (size+63)/64)
+}
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << (uint(i) % 64)
+}
+
+func (b bitset) or(other bitset) {
+	for i := range b {
+		b[i] |= other[i]
+	}
+}
+
+func (b bitset) and(other bitset) {
+	for i := range b {
+		b[i] &= other[i]
+	}
+}
+
+func (b bitset) count() int {
+	n := 0
+	for _, word := range b {
+		n += bits.OnesCount64(word)
+	}
+	return n
+}
+
+// dimension is an inverted index over one targeting attribute. Campaigns that
+// don't restrict the attribute are in unrestricted and match every request.
+type dimension struct {
+	unrestricted bitset
+	byValue      map[string]bitset
+}
+
+func newDimension(size int) *dimension {
+	return &dimension{unrestricted: newBitset(size), byValue: make(map[string]bitset)}
+}
+
+func (d *dimension) add(ordinal, size int, values []string) {
+	if len(values) == 0 {
+		d.unrestricted.set(ordinal)
+		return
+	}
+
+	for _, value := range values {
+		set, exists := d.byValue[value]
+		if !exists {
+			set = newBitset(size)
+			d.byValue[value] = set
+		}
+		set.set(ordinal)
+	}
+}
+
+// match returns the campaigns that accept any of values.
+func (d *dimension) match(values []string) bitset {
+	result := append(bitset(nil), d.unrestricted...)
+	for _, value := range values {
+		if set, exists := d.byValue[value]; exists {
+			result.or(set)
+		}
+	}
+	return result
+}
+
+// dayPartClock is the clock a group of campaigns' day parts are evaluated on:
+// a timezone, or the user's local time falling back to that timezone.
+type dayPartClock struct {
+	location *time.Location
+	userTime bool
+}
+
+// targetingIndex pre-filters campaigns by country, device type, day-part, user
+// segment and ad size so an auction only evaluates campaigns that can match.
+// Day parts are indexed by hour of the week on each campaign's clock, so a
+// request looks up one hour per distinct clock.
+// It mirrors checkTargeting and matchesFormat and never rejects a campaign
+// they would accept; rules it can't index, such as geo excludes, radius
+// targeting and targeting expressions, are left for checkTargeting.
+// segmentTargeted reports whether any campaign targets user segments, by
+// rule or expression, so auctions know whether the user's profile matters.
+type targetingIndex struct {
+	version         uint64
+	ids             []uuid.UUID
+	geo             *dimension
+	device          *dimension
+	segment         *dimension
+	adSize          *dimension
+	alwaysOn        bitset
+	dayParts        map[dayPartClock]*[models.HoursPerWeek]bitset
+	segmentTargeted bool
+}
+
+func buildTargetingIndex(campaigns []*models.Campaign, version uint64) *targetingIndex {
+	size := len(campaigns)
+	idx := &targetingIndex{
+		version:  version,
+		ids:      make([]uuid.UUID, size),
+		geo:      newDimension(size),
+		device:   newDimension(size),
+		segment:  newDimension(size),
+		adSize:   newDimension(size),
+		alwaysOn: newBitset(size),
+		dayParts: make(map[dayPartClock]*[models.HoursPerWeek]bitset),
+	}
+
+	for ordinal, campaign := range campaigns {
+		idx.ids[ordinal] = campaign.ID
+
+		rules := campaign.TargetingRules
+		if rules == nil {
+			rules = &models.TargetingRules{}
+		}
+
+		idx.adSize.add(ordinal, size, rules.AdSizes)
+
+		// An expression replaces the other rules, so the campaign is only
+		// narrowed by ad size.
+		if rules.Expression != "" {
+			if program, err := targeting.Compile(rules.Expression); err == nil && program.UsesSegments() {
+				idx.segmentTargeted = true
+			}
+			rules = &models.TargetingRules{}
+		}
+		if len(rules.UserSegments) > 0 {
+			idx.segmentTargeted = true
+		}
+
+		idx.geo.add(ordinal, size, geoCountries(rules.GeoRules()))
+		idx.device.add(ordinal, size, rules.DeviceTypes)
+		idx.segment.add(ordinal, size, rules.UserSegments)
+
+		if len(rules.DayParting) == 0 {
+			idx.alwaysOn.set(ordinal)
+			continue
+		}
+		idx.addDayParts(ordinal, size, rules)
+	}
+
+	return idx
+}
+
+// addDayParts sets the campaign in every hour of the week its rules cover.
+// Campaigns whose timezone doesn't load are left out, as checkTargeting
+// rejects them.
+func (idx *targetingIndex) addDayParts(ordinal, size int, rules *models.TargetingRules) {
+	location, err := rules.DayPartLocation()
+	if err != nil {
+		return
+	}
+
+	clock := dayPartClock{location: location, userTime: rules.DayPartUserTime}
+	slots, exists := idx.dayParts[clock]
+	if !exists {
+		slots = new([models.HoursPerWeek]bitset)
+		for slot := range slots {
+			slots[slot] = newBitset(size)
+		}
+		idx.dayParts[clock] = slots
+	}
+
+	for _, rule := range rules.DayParting {
+		start := rule.DayOfWeek*24 + rule.StartHour
+		for hour := 0; hour < rule.Span() && hour < models.HoursPerWeek; hour++ {
+			slot := (start + hour) % models.HoursPerWeek
+			if slot < 0 {
+				slot += models.HoursPerWeek
+			}
+			slots[slot].set(ordinal)
+		}
+	}
+}
+
+func (idx *targetingIndex) match(request *models.BidRequest, now time.Time) bitset {
+	result := append(bitset(nil), idx.alwaysOn...)
+	for clock, slots := range idx.dayParts {
+		local := dayPartTime(clock.location, clock.userTime, request, now)
+		result.or(slots[int(local.Weekday())*24+local.Hour()])
+	}
+
+	var country string
+	if geo := requestGeo(request); geo != nil {
+		country = strings.ToUpper(geo.Country)
+	}
+	result.and(idx.geo.match([]string{country}))
+
+	result.and(idx.device.match([]string{fmt.Sprintf("%d", request.Device.DeviceType)}))
+	result.and(idx.segment.match(requestSegments(request)))
+
+	var sizes []string
+	for i := range request.Imp {
+		sizes = append(sizes, impressionSizes(&request.Imp[i])...)
+	}
+	result.and(idx.adSize.match(sizes))
+
+	return result
+}
+
+// candidates resolves the campaigns the index says can match the request.
+// lookup returns the current copy of a campaign and whether it can serve, so
+// the work is proportional to the matches rather than to all campaigns.
+func (idx *targetingIndex) candidates(
+	request *models.BidRequest,
+	now time.Time,
+	lookup func(uuid.UUID) (*models.Campaign, bool),
+) []*models.Campaign {
+	matched := idx.match(request, now)
+
+	candidates := make([]*models.Campaign, 0, matched.count())
+	for w, word := range matched {
+		for word != 0 {
+			ordinal := w*64 + bits.TrailingZeros64(word)
+			word &= word - 1
+			if campaign, ok := lookup(idx.ids[ordinal]); ok {
+				candidates = append(candidates, campaign)
+			}
+		}
+	}
+
+	return candidates
+}
+
+// currentTargeting returns the targeting index, rebuilding it whenever the
+// campaign index has changed. It returns nil when the campaign index isn't
+// loaded.
+func (e *Engine) currentTargeting() *targetingIndex {
+	version := e.campaignService.IndexVersion()
+	if version == 0 {
+		return nil
+	}
+
+	idx := e.targeting.Load()
+	if idx == nil || idx.version != version {
+		idx = e.rebuildTargeting(idx)
+	}
+	return idx
+}
+
+// candidateCampaigns returns the live campaigns in idx that can match the
+// request.
+func (e *Engine) candidateCampaigns(idx *targetingIndex, request *models.BidRequest) []*models.Campaign {
+	now := time.Now()
+	return idx.candidates(request, now, func(id uuid.UUID) (*models.Campaign, bool) {
+		return e.campaignService.ActiveCampaign(id, now)
+	})
+}
+
+// rebuildTargeting replaces the stale targeting index. One auction builds it
+// while the others keep matching against the stale one; its lookups still
+// drop campaigns that stopped serving. Auctions only wait for the first
+// build, when there is no index to fall back on.
+func (e *Engine) rebuildTargeting(stale *targetingIndex) *targetingIndex {
+	if stale == nil {
+		e.targetingBuild.Lock()
+	} else if !e.targetingBuild.TryLock() {
+		return stale
+	}
+	defer e.targetingBuild.Unlock()
+
+	indexed, version := e.campaignService.IndexedCampaigns()
+	if idx := e.targeting.Load(); idx != nil && idx.version == version {
+		return idx
+	}
+
+	idx := buildTargetingIndex(indexed, version)
+	e.targeting.Store(idx)
+	return idx
+}
+
+// requestSegments returns the IDs and names of the user's data segments.
+func requestSegments(request *models.BidRequest) []string {
+	var segments []string
+	for _, data := range request.User.Data {
+		for _, segment := range data.Segment {
+			if segment.ID != "" {
+				segments = append(segments, segment.ID)
+			}
+			if segment.Name != "" {
+				segments = append(segments, segment.Name)
+			}
+		}
+	}
+	return segments
+}
@@ -0,0 +1,296 @@
+package auction
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	benchCountries = []string{"US", "CA", "UK", "DE", "FR", "JP", "BR", "IN"}
+	benchDevices   = []string{"1", "2", "3", "4", "5"}
+	benchSegments  = []string{"sports", "travel", "tech", "auto", "finance", "parents"}
+	benchSizes     = []string{"300x250", "728x90", "320x50", "160x600", "300x600"}
+	benchRegions   = []string{"CA", "NY", "TX", "ON", "BY"}
+	benchTimezones = []string{"", "UTC", "America/New_York", "Asia/Tokyo", "Australia/Adelaide"}
+)
+
+func pick(r *rand.Rand, values []string) []string {
+	n := r.Intn(3)
+	picked := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		picked = append(picked, values[r.Intn(len(values))])
+	}
+	return picked
+}
+
+func randomCampaigns(r *rand.Rand, n int) []*models.Campaign {
+	campaigns := make([]*models.Campaign, n)
+	for i := range campaigns {
+		rules := &models.TargetingRules{
+			GeoTargeting: pick(r, benchCountries),
+			DeviceTypes:  pick(r, benchDevices),
+			UserSegments: pick(r, benchSegments),
+			AdSizes:      pick(r, benchSizes),
+		}
+		switch r.Intn(6) {
+		case 0:
+			rules.Geo = []models.GeoRule{{Mode: models.GeoModeInclude, Country: benchCountries[r.Intn(len(benchCountries))], Region: benchRegions[r.Intn(len(benchRegions))]}}
+		case 1:
+			rules.Geo = []models.GeoRule{{Mode: models.GeoModeExclude, Region: benchRegions[r.Intn(len(benchRegions))]}}
+		case 2:
+			rules.Geo = []models.GeoRule{{Mode: models.GeoModeInclude, Lat: 40.7, Lon: -74.0, RadiusKM: 50}}
+		case 3:
+			rules.Expression = fmt.Sprintf(`geo.country == %q or segment(%q)`, benchCountries[r.Intn(len(benchCountries))], benchSegments[r.Intn(len(benchSegments))])
+		}
+		if r.Intn(4) == 0 {
+			rules.DayParting = []models.DayPartRule{{DayOfWeek: r.Intn(7), StartHour: r.Intn(24), EndHour: r.Intn(25)}}
+			rules.DayPartTimezone = benchTimezones[r.Intn(len(benchTimezones))]
+			rules.DayPartUserTime = r.Intn(2) == 0
+		}
+		campaigns[i] = &models.Campaign{ID: uuid.New(), BidAmount: 2.00, TargetingRules: rules}
+	}
+	return campaigns
+}
+
+func randomRequest(r *rand.Rand) *models.BidRequest {
+	var w, h int
+	fmt.Sscanf(benchSizes[r.Intn(len(benchSizes))], "%dx%d", &w, &h)
+
+	request := &models.BidRequest{
+		ID:     uuid.New().String(),
+		Imp:    []models.Impression{{ID: "1", Banner: &models.Banner{W: w, H: h}}},
+		Device: models.Device{DeviceType: r.Intn(5) + 1},
+	}
+	switch r.Intn(5) {
+	case 0:
+	case 1:
+		request.User.Geo = &models.Geo{Country: benchCountries[r.Intn(len(benchCountries))], Lat: 40.7, Lon: -74.0}
+	default:
+		request.Device.Geo = &models.Geo{
+			Country: benchCountries[r.Intn(len(benchCountries))],
+			Region:  benchRegions[r.Intn(len(benchRegions))],
+		}
+	}
+	if r.Intn(2) == 0 {
+		request.User.Data = []models.Data{{Segment: []models.Segment{{ID: benchSegments[r.Intn(len(benchSegments))]}}}}
+	}
+	if request.Device.Geo != nil && r.Intn(2) == 0 {
+		request.Device.Geo.UTCOffset = (r.Intn(26) - 12) * 60
+	}
+	return request
+}
+
+func linearCandidates(engine *Engine, request *models.BidRequest, campaigns []*models.Campaign) []*models.Campaign {
+	var candidates []*models.Campaign
+	for _, campaign := range campaigns {
+		if !engine.checkTargeting(request, campaign) {
+			continue
+		}
+		for i := range request.Imp {
+			if matchesFormat(&request.Imp[i], campaign) {
+				candidates = append(candidates, campaign)
+				break
+			}
+		}
+	}
+	return candidates
+}
+
+func lookupIn(campaigns []*models.Campaign) func(uuid.UUID) (*models.Campaign, bool) {
+	byID := make(map[uuid.UUID]*models.Campaign, len(campaigns))
+	for _, campaign := range campaigns {
+		byID[campaign.ID] = campaign
+	}
+	return func(id uuid.UUID) (*models.Campaign, bool) {
+		campaign, exists := byID[id]
+		return campaign, exists
+	}
+}
+
+func TestTargetingIndex_MatchesLinearScan(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	engine := &Engine{}
+	campaigns := randomCampaigns(r, 500)
+	idx := buildTargetingIndex(campaigns, 1)
+	lookup := lookupIn(campaigns)
+
+	for i := 0; i < 200; i++ {
+		request := randomRequest(r)
+		indexed := idx.candidates(request, time.Now(), lookup)
+		assert.ElementsMatch(t, linearCandidates(engine, request, campaigns), linearCandidates(engine, request, indexed))
+	}
+}
+
+func TestTargetingIndex_SkipsCampaignsThatCannotServe(t *testing.T) {
+	live := &models.Campaign{ID: uuid.New()}
+	paused := &models.Campaign{ID: uuid.New()}
+	idx := buildTargetingIndex([]*models.Campaign{live, paused}, 1)
+
+	candidates := idx.candidates(&models.BidRequest{}, time.Now(), lookupIn([]*models.Campaign{live}))
+	assert.Equal(t, []*models.Campaign{live}, candidates)
+}
+
+// The benchmarks compare evaluating every campaign's targeting against
+// narrowing candidates through the index first, as campaign count grows.
+func BenchmarkCandidateSelection(b *testing.B) {
+	engine := &Engine{}
+
+	for _, n := range []int{100, 1000, 10000, 50000} {
+		r := rand.New(rand.NewSource(1))
+		campaigns := randomCampaigns(r, n)
+		requests := make([]*models.BidRequest, 64)
+		for i := range requests {
+			requests[i] = randomRequest(r)
+		}
+		idx := buildTargetingIndex(campaigns, 1)
+		lookup := lookupIn(campaigns)
+		now := time.Now()
+
+		b.Run(fmt.Sprintf("linear/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				linearCandidates(engine, requests[i%len(requests)], campaigns)
+			}
+		})
+
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				request := requests[i%len(requests)]
+				linearCandidates(engine, request, idx.candidates(request, now, lookup))
+			}
+		})
+	}
+}
+
+func BenchmarkBuildTargetingIndex(b *testing.B) {
+	campaigns := randomCampaigns(rand.New(rand.NewSource(1)), 10000)
+
+	for i := 0; i < b.N; i++ {
+		buildTargetingIndex(campaigns, uint64(i+1))
+	}
+}
+
+var benchCampaignColumns = []string{
+	"id", "name", "advertiser_id", "seat", "advertiser_domains", "categories", "app_bundle",
+	"status", "budget_daily", "budget_total",
+	"spent_daily", "spent_total", "bid_type", "bid_amount", "bid_strategy",
+	"bid_strategy_params", "deal_ids", "targeting_rules", "frequency_capping",
+	"start_date", "end_date", "created_at", "updated_at", "competitive_labels",
+	"priority", "delivery_goal",
+}
+
+var benchCreativeColumns = []string{
+	"id", "campaign_id", "name", "type", "format", "width", "height", "asset_url",
+	"click_url", "impression_url", "html", "duration", "mime_type", "skippable",
+	"skip_offset", "native_assets", "status", "created_at", "updated_at",
+}
+
+// newIndexedEngine returns an engine whose campaign index holds campaigns,
+// each with a live budget and a banner creative in every benchmark size.
+func newIndexedEngine(t testing.TB, campaigns []*models.Campaign) *Engine {
+	engine, mock, _ := newTestEngine(t)
+	engine.logger.SetOutput(io.Discard)
+	ctx := context.Background()
+
+	start := time.Now().Add(-24 * time.Hour)
+	rows := make([][]driver.Value, len(campaigns))
+	for i, c := range campaigns {
+		rules, err := json.Marshal(c.TargetingRules)
+		require.NoError(t, err)
+		rows[i] = []driver.Value{
+			c.ID.String(), fmt.Sprintf("Campaign %d", i), "adv-1", nil, nil, nil, nil,
+			string(models.CampaignStatusActive), 1000.0, 100000.0,
+			0.0, 0.0, string(models.BidTypeCPM), c.BidAmount, nil,
+			nil, nil, rules, nil,
+			start, nil, start, start, nil,
+			string(models.PriorityPricePriority), nil,
+		}
+	}
+	mock.OnQuery("FROM campaigns", benchCampaignColumns, rows...)
+	require.NoError(t, engine.campaignService.Resync(ctx))
+
+	var creatives [][]driver.Value
+	for _, c := range campaigns {
+		require.NoError(t, engine.redis.SetCampaignBudget(c.ID.String(), 1000, 100000))
+		for _, size := range benchSizes {
+			var w, h int64
+			fmt.Sscanf(size, "%dx%d", &w, &h)
+			creatives = append(creatives, []driver.Value{
+				uuid.NewString(), c.ID.String(), size, string(models.CreativeTypeBanner), size, w, h, "https://cdn.example.com/ad.png",
+				"", "", nil, int64(0), "", false,
+				int64(0), nil, models.CreativeStatusActive, start, start,
+			})
+		}
+	}
+	mock.OnQuery("FROM ad_creatives", benchCreativeColumns, creatives...)
+	require.NoError(t, engine.creativeService.Refresh(ctx))
+
+	return engine
+}
+
+// BenchmarkCollectBids times choosing candidates and bidding them, either
+// every active campaign or only those the targeting index returns.
+func BenchmarkCollectBids(b *testing.B) {
+	ctx := context.Background()
+
+	for _, n := range []int{100, 1000, 10000, 50000} {
+		r := rand.New(rand.NewSource(1))
+		engine := newIndexedEngine(b, randomCampaigns(r, n))
+		requests := make([]*models.BidRequest, 64)
+		for i := range requests {
+			requests[i] = randomRequest(r)
+		}
+
+		b.Run(fmt.Sprintf("linear/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				request := requests[i%len(requests)]
+				campaigns, err := engine.campaignService.ListActiveCampaigns(ctx)
+				require.NoError(b, err)
+				engine.collectBids(ctx, request, campaigns, nil)
+			}
+		})
+
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				request := requests[i%len(requests)]
+				campaigns := engine.candidateCampaigns(engine.currentTargeting(), request)
+				engine.collectBids(ctx, request, campaigns, nil)
+			}
+		})
+	}
+}
+
+// BenchmarkRunAuction times the whole auction. Untraced auctions always take
+// the indexed path once the campaign index is loaded.
+func BenchmarkRunAuction(b *testing.B) {
+	ctx := context.Background()
+
+	for _, n := range []int{100, 1000, 10000, 50000} {
+		r := rand.New(rand.NewSource(1))
+		engine := newIndexedEngine(b, randomCampaigns(r, n))
+		requests := make([]*models.BidRequest, 64)
+		for i := range requests {
+			requests[i] = randomRequest(r)
+		}
+
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				request := *requests[i%len(requests)]
+				request.ID = uuid.NewString()
+				if _, err := engine.RunAuction(ctx, &request); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
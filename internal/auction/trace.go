@@ -0,0 +1,158 @@
+package auction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/google/uuid"
+)
+
+// TraceHeader opts a bid request into decision tracing. Requests with
+// Test=1 are always traced.
+const TraceHeader = "X-Auction-Trace"
+
+const (
+	TraceOutcomeFiltered  = "filtered"
+	TraceOutcomeEvaluated = "evaluated"
+	TraceOutcomeNoBid     = "no_bid"
+	TraceOutcomeBid       = "bid"
+	TraceOutcomeWon       = "won"
+	TraceOutcomeLost      = "lost"
+	TraceOutcomeRejected  = "rejected"
+)
+
+type traceContextKey struct{}
+
+// WithTrace marks ctx so that RunAuction records a decision trace.
+func WithTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, true)
+}
+
+func traceRequested(ctx context.Context) bool {
+	enabled, _ := ctx.Value(traceContextKey{}).(bool)
+	return enabled
+}
+
+type Trace struct {
+	AuctionID string           `json:"auction_id"`
+	Test      bool             `json:"test"`
+	Campaigns []*CampaignTrace `json:"campaigns"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+type CampaignTrace struct {
+	CampaignID  uuid.UUID          `json:"campaign_id"`
+	Name        string             `json:"name"`
+	Outcome     string             `json:"outcome"`
+	Reason      string             `json:"reason,omitempty"`
+	Impressions []*ImpressionTrace `json:"impressions,omitempty"`
+}
+
+type ImpressionTrace struct {
+	ImpID         string  `json:"imp_id"`
+	Outcome       string  `json:"outcome"`
+	Reason        string  `json:"reason,omitempty"`
+	CreativeID    string  `json:"creative_id,omitempty"`
+	DealID        string  `json:"deal_id,omitempty"`
+	Bid           float64 `json:"bid,omitempty"`
+	Floor         float64 `json:"floor,omitempty"`
+	Score         float64 `json:"score,omitempty"`
+	ClearingPrice float64 `json:"clearing_price,omitempty"`
+}
+
+func newTrace(request *models.BidRequest, campaigns int) *Trace {
+	return &Trace{
+		AuctionID: request.ID,
+		Test:      request.Test == 1,
+		Campaigns: make([]*CampaignTrace, 0, campaigns),
+		CreatedAt: time.Now(),
+	}
+}
+
+// campaign adds a trace entry for the campaign. All trace methods are safe to
+// call on nil receivers so untraced auctions pay nothing.
+func (t *Trace) campaign(c *models.Campaign) *CampaignTrace {
+	if t == nil {
+		return nil
+	}
+	ct := &CampaignTrace{CampaignID: c.ID, Name: c.Name, Outcome: TraceOutcomeEvaluated}
+	t.Campaigns = append(t.Campaigns, ct)
+	return ct
+}
+
+func (ct *CampaignTrace) filter(format string, args ...interface{}) {
+	if ct == nil {
+		return
+	}
+	ct.Outcome = TraceOutcomeFiltered
+	ct.Reason = fmt.Sprintf(format, args...)
+}
+
+func (ct *CampaignTrace) impression(impID string) *ImpressionTrace {
+	if ct == nil {
+		return nil
+	}
+	it := &ImpressionTrace{ImpID: impID, Outcome: TraceOutcomeNoBid}
+	ct.Impressions = append(ct.Impressions, it)
+	return it
+}
+
+func (it *ImpressionTrace) noBid(format string, args ...interface{}) {
+	if it == nil {
+		return
+	}
+	it.Outcome = TraceOutcomeNoBid
+	it.Reason = fmt.Sprintf(format, args...)
+}
+
+func (it *ImpressionTrace) bid(entry *BidEntry) {
+	if it == nil {
+		return
+	}
+	it.Outcome = TraceOutcomeBid
+	it.CreativeID = entry.Bid.CrID
+	it.DealID = entry.Bid.DealID
+	it.Bid = entry.Bid.Price
+	it.Floor = entry.Floor
+	it.Score = entry.Score
+}
+
+func (it *ImpressionTrace) settle(outcome string, format string, args ...interface{}) {
+	if it == nil {
+		return
+	}
+	it.Outcome = outcome
+	it.Reason = fmt.Sprintf(format, args...)
+}
+
+func (e *Engine) saveTrace(trace *Trace) {
+	if trace == nil {
+		return
+	}
+
+	if err := e.redis.CacheAuctionTrace(trace.AuctionID, trace, resultCacheTTL); err != nil {
+		e.logger.WithError(err).WithField("auction_id", trace.AuctionID).Error("Failed to cache auction trace")
+	}
+}
+
+// GetTrace returns the decision trace for an auction, or nil when the auction
+// was not traced or the trace has expired.
+func (e *Engine) GetTrace(auctionID string) (*Trace, error) {
+	data, err := e.redis.GetAuctionTrace(auctionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auction trace: %w", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var trace Trace
+	if err := json.Unmarshal(data, &trace); err != nil {
+		return nil, fmt.Errorf("failed to decode auction trace: %w", err)
+	}
+
+	return &trace, nil
+}
@@ -0,0 +1,170 @@
+package auction
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+// Inline VAST versions we can serve, keyed by OpenRTB protocol ID.
+var vastProtocols = []struct {
+	Protocol int
+	Version  string
+}{
+	{13, "4.2"},
+	{11, "4.1"},
+	{7, "4.0"},
+	{3, "3.0"},
+}
+
+const defaultVASTProtocol = 3
+
+// vastQuartiles maps VAST tracking event names to our tracking event types.
+var vastQuartiles = []struct {
+	Event string
+	Type  models.EventType
+}{
+	{"start", models.EventTypeVideoStart},
+	{"firstQuartile", models.EventTypeVideoFirstQuartile},
+	{"midpoint", models.EventTypeVideoMidpoint},
+	{"thirdQuartile", models.EventTypeVideoThirdQuartile},
+	{"complete", models.EventTypeVideoComplete},
+}
+
+type vastDocument struct {
+	XMLName xml.Name `xml:"VAST"`
+	Version string   `xml:"version,attr"`
+	Ad      vastAd   `xml:"Ad"`
+}
+
+type vastAd struct {
+	ID       string     `xml:"id,attr"`
+	Sequence int        `xml:"sequence,attr,omitempty"`
+	InLine   vastInLine `xml:"InLine"`
+}
+
+type vastInLine struct {
+	AdSystem    string         `xml:"AdSystem"`
+	AdServingID string         `xml:"AdServingId,omitempty"`
+	AdTitle     string         `xml:"AdTitle"`
+	Impression  vastCDATA      `xml:"Impression"`
+	Creatives   []vastCreative `xml:"Creatives>Creative"`
+}
+
+type vastCreative struct {
+	ID            string         `xml:"id,attr"`
+	UniversalAdID *vastUniversal `xml:"UniversalAdId,omitempty"`
+	Linear        vastLinear     `xml:"Linear"`
+}
+
+type vastUniversal struct {
+	IDRegistry string `xml:"idRegistry,attr"`
+	Value      string `xml:",chardata"`
+}
+
+type vastLinear struct {
+	SkipOffset     string         `xml:"skipoffset,attr,omitempty"`
+	Duration       string         `xml:"Duration"`
+	TrackingEvents []vastTracking `xml:"TrackingEvents>Tracking"`
+	ClickThrough   *vastCDATA     `xml:"VideoClicks>ClickThrough,omitempty"`
+	MediaFiles     []vastMedia    `xml:"MediaFiles>MediaFile"`
+}
+
+type vastTracking struct {
+	Event string `xml:"event,attr"`
+	URL   string `xml:",cdata"`
+}
+
+type vastMedia struct {
+	Delivery string `xml:"delivery,attr"`
+	Type     string `xml:"type,attr"`
+	Width    int    `xml:"width,attr"`
+	Height   int    `xml:"height,attr"`
+	URL      string `xml:",cdata"`
+}
+
+type vastCDATA struct {
+	URL string `xml:",cdata"`
+}
+
+// vastVersion returns the highest inline VAST version the player accepts.
+// An empty protocol list is treated as VAST 3.0 support.
+func vastVersion(protocols []int) (int, string, bool) {
+	if len(protocols) == 0 {
+		return defaultVASTProtocol, "3.0", true
+	}
+
+	for _, candidate := range vastProtocols {
+		for _, protocol := range protocols {
+			if protocol == candidate.Protocol {
+				return candidate.Protocol, candidate.Version, true
+			}
+		}
+	}
+
+	return 0, "", false
+}
+
+func (e *Engine) buildVAST(request *models.BidRequest, bid *models.Bid, campaign *models.Campaign, match *creativeMatch) (string, error) {
+	creative := match.Creative
+	params := trackingParams(request, bid, campaign, creative)
+
+	linear := vastLinear{
+		SkipOffset: match.SkipOffset,
+		Duration:   formatVASTDuration(creative.Duration),
+		MediaFiles: []vastMedia{{
+			Delivery: "progressive",
+			Type:     creative.MIMEType,
+			Width:    match.W,
+			Height:   match.H,
+			URL:      creative.AssetURL,
+		}},
+	}
+
+	for _, quartile := range vastQuartiles {
+		eventParams := url.Values{}
+		for key, values := range params {
+			eventParams[key] = values
+		}
+		eventParams.Set("event", string(quartile.Type))
+		linear.TrackingEvents = append(linear.TrackingEvents, vastTracking{
+			Event: quartile.Event,
+			URL:   e.trackingBaseURL + "/track/video?" + eventParams.Encode(),
+		})
+	}
+
+	if creative.ClickURL != "" {
+		linear.ClickThrough = &vastCDATA{URL: creative.ClickURL}
+	}
+
+	linearCreative := vastCreative{ID: creative.ID.String(), Linear: linear}
+	inline := vastInLine{
+		AdSystem:   "ad-delivery-simulator",
+		AdTitle:    creative.Name,
+		Impression: vastCDATA{URL: e.trackingBaseURL + "/track/impression?" + params.Encode()},
+	}
+
+	if match.VASTVersion != "3.0" {
+		inline.AdServingID = bid.ID
+		linearCreative.UniversalAdID = &vastUniversal{IDRegistry: "ad-delivery-simulator", Value: creative.ID.String()}
+	}
+	inline.Creatives = []vastCreative{linearCreative}
+
+	doc := vastDocument{
+		Version: match.VASTVersion,
+		Ad:      vastAd{ID: bid.ID, Sequence: match.Sequence, InLine: inline},
+	}
+
+	out, err := xml.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal VAST: %w", err)
+	}
+
+	return xml.Header + string(out), nil
+}
+
+func formatVASTDuration(seconds int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+}
@@ -0,0 +1,221 @@
+package bidding
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+const (
+	defaultCTR = 0.001
+	defaultCVR = 0.01
+)
+
+func init() {
+	Register(DefaultStrategy, newStandardStrategy)
+	Register("fixed_cpm", newFixedCPMStrategy)
+	Register("ecpm", newECPMStrategy)
+	Register("target_cpa", newTargetCPAStrategy)
+	Register("max_delivery", newMaxDeliveryStrategy)
+}
+
+type standardStrategy struct {
+	mobileMultiplier   float64
+	categoryMultiplier float64
+}
+
+func newStandardStrategy(params map[string]float64) (Strategy, error) {
+	s := &standardStrategy{
+		mobileMultiplier:   param(params, "mobile_multiplier", 1.2),
+		categoryMultiplier: param(params, "category_multiplier", 1.1),
+	}
+
+	if err := requirePositive(params, "mobile_multiplier", "category_multiplier"); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *standardStrategy) Bid(ctx *BidContext) float64 {
+	multiplier := 1.0
+
+	if ctx.Request.Device.DeviceType == 1 {
+		multiplier *= s.mobileMultiplier
+	}
+
+	if ctx.Request.Site != nil && len(ctx.Request.Site.Cat) > 0 {
+		multiplier *= s.categoryMultiplier
+	}
+
+	return amountCPM(ctx, defaultCTR, defaultCVR) * multiplier
+}
+
+func (s *standardStrategy) Score(ctx *BidContext, bid float64) float64 {
+	return bid
+}
+
+type fixedCPMStrategy struct {
+	cpm float64
+}
+
+func newFixedCPMStrategy(params map[string]float64) (Strategy, error) {
+	if err := requirePositive(params, "cpm"); err != nil {
+		return nil, err
+	}
+	return &fixedCPMStrategy{cpm: param(params, "cpm", 0)}, nil
+}
+
+func (s *fixedCPMStrategy) Bid(ctx *BidContext) float64 {
+	if s.cpm > 0 {
+		return s.cpm
+	}
+	return amountCPM(ctx, defaultCTR, defaultCVR)
+}
+
+func (s *fixedCPMStrategy) Score(ctx *BidContext, bid float64) float64 {
+	return bid
+}
+
+// ecpmStrategy converts CPC and CPA bids into an expected CPM using the
+// predicted click and conversion rates, falling back to configured rates.
+type ecpmStrategy struct {
+	ctr float64
+	cvr float64
+}
+
+func newECPMStrategy(params map[string]float64) (Strategy, error) {
+	if err := requireRate(params, "default_ctr", "default_cvr"); err != nil {
+		return nil, err
+	}
+	return &ecpmStrategy{
+		ctr: param(params, "default_ctr", defaultCTR),
+		cvr: param(params, "default_cvr", defaultCVR),
+	}, nil
+}
+
+func (s *ecpmStrategy) Bid(ctx *BidContext) float64 {
+	return amountCPM(ctx, s.ctr, s.cvr)
+}
+
+func (s *ecpmStrategy) Score(ctx *BidContext, bid float64) float64 {
+	return bid
+}
+
+type targetCPAStrategy struct {
+	targetCPA float64
+	maxBid    float64
+	ctr       float64
+	cvr       float64
+}
+
+func newTargetCPAStrategy(params map[string]float64) (Strategy, error) {
+	if err := requirePositive(params, "target_cpa", "max_bid"); err != nil {
+		return nil, err
+	}
+	if err := requireRate(params, "default_ctr", "default_cvr"); err != nil {
+		return nil, err
+	}
+	return &targetCPAStrategy{
+		targetCPA: param(params, "target_cpa", 0),
+		maxBid:    param(params, "max_bid", 0),
+		ctr:       param(params, "default_ctr", defaultCTR),
+		cvr:       param(params, "default_cvr", defaultCVR),
+	}, nil
+}
+
+func (s *targetCPAStrategy) Bid(ctx *BidContext) float64 {
+	targetCPA := s.targetCPA
+	if targetCPA == 0 {
+		targetCPA = ctx.Campaign.BidAmount
+	}
+
+	bid := targetCPA * rateOr(ctx.PredictedCTR, s.ctr) * rateOr(ctx.PredictedCVR, s.cvr) * 1000
+
+	if s.maxBid > 0 {
+		bid = math.Min(bid, s.maxBid)
+	}
+	return bid
+}
+
+func (s *targetCPAStrategy) Score(ctx *BidContext, bid float64) float64 {
+	return bid
+}
+
+// maxDeliveryStrategy raises the bid to just clear the floor, up to max_bid
+// (or max_multiplier times the base bid), so the campaign wins as many
+// impressions as its budget allows.
+type maxDeliveryStrategy struct {
+	maxBid        float64
+	maxMultiplier float64
+	increment     float64
+}
+
+func newMaxDeliveryStrategy(params map[string]float64) (Strategy, error) {
+	if err := requirePositive(params, "max_bid", "max_multiplier", "bid_increment"); err != nil {
+		return nil, err
+	}
+	return &maxDeliveryStrategy{
+		maxBid:        param(params, "max_bid", 0),
+		maxMultiplier: param(params, "max_multiplier", 1.5),
+		increment:     param(params, "bid_increment", 0.01),
+	}, nil
+}
+
+func (s *maxDeliveryStrategy) Bid(ctx *BidContext) float64 {
+	bid := amountCPM(ctx, defaultCTR, defaultCVR)
+
+	maxBid := s.maxBid
+	if maxBid == 0 {
+		maxBid = bid * s.maxMultiplier
+	}
+
+	if ctx.Imp != nil && ctx.Imp.BidFloor > 0 {
+		bid = math.Max(bid, ctx.Imp.BidFloor+s.increment)
+	}
+
+	return math.Min(bid, maxBid)
+}
+
+func (s *maxDeliveryStrategy) Score(ctx *BidContext, bid float64) float64 {
+	return bid
+}
+
+// amountCPM is the campaign's bid amount as a CPM. CPC and CPA amounts are
+// valued at the predicted click and conversion rates, or at ctr and cvr when
+// the engine runs without a predictor.
+func amountCPM(ctx *BidContext, ctr, cvr float64) float64 {
+	switch ctx.Campaign.BidType {
+	case models.BidTypeCPC:
+		return ctx.Campaign.BidAmount * rateOr(ctx.PredictedCTR, ctr) * 1000
+	case models.BidTypeCPA:
+		return ctx.Campaign.BidAmount * rateOr(ctx.PredictedCTR, ctr) * rateOr(ctx.PredictedCVR, cvr) * 1000
+	}
+	return ctx.Campaign.BidAmount
+}
+
+func rateOr(predicted, fallback float64) float64 {
+	if predicted > 0 {
+		return predicted
+	}
+	return fallback
+}
+
+func requirePositive(params map[string]float64, keys ...string) error {
+	for _, key := range keys {
+		if value, ok := params[key]; ok && value <= 0 {
+			return fmt.Errorf("parameter %q must be positive", key)
+		}
+	}
+	return nil
+}
+
+func requireRate(params map[string]float64, keys ...string) error {
+	for _, key := range keys {
+		if value, ok := params[key]; ok && (value <= 0 || value > 1) {
+			return fmt.Errorf("parameter %q must be between 0 and 1", key)
+		}
+	}
+	return nil
+}
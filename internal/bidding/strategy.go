@@ -0,0 +1,84 @@
+package bidding
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+const DefaultStrategy = "standard"
+
+type BidContext struct {
+	Campaign     *models.Campaign
+	Request      *models.BidRequest
+	Imp          *models.Impression
+	PredictedCTR float64
+	PredictedCVR float64
+}
+
+// Strategy turns a campaign's settings into a CPM bid for one impression
+// and the score used to rank that bid against other campaigns. CPC and CPA
+// campaigns bid the CPM their amount is expected to earn, so bids of every
+// type are floored, ranked and cleared in the same units.
+type Strategy interface {
+	Bid(ctx *BidContext) float64
+	Score(ctx *BidContext, bid float64) float64
+}
+
+type Factory func(params map[string]float64) (Strategy, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("bidding strategy %q already registered", name))
+	}
+	registry[name] = factory
+}
+
+func New(name string, params map[string]float64) (Strategy, error) {
+	if name == "" {
+		name = DefaultStrategy
+	}
+
+	registryMu.RLock()
+	factory, exists := registry[name]
+	registryMu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown bidding strategy %q", name)
+	}
+
+	return factory(params)
+}
+
+func ForCampaign(campaign *models.Campaign) (Strategy, error) {
+	return New(campaign.BidStrategy, campaign.BidStrategyParams)
+}
+
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func param(params map[string]float64, key string, fallback float64) float64 {
+	if value, ok := params[key]; ok {
+		return value
+	}
+	return fallback
+}
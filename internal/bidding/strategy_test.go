@@ -0,0 +1,196 @@
+package bidding
+
+import (
+	"testing"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStandardStrategy_Bid(t *testing.T) {
+	strategy, err := New(DefaultStrategy, nil)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		campaign *models.Campaign
+		request  *models.BidRequest
+		expected float64
+	}{
+		{
+			name: "Base bid only",
+			campaign: &models.Campaign{
+				BidAmount: 1.00,
+			},
+			request: &models.BidRequest{
+				Device: models.Device{
+					DeviceType: 2,
+				},
+			},
+			expected: 1.00,
+		},
+		{
+			name: "Mobile device multiplier",
+			campaign: &models.Campaign{
+				BidAmount: 1.00,
+			},
+			request: &models.BidRequest{
+				Device: models.Device{
+					DeviceType: 1,
+				},
+			},
+			expected: 1.20,
+		},
+		{
+			name: "Site category multiplier",
+			campaign: &models.Campaign{
+				BidAmount: 1.00,
+			},
+			request: &models.BidRequest{
+				Device: models.Device{
+					DeviceType: 2,
+				},
+				Site: &models.Site{
+					Cat: []string{"IAB1"},
+				},
+			},
+			expected: 1.10,
+		},
+		{
+			name: "Combined multipliers",
+			campaign: &models.Campaign{
+				BidAmount: 1.00,
+			},
+			request: &models.BidRequest{
+				Device: models.Device{
+					DeviceType: 1,
+				},
+				Site: &models.Site{
+					Cat: []string{"IAB1"},
+				},
+			},
+			expected: 1.32,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount := strategy.Bid(&BidContext{Campaign: tt.campaign, Request: tt.request})
+			assert.InDelta(t, tt.expected, amount, 0.01)
+		})
+	}
+}
+
+func TestStrategies_Bid(t *testing.T) {
+	request := &models.BidRequest{}
+
+	tests := []struct {
+		name     string
+		strategy string
+		params   map[string]float64
+		campaign *models.Campaign
+		imp      *models.Impression
+		ctr      float64
+		cvr      float64
+		expected float64
+	}{
+		{
+			name:     "Standard CPC at the predicted CTR",
+			strategy: DefaultStrategy,
+			campaign: &models.Campaign{BidType: models.BidTypeCPC, BidAmount: 1.00},
+			ctr:      0.003,
+			expected: 3.00,
+		},
+		{
+			name:     "Standard CPA at the predicted rates",
+			strategy: DefaultStrategy,
+			campaign: &models.Campaign{BidType: models.BidTypeCPA, BidAmount: 10.00},
+			ctr:      0.003,
+			cvr:      0.05,
+			expected: 1.50,
+		},
+		{
+			name:     "Standard CPA without predictions",
+			strategy: DefaultStrategy,
+			campaign: &models.Campaign{BidType: models.BidTypeCPA, BidAmount: 50.00},
+			expected: 0.50,
+		},
+		{
+			name:     "Fixed CPM ignores device and site",
+			strategy: "fixed_cpm",
+			params:   map[string]float64{"cpm": 2.50},
+			campaign: &models.Campaign{BidAmount: 1.00},
+			expected: 2.50,
+		},
+		{
+			name:     "eCPM from predicted CTR",
+			strategy: "ecpm",
+			campaign: &models.Campaign{BidType: models.BidTypeCPC, BidAmount: 0.50},
+			ctr:      0.004,
+			expected: 2.00,
+		},
+		{
+			name:     "eCPM falls back to default rates",
+			strategy: "ecpm",
+			params:   map[string]float64{"default_ctr": 0.01, "default_cvr": 0.05},
+			campaign: &models.Campaign{BidType: models.BidTypeCPA, BidAmount: 10.00},
+			expected: 5.00,
+		},
+		{
+			name:     "Target CPA capped by max bid",
+			strategy: "target_cpa",
+			params:   map[string]float64{"target_cpa": 50, "max_bid": 3.00},
+			campaign: &models.Campaign{BidType: models.BidTypeCPA},
+			ctr:      0.01,
+			cvr:      0.02,
+			expected: 3.00,
+		},
+		{
+			name:     "Max delivery clears the floor",
+			strategy: "max_delivery",
+			campaign: &models.Campaign{BidAmount: 1.00},
+			imp:      &models.Impression{BidFloor: 1.20},
+			expected: 1.21,
+		},
+		{
+			name:     "Max delivery values CPC at the predicted CTR",
+			strategy: "max_delivery",
+			campaign: &models.Campaign{BidType: models.BidTypeCPC, BidAmount: 0.50},
+			imp:      &models.Impression{BidFloor: 1.20},
+			ctr:      0.004,
+			expected: 2.00,
+		},
+		{
+			name:     "Max delivery stops at max bid",
+			strategy: "max_delivery",
+			params:   map[string]float64{"max_bid": 1.10},
+			campaign: &models.Campaign{BidAmount: 1.00},
+			imp:      &models.Impression{BidFloor: 1.20},
+			expected: 1.10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := New(tt.strategy, tt.params)
+			assert.NoError(t, err)
+
+			bid := strategy.Bid(&BidContext{
+				Campaign:     tt.campaign,
+				Request:      request,
+				Imp:          tt.imp,
+				PredictedCTR: tt.ctr,
+				PredictedCVR: tt.cvr,
+			})
+			assert.InDelta(t, tt.expected, bid, 0.0001)
+		})
+	}
+}
+
+func TestNew_InvalidStrategy(t *testing.T) {
+	_, err := New("unknown", nil)
+	assert.Error(t, err)
+
+	_, err = New("ecpm", map[string]float64{"default_ctr": 1.5})
+	assert.Error(t, err)
+}
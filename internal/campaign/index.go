@@ -0,0 +1,250 @@
+package campaign
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/pkg/kafka"
+	"github.com/google/uuid"
+)
+
+type campaignUpdate struct {
+	Action   string           `json:"action"`
+	Campaign *models.Campaign `json:"campaign"`
+}
+
+// StartIndex loads active campaigns into memory and keeps them current from
+// the campaign-updates topic, with a full resync every resyncInterval. Once
+// the index is loaded the auction hot path no longer queries Postgres.
+func (s *Service) StartIndex(ctx context.Context, consumer *kafka.Consumer, groupID string, resyncInterval time.Duration) error {
+	if err := s.Resync(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(resyncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Resync(ctx); err != nil {
+					s.logger.WithError(err).Error("Failed to resync campaign index")
+				}
+			}
+		}
+	}()
+
+	go consumer.ConsumeCampaignUpdates(ctx, s.brokers, groupID, s.handleCampaignUpdate)
+
+	return nil
+}
+
+// Resync replaces the index with the active campaigns currently in Postgres.
+// Campaigns that haven't started or are out of budget are kept too, since
+// ListActiveCampaigns filters them per call. The index version only moves
+// when the resync found campaigns added, removed or edited.
+func (s *Service) Resync(ctx context.Context) error {
+	query := `
+		SELECT ` + campaignColumns + `
+		FROM campaigns
+		WHERE status = $1
+			AND (end_date IS NULL OR end_date > NOW())
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, models.CampaignStatusActive)
+	if err != nil {
+		return fmt.Errorf("failed to load campaign index: %w", err)
+	}
+	defer rows.Close()
+
+	index := make(map[uuid.UUID]*models.Campaign)
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to scan campaign")
+			continue
+		}
+		index[campaign.ID] = campaign
+	}
+
+	s.mu.Lock()
+	if s.index == nil || !sameCampaigns(s.index, index) {
+		s.version++
+	}
+	s.index = index
+	s.mu.Unlock()
+
+	s.logger.WithField("campaigns", len(index)).Debug("Resynced campaign index")
+	return nil
+}
+
+// handleCampaignUpdate reloads the updated campaign from Postgres rather than
+// trusting the event payload, which only carries the fields the caller sent.
+func (s *Service) handleCampaignUpdate(ctx context.Context, message []byte) error {
+	var update campaignUpdate
+	if err := json.Unmarshal(message, &update); err != nil {
+		return fmt.Errorf("invalid campaign update: %w", err)
+	}
+	if update.Campaign == nil || update.Campaign.ID == uuid.Nil {
+		return fmt.Errorf("campaign update without campaign ID")
+	}
+
+	campaign, err := s.GetCampaign(ctx, update.Campaign.ID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index == nil {
+		return nil
+	}
+
+	if campaign.Status == models.CampaignStatusActive {
+		s.index[campaign.ID] = campaign
+	} else {
+		delete(s.index, campaign.ID)
+	}
+	s.version++
+
+	return nil
+}
+
+// IndexVersion returns the current index version; see IndexedCampaigns.
+func (s *Service) IndexVersion() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+// ActiveCampaign returns the indexed campaign if it can currently serve.
+func (s *Service) ActiveCampaign(campaignID uuid.UUID, now time.Time) (*models.Campaign, bool) {
+	campaign, exists := s.indexedCampaign(campaignID)
+	if !exists || !isLive(campaign, now) {
+		return nil, false
+	}
+	return campaign, true
+}
+
+// IndexedCampaigns returns every campaign in the index along with a version
+// that changes whenever campaigns are added, removed or edited. Spend updates
+// don't change the version. Version 0 means the index isn't loaded.
+func (s *Service) IndexedCampaigns() ([]*models.Campaign, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	campaigns := make([]*models.Campaign, 0, len(s.index))
+	for _, campaign := range s.index {
+		campaigns = append(campaigns, campaign)
+	}
+
+	return campaigns, s.version
+}
+
+func (s *Service) indexLoaded() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.index != nil
+}
+
+// indexedCampaign returns the cached campaign and whether the index is loaded
+// and holds it.
+func (s *Service) indexedCampaign(campaignID uuid.UUID) (*models.Campaign, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	campaign, exists := s.index[campaignID]
+	return campaign, exists
+}
+
+// lookupCampaign serves reads on the auction path from the index and only
+// falls back to Postgres for campaigns the index doesn't hold.
+func (s *Service) lookupCampaign(ctx context.Context, campaignID uuid.UUID) (*models.Campaign, error) {
+	if campaign, exists := s.indexedCampaign(campaignID); exists {
+		return campaign, nil
+	}
+	return s.GetCampaign(ctx, campaignID)
+}
+
+func (s *Service) indexedActiveCampaigns(now time.Time) ([]*models.Campaign, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.index == nil {
+		return nil, false
+	}
+
+	campaigns := make([]*models.Campaign, 0, len(s.index))
+	for _, campaign := range s.index {
+		if isLive(campaign, now) {
+			campaigns = append(campaigns, campaign)
+		}
+	}
+
+	return campaigns, true
+}
+
+// addIndexedSpend mirrors a spend update into the index. Cached campaigns are
+// shared with in-flight auctions, so the entry is replaced, not mutated.
+func (s *Service) addIndexedSpend(campaignID uuid.UUID, amount float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	campaign, exists := s.index[campaignID]
+	if !exists {
+		return
+	}
+
+	updated := *campaign
+	updated.SpentDaily += amount
+	updated.SpentTotal += amount
+	s.index[campaignID] = &updated
+}
+
+// sameCampaigns reports whether two indexes hold the same campaigns. Spend,
+// and the update time that moves with it, don't count as changes.
+func sameCampaigns(a, b map[uuid.UUID]*models.Campaign) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for id, campaign := range a {
+		other, exists := b[id]
+		if !exists {
+			return false
+		}
+
+		x, y := *campaign, *other
+		x.SpentDaily, x.SpentTotal, x.UpdatedAt = 0, 0, time.Time{}
+		y.SpentDaily, y.SpentTotal, y.UpdatedAt = 0, 0, time.Time{}
+		if !reflect.DeepEqual(x, y) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isLive(campaign *models.Campaign, now time.Time) bool {
+	if campaign.Status != models.CampaignStatusActive {
+		return false
+	}
+	if campaign.StartDate.After(now) {
+		return false
+	}
+	if campaign.EndDate != nil && !campaign.EndDate.After(now) {
+		return false
+	}
+	if campaign.Priority == models.PriorityHouse {
+		return true
+	}
+	return campaign.SpentTotal < campaign.BudgetTotal && campaign.SpentDaily < campaign.BudgetDaily
+}
@@ -0,0 +1,100 @@
+package campaign
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/sqltest"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndex_ActiveCampaigns(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	live := &models.Campaign{
+		ID: uuid.New(), Status: models.CampaignStatusActive, StartDate: past,
+		BudgetDaily: 100, BudgetTotal: 1000,
+	}
+	notStarted := &models.Campaign{
+		ID: uuid.New(), Status: models.CampaignStatusActive, StartDate: now.Add(time.Hour),
+		BudgetDaily: 100, BudgetTotal: 1000,
+	}
+	ended := &models.Campaign{
+		ID: uuid.New(), Status: models.CampaignStatusActive, StartDate: past, EndDate: &past,
+		BudgetDaily: 100, BudgetTotal: 1000,
+	}
+	nearlySpent := &models.Campaign{
+		ID: uuid.New(), Status: models.CampaignStatusActive, StartDate: past,
+		BudgetDaily: 100, BudgetTotal: 1000, SpentDaily: 99,
+	}
+	house := &models.Campaign{
+		ID: uuid.New(), Status: models.CampaignStatusActive, StartDate: past,
+		Priority: models.PriorityHouse,
+	}
+
+	s := &Service{}
+	_, loaded := s.indexedActiveCampaigns(now)
+	assert.False(t, loaded)
+
+	s.index = map[uuid.UUID]*models.Campaign{
+		live.ID: live, notStarted.ID: notStarted, ended.ID: ended, nearlySpent.ID: nearlySpent,
+		house.ID: house,
+	}
+
+	campaigns, loaded := s.indexedActiveCampaigns(now)
+	assert.True(t, loaded)
+	assert.ElementsMatch(t, []*models.Campaign{live, nearlySpent, house}, campaigns)
+
+	s.addIndexedSpend(nearlySpent.ID, 1)
+	assert.Equal(t, 99.0, nearlySpent.SpentDaily, "cached campaigns are replaced, not mutated")
+
+	campaigns, _ = s.indexedActiveCampaigns(now)
+	assert.ElementsMatch(t, []*models.Campaign{live, house}, campaigns)
+}
+
+func campaignRow(id uuid.UUID, name string, spent float64, updatedAt time.Time) []driver.Value {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	return []driver.Value{
+		id.String(), name, "adv-1", nil, nil, []byte(`["IAB1"]`), nil,
+		"active", 100.0, 1000.0, spent, spent, "cpm", 2.0, nil,
+		nil, nil, []byte(`{"geo_targeting": ["US"]}`), nil,
+		start, nil, start, updatedAt, nil, "price_priority", nil,
+	}
+}
+
+func TestIndex_ResyncVersion(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	s := NewService(db, nil, nil, nil, logrus.New())
+	ctx := context.Background()
+	columns := strings.Fields(strings.ReplaceAll(campaignColumns, ",", " "))
+	first, second := uuid.New(), uuid.New()
+	now := time.Now().UTC()
+
+	mock.OnQuery("FROM campaigns", columns)
+	require.NoError(t, s.Resync(ctx))
+	assert.Equal(t, uint64(1), s.IndexVersion(), "loading an empty index still marks it loaded")
+
+	mock.OnQuery("FROM campaigns", columns, campaignRow(first, "First", 0, now), campaignRow(second, "Second", 0, now))
+	require.NoError(t, s.Resync(ctx))
+	assert.Equal(t, uint64(2), s.IndexVersion())
+
+	s.addIndexedSpend(first, 5)
+	mock.OnQuery("FROM campaigns", columns, campaignRow(first, "First", 5, now.Add(time.Minute)), campaignRow(second, "Second", 0, now))
+	require.NoError(t, s.Resync(ctx))
+	assert.Equal(t, uint64(2), s.IndexVersion(), "spend alone doesn't change the version")
+
+	mock.OnQuery("FROM campaigns", columns, campaignRow(first, "First", 5, now), campaignRow(second, "Renamed", 0, now))
+	require.NoError(t, s.Resync(ctx))
+	assert.Equal(t, uint64(3), s.IndexVersion())
+
+	mock.OnQuery("FROM campaigns", columns, campaignRow(first, "First", 5, now))
+	require.NoError(t, s.Resync(ctx))
+	assert.Equal(t, uint64(4), s.IndexVersion())
+}
@@ -0,0 +1,48 @@
+package campaign
+
+import (
+	"math"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+// deliveryPacingRate paces a guaranteed campaign toward its delivery goal
+// using the billed impressions counted in Redis.
+func (s *Service) deliveryPacingRate(campaign *models.Campaign, now time.Time) (float64, error) {
+	total, today, err := s.redis.GetDelivery(campaign.ID.String(), now.Format("2006-01-02"))
+	if err != nil {
+		return 1.0, err
+	}
+	return deliveryPacing(campaign.DeliveryGoal.Impressions, *campaign.EndDate, total, today, now), nil
+}
+
+// deliveryPacing spreads what is left of a delivery goal at the start of the
+// day evenly over the remaining days of the flight, and within the day by
+// time of day. Campaigns behind the day's curve bid on everything; campaigns
+// ahead of it are throttled, and stop once the day's share is delivered.
+func deliveryPacing(goal int64, end time.Time, deliveredTotal, deliveredToday int64, now time.Time) float64 {
+	if deliveredTotal >= goal {
+		return 0
+	}
+
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	daysLeft := math.Max(1, math.Ceil(end.Sub(dayStart).Hours()/24))
+	dailyTarget := float64(goal-(deliveredTotal-deliveredToday)) / daysLeft
+
+	delivered := float64(deliveredToday)
+	if delivered >= dailyTarget {
+		return 0
+	}
+
+	dayProgress := float64(now.Hour()*60+now.Minute()) / (24.0 * 60.0)
+	expected := dailyTarget * dayProgress
+
+	if delivered > expected*1.2 {
+		return 0.5
+	} else if delivered > expected {
+		return 0.8
+	}
+
+	return 1.0
+}
@@ -0,0 +1,34 @@
+package campaign
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliveryPacing(t *testing.T) {
+	noon := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	end := noon.AddDate(0, 0, 10)
+
+	tests := []struct {
+		name           string
+		deliveredTotal int64
+		deliveredToday int64
+		expected       float64
+	}{
+		{name: "Behind the day's curve", deliveredTotal: 200, deliveredToday: 200, expected: 1.0},
+		{name: "Slightly ahead", deliveredTotal: 550, deliveredToday: 550, expected: 0.8},
+		{name: "Well ahead", deliveredTotal: 700, deliveredToday: 700, expected: 0.5},
+		{name: "Day's share delivered", deliveredTotal: 1000, deliveredToday: 1000, expected: 0},
+		{name: "Goal delivered", deliveredTotal: 11000, deliveredToday: 0, expected: 0},
+		{name: "Ahead from earlier days", deliveredTotal: 5950, deliveredToday: 450, expected: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 11000 over 11 days: 1000 a day, 500 expected by noon.
+			assert.Equal(t, tt.expected, deliveryPacing(11000, end, tt.deliveredTotal, tt.deliveredToday, noon))
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/ad-delivery-simulator/internal/models"
@@ -14,12 +15,28 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const campaignColumns = `
+	id, name, advertiser_id, seat, advertiser_domains, categories, app_bundle,
+	status, budget_daily, budget_total,
+	spent_daily, spent_total, bid_type, bid_amount, bid_strategy,
+	bid_strategy_params, deal_ids, targeting_rules, frequency_capping,
+	start_date, end_date, created_at, updated_at, competitive_labels,
+	priority, delivery_goal`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
 type Service struct {
 	db       *sql.DB
 	redis    *redis.Client
 	kafka    *kafka.Producer
 	logger   *logrus.Logger
 	brokers  []string
+
+	mu      sync.RWMutex
+	index   map[uuid.UUID]*models.Campaign
+	version uint64
 }
 
 func NewService(db *sql.DB, redisClient *redis.Client, kafkaProducer *kafka.Producer, brokers []string, logger *logrus.Logger) *Service {
@@ -40,22 +57,36 @@ func (s *Service) CreateCampaign(ctx context.Context, campaign *models.Campaign)
 	campaign.SpentDaily = 0
 	campaign.SpentTotal = 0
 
+	if err := ValidateCampaign(campaign); err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO campaigns (
-			id, name, advertiser_id, status, budget_daily, budget_total,
-			spent_daily, spent_total, bid_type, bid_amount, targeting_rules,
-			frequency_capping, start_date, end_date, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		INSERT INTO campaigns (` + campaignColumns + `
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
+			$13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24,
+			$25, $26
+		)
 	`
 
+	domainsJSON, _ := json.Marshal(campaign.AdvertiserDomains)
+	categoriesJSON, _ := json.Marshal(campaign.Categories)
+	strategyParamsJSON, _ := json.Marshal(campaign.BidStrategyParams)
+	dealIDsJSON, _ := json.Marshal(campaign.DealIDs)
 	targetingJSON, _ := json.Marshal(campaign.TargetingRules)
 	frequencyJSON, _ := json.Marshal(campaign.FrequencyCapping)
+	labelsJSON, _ := json.Marshal(campaign.CompetitiveLabels)
+	goalJSON, _ := json.Marshal(campaign.DeliveryGoal)
 
 	_, err := s.db.ExecContext(ctx, query,
-		campaign.ID, campaign.Name, campaign.AdvertiserID, campaign.Status,
+		campaign.ID, campaign.Name, campaign.AdvertiserID, campaign.Seat,
+		domainsJSON, categoriesJSON, campaign.AppBundle, campaign.Status,
 		campaign.BudgetDaily, campaign.BudgetTotal, campaign.SpentDaily, campaign.SpentTotal,
-		campaign.BidType, campaign.BidAmount, targetingJSON, frequencyJSON,
+		campaign.BidType, campaign.BidAmount, campaign.BidStrategy, strategyParamsJSON,
+		dealIDsJSON, targetingJSON, frequencyJSON,
 		campaign.StartDate, campaign.EndDate, campaign.CreatedAt, campaign.UpdatedAt,
+		labelsJSON, campaign.Priority, goalJSON,
 	)
 
 	if err != nil {
@@ -72,41 +103,72 @@ func (s *Service) CreateCampaign(ctx context.Context, campaign *models.Campaign)
 }
 
 func (s *Service) GetCampaign(ctx context.Context, campaignID uuid.UUID) (*models.Campaign, error) {
-	query := `
-		SELECT id, name, advertiser_id, status, budget_daily, budget_total,
-			spent_daily, spent_total, bid_type, bid_amount, targeting_rules,
-			frequency_capping, start_date, end_date, created_at, updated_at
-		FROM campaigns WHERE id = $1
-	`
+	query := `SELECT ` + campaignColumns + ` FROM campaigns WHERE id = $1`
+
+	campaign, err := scanCampaign(s.db.QueryRowContext(ctx, query, campaignID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("campaign not found")
+		}
+		return nil, fmt.Errorf("failed to get campaign: %w", err)
+	}
 
+	return campaign, nil
+}
+
+func scanCampaign(row rowScanner) (*models.Campaign, error) {
 	campaign := &models.Campaign{}
-	var targetingJSON, frequencyJSON []byte
+	var seat, appBundle, strategy, priority sql.NullString
+	var domainsJSON, categoriesJSON []byte
+	var strategyParamsJSON, dealIDsJSON, targetingJSON, frequencyJSON, labelsJSON, goalJSON []byte
 	var endDate sql.NullTime
 
-	err := s.db.QueryRowContext(ctx, query, campaignID).Scan(
-		&campaign.ID, &campaign.Name, &campaign.AdvertiserID, &campaign.Status,
+	err := row.Scan(
+		&campaign.ID, &campaign.Name, &campaign.AdvertiserID, &seat,
+		&domainsJSON, &categoriesJSON, &appBundle, &campaign.Status,
 		&campaign.BudgetDaily, &campaign.BudgetTotal, &campaign.SpentDaily, &campaign.SpentTotal,
-		&campaign.BidType, &campaign.BidAmount, &targetingJSON, &frequencyJSON,
+		&campaign.BidType, &campaign.BidAmount, &strategy, &strategyParamsJSON,
+		&dealIDsJSON, &targetingJSON, &frequencyJSON,
 		&campaign.StartDate, &endDate, &campaign.CreatedAt, &campaign.UpdatedAt,
+		&labelsJSON, &priority, &goalJSON,
 	)
-
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("campaign not found")
-		}
-		return nil, fmt.Errorf("failed to get campaign: %w", err)
+		return nil, err
 	}
 
+	campaign.Seat = seat.String
+	campaign.AppBundle = appBundle.String
+	campaign.BidStrategy = strategy.String
+	campaign.Priority = models.CampaignPriority(priority.String)
+
 	if endDate.Valid {
 		campaign.EndDate = &endDate.Time
 	}
 
+	if len(domainsJSON) > 0 {
+		json.Unmarshal(domainsJSON, &campaign.AdvertiserDomains)
+	}
+	if len(categoriesJSON) > 0 {
+		json.Unmarshal(categoriesJSON, &campaign.Categories)
+	}
+	if len(strategyParamsJSON) > 0 {
+		json.Unmarshal(strategyParamsJSON, &campaign.BidStrategyParams)
+	}
+	if len(dealIDsJSON) > 0 {
+		json.Unmarshal(dealIDsJSON, &campaign.DealIDs)
+	}
 	if len(targetingJSON) > 0 {
 		json.Unmarshal(targetingJSON, &campaign.TargetingRules)
 	}
 	if len(frequencyJSON) > 0 {
 		json.Unmarshal(frequencyJSON, &campaign.FrequencyCapping)
 	}
+	if len(labelsJSON) > 0 {
+		json.Unmarshal(labelsJSON, &campaign.CompetitiveLabels)
+	}
+	if len(goalJSON) > 0 {
+		json.Unmarshal(goalJSON, &campaign.DeliveryGoal)
+	}
 
 	return campaign, nil
 }
@@ -114,21 +176,35 @@ func (s *Service) GetCampaign(ctx context.Context, campaignID uuid.UUID) (*model
 func (s *Service) UpdateCampaign(ctx context.Context, campaign *models.Campaign) error {
 	campaign.UpdatedAt = time.Now()
 
+	if err := ValidateCampaign(campaign); err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE campaigns SET
 			name = $2, status = $3, budget_daily = $4, budget_total = $5,
-			bid_type = $6, bid_amount = $7, targeting_rules = $8,
-			frequency_capping = $9, end_date = $10, updated_at = $11
+			bid_type = $6, bid_amount = $7, bid_strategy = $8, bid_strategy_params = $9,
+			deal_ids = $10, targeting_rules = $11, frequency_capping = $12, end_date = $13,
+			updated_at = $14, seat = $15, advertiser_domains = $16, categories = $17,
+			app_bundle = $18, competitive_labels = $19, priority = $20, delivery_goal = $21
 		WHERE id = $1
 	`
 
+	domainsJSON, _ := json.Marshal(campaign.AdvertiserDomains)
+	categoriesJSON, _ := json.Marshal(campaign.Categories)
+	strategyParamsJSON, _ := json.Marshal(campaign.BidStrategyParams)
+	dealIDsJSON, _ := json.Marshal(campaign.DealIDs)
 	targetingJSON, _ := json.Marshal(campaign.TargetingRules)
 	frequencyJSON, _ := json.Marshal(campaign.FrequencyCapping)
+	labelsJSON, _ := json.Marshal(campaign.CompetitiveLabels)
+	goalJSON, _ := json.Marshal(campaign.DeliveryGoal)
 
 	_, err := s.db.ExecContext(ctx, query,
 		campaign.ID, campaign.Name, campaign.Status, campaign.BudgetDaily, campaign.BudgetTotal,
-		campaign.BidType, campaign.BidAmount, targetingJSON, frequencyJSON,
-		campaign.EndDate, campaign.UpdatedAt,
+		campaign.BidType, campaign.BidAmount, campaign.BidStrategy, strategyParamsJSON,
+		dealIDsJSON, targetingJSON, frequencyJSON, campaign.EndDate, campaign.UpdatedAt,
+		campaign.Seat, domainsJSON, categoriesJSON, campaign.AppBundle, labelsJSON,
+		campaign.Priority, goalJSON,
 	)
 
 	if err != nil {
@@ -145,19 +221,23 @@ func (s *Service) UpdateCampaign(ctx context.Context, campaign *models.Campaign)
 }
 
 func (s *Service) ListActiveCampaigns(ctx context.Context) ([]*models.Campaign, error) {
+	if campaigns, loaded := s.indexedActiveCampaigns(time.Now()); loaded {
+		return campaigns, nil
+	}
+	return s.queryActiveCampaigns(ctx)
+}
+
+func (s *Service) queryActiveCampaigns(ctx context.Context) ([]*models.Campaign, error) {
 	query := `
-		SELECT id, name, advertiser_id, status, budget_daily, budget_total,
-			spent_daily, spent_total, bid_type, bid_amount, targeting_rules,
-			frequency_capping, start_date, end_date, created_at, updated_at
+		SELECT ` + campaignColumns + `
 		FROM campaigns 
 		WHERE status = $1 
 			AND start_date <= NOW() 
 			AND (end_date IS NULL OR end_date > NOW())
-			AND spent_total < budget_total
-			AND spent_daily < budget_daily
+			AND (priority = $2 OR (spent_total < budget_total AND spent_daily < budget_daily))
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, models.CampaignStatusActive)
+	rows, err := s.db.QueryContext(ctx, query, models.CampaignStatusActive, models.PriorityHouse)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list active campaigns: %w", err)
 	}
@@ -165,33 +245,12 @@ func (s *Service) ListActiveCampaigns(ctx context.Context) ([]*models.Campaign,
 
 	var campaigns []*models.Campaign
 	for rows.Next() {
-		campaign := &models.Campaign{}
-		var targetingJSON, frequencyJSON []byte
-		var endDate sql.NullTime
-
-		err := rows.Scan(
-			&campaign.ID, &campaign.Name, &campaign.AdvertiserID, &campaign.Status,
-			&campaign.BudgetDaily, &campaign.BudgetTotal, &campaign.SpentDaily, &campaign.SpentTotal,
-			&campaign.BidType, &campaign.BidAmount, &targetingJSON, &frequencyJSON,
-			&campaign.StartDate, &endDate, &campaign.CreatedAt, &campaign.UpdatedAt,
-		)
-
+		campaign, err := scanCampaign(rows)
 		if err != nil {
 			s.logger.WithError(err).Error("Failed to scan campaign")
 			continue
 		}
 
-		if endDate.Valid {
-			campaign.EndDate = &endDate.Time
-		}
-
-		if len(targetingJSON) > 0 {
-			json.Unmarshal(targetingJSON, &campaign.TargetingRules)
-		}
-		if len(frequencyJSON) > 0 {
-			json.Unmarshal(frequencyJSON, &campaign.FrequencyCapping)
-		}
-
 		campaigns = append(campaigns, campaign)
 	}
 
@@ -217,6 +276,111 @@ func (s *Service) CheckAndDecrementBudget(ctx context.Context, campaignID uuid.U
 	return true, nil
 }
 
+// HoldBudget reserves a winning bid's price until its billing notice arrives.
+// Spend is only written to the database once the hold is billed.
+func (s *Service) HoldBudget(ctx context.Context, hold *models.BudgetHold, ttl time.Duration) (bool, error) {
+	allowed, err := s.redis.HoldBudget(hold.BidID, redis.BudgetHold{
+		CampaignID: hold.CampaignID.String(),
+		AuctionID:  hold.AuctionID,
+		Amount:     hold.Amount,
+		Test:       hold.Test,
+	}, ttl)
+	if err != nil {
+		return false, fmt.Errorf("failed to hold budget: %w", err)
+	}
+
+	if !allowed {
+		s.logger.WithFields(logrus.Fields{
+			"campaign_id": hold.CampaignID,
+			"bid_id":      hold.BidID,
+			"amount":      hold.Amount,
+		}).Debug("Budget hold failed")
+	}
+
+	return allowed, nil
+}
+
+// BudgetHold returns the bid's pending hold, nil when there is none.
+func (s *Service) BudgetHold(ctx context.Context, bidID string) (*models.BudgetHold, error) {
+	hold, err := s.redis.GetBudgetHold(bidID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budget hold: %w", err)
+	}
+	return budgetHold(bidID, hold)
+}
+
+// BillBudgetHold converts a hold into spend at the billed price and returns
+// it with the amount charged. Any part of the hold above the billed price
+// goes back to the campaign's budget. The hold is nil when none is pending.
+func (s *Service) BillBudgetHold(ctx context.Context, bidID string, price float64) (*models.BudgetHold, float64, error) {
+	settled, charged, err := s.redis.SettleBudgetHold(bidID, price)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to bill budget hold: %w", err)
+	}
+
+	hold, err := budgetHold(bidID, settled)
+	if err != nil || hold == nil {
+		return nil, 0, err
+	}
+
+	if !hold.Test {
+		go s.updateSpentInDB(context.Background(), hold.CampaignID, charged)
+	}
+
+	return hold, charged, nil
+}
+
+// ReleaseBudgetHold returns a held amount to the campaign's budget. The hold
+// is nil when none was pending.
+func (s *Service) ReleaseBudgetHold(ctx context.Context, bidID string) (*models.BudgetHold, error) {
+	settled, _, err := s.redis.SettleBudgetHold(bidID, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release budget hold: %w", err)
+	}
+	return budgetHold(bidID, settled)
+}
+
+func budgetHold(bidID string, hold *redis.BudgetHold) (*models.BudgetHold, error) {
+	if hold == nil {
+		return nil, nil
+	}
+
+	campaignID, err := uuid.Parse(hold.CampaignID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid campaign ID on budget hold: %w", err)
+	}
+
+	return &models.BudgetHold{
+		BidID:      bidID,
+		CampaignID: campaignID,
+		AuctionID:  hold.AuctionID,
+		Amount:     hold.Amount,
+		Test:       hold.Test,
+	}, nil
+}
+
+// ReleaseExpiredHolds releases every hold whose billing notice never arrived.
+func (s *Service) ReleaseExpiredHolds(ctx context.Context) (int, error) {
+	bidIDs, err := s.redis.ExpiredBudgetHolds(time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expired budget holds: %w", err)
+	}
+
+	released := 0
+	for _, bidID := range bidIDs {
+		hold, err := s.ReleaseBudgetHold(ctx, bidID)
+		if err != nil {
+			s.logger.WithError(err).WithField("bid_id", bidID).Error("Failed to release expired budget hold")
+			continue
+		}
+		if hold != nil {
+			released++
+		}
+	}
+
+	return released, nil
+}
+
 func (s *Service) updateSpentInDB(ctx context.Context, campaignID uuid.UUID, amount float64) {
 	query := `
 		UPDATE campaigns 
@@ -228,11 +392,14 @@ func (s *Service) updateSpentInDB(ctx context.Context, campaignID uuid.UUID, amo
 
 	if _, err := s.db.ExecContext(ctx, query, campaignID, amount); err != nil {
 		s.logger.WithError(err).WithField("campaign_id", campaignID).Error("Failed to update spent in database")
+		return
 	}
+
+	s.addIndexedSpend(campaignID, amount)
 }
 
 func (s *Service) CheckFrequencyCap(ctx context.Context, userID string, campaignID uuid.UUID, eventType string) (bool, error) {
-	campaign, err := s.GetCampaign(ctx, campaignID)
+	campaign, err := s.lookupCampaign(ctx, campaignID)
 	if err != nil {
 		return false, err
 	}
@@ -261,7 +428,7 @@ func (s *Service) CheckFrequencyCap(ctx context.Context, userID string, campaign
 }
 
 func (s *Service) IncrementFrequencyCap(ctx context.Context, userID string, campaignID uuid.UUID, eventType string) error {
-	campaign, err := s.GetCampaign(ctx, campaignID)
+	campaign, err := s.lookupCampaign(ctx, campaignID)
 	if err != nil {
 		return err
 	}
@@ -274,13 +441,40 @@ func (s *Service) IncrementFrequencyCap(ctx context.Context, userID string, camp
 	return err
 }
 
+// UserSegments returns the segments stored in the user's profile.
+func (s *Service) UserSegments(ctx context.Context, userID string) ([]string, error) {
+	segments, err := s.redis.GetUserSegments(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user segments: %w", err)
+	}
+	return segments, nil
+}
+
+// SetUserSegments replaces the segments in the user's profile.
+func (s *Service) SetUserSegments(ctx context.Context, userID string, segments []string, ttl time.Duration) error {
+	if err := s.redis.SetUserSegments(userID, segments, ttl); err != nil {
+		return fmt.Errorf("failed to set user segments: %w", err)
+	}
+	return nil
+}
+
 func (s *Service) CalculatePacingRate(ctx context.Context, campaignID uuid.UUID) (float64, error) {
-	campaign, err := s.GetCampaign(ctx, campaignID)
+	campaign, err := s.lookupCampaign(ctx, campaignID)
 	if err != nil {
 		return 1.0, err
 	}
 
 	now := time.Now()
+
+	switch campaign.Priority {
+	case models.PrioritySponsorship, models.PriorityHouse:
+		return 1.0, nil
+	case models.PriorityGuaranteed:
+		if campaign.DeliveryGoal != nil && campaign.EndDate != nil {
+			return s.deliveryPacingRate(campaign, now)
+		}
+	}
+
 	dayProgress := float64(now.Hour()*60+now.Minute()) / (24.0 * 60.0)
 	
 	budgetProgress := campaign.SpentDaily / campaign.BudgetDaily
@@ -332,11 +526,17 @@ func (s *Service) ResetDailyBudgets(ctx context.Context) error {
 		return fmt.Errorf("failed to reset daily budgets: %w", err)
 	}
 
-	campaigns, err := s.ListActiveCampaigns(ctx)
+	campaigns, err := s.queryActiveCampaigns(ctx)
 	if err != nil {
 		return err
 	}
 
+	if s.indexLoaded() {
+		if err := s.Resync(ctx); err != nil {
+			s.logger.WithError(err).Error("Failed to resync campaign index after budget reset")
+		}
+	}
+
 	for _, campaign := range campaigns {
 		if err := s.redis.SetCampaignBudget(campaign.ID.String(), campaign.BudgetDaily, campaign.BudgetTotal-campaign.SpentTotal); err != nil {
 			s.logger.WithError(err).WithField("campaign_id", campaign.ID).Error("Failed to reset budget in Redis")
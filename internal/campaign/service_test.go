@@ -0,0 +1,111 @@
+package campaign
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/sqltest"
+	"github.com/ad-delivery-simulator/pkg/redis"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHoldService(t *testing.T) (*Service, *sqltest.DB, *redis.Client) {
+	server := miniredis.RunT(t)
+	redisClient, err := redis.NewClient(server.Addr(), "", 0, logrus.New())
+	require.NoError(t, err)
+	t.Cleanup(func() { redisClient.Close() })
+
+	db, mock := sqltest.Open(t)
+	mock.OnExec("UPDATE campaigns", 1)
+	return NewService(db, redisClient, nil, nil, logrus.New()), mock, redisClient
+}
+
+func TestService_BudgetHolds(t *testing.T) {
+	s, mock, redisClient := newHoldService(t)
+	ctx := context.Background()
+	campaignID := uuid.New()
+	require.NoError(t, redisClient.SetCampaignBudget(campaignID.String(), 10, 100))
+
+	held := &models.BudgetHold{BidID: "bid-1", CampaignID: campaignID, AuctionID: "auction-1", Amount: 4}
+	allowed, err := s.HoldBudget(ctx, held, time.Minute)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	hold, err := s.BudgetHold(ctx, "bid-1")
+	require.NoError(t, err)
+	assert.Equal(t, held, hold)
+
+	hold, charged, err := s.BillBudgetHold(ctx, "bid-1", 3)
+	require.NoError(t, err)
+	assert.Equal(t, held, hold)
+	assert.Equal(t, 3.0, charged)
+
+	assert.Eventually(t, func() bool { return len(mock.Calls("UPDATE campaigns")) == 1 }, time.Second, 10*time.Millisecond)
+	spend := mock.Calls("UPDATE campaigns")[0]
+	assert.Equal(t, campaignID.String(), spend.Args[0])
+	assert.Equal(t, 3.0, spend.Args[1])
+
+	hold, _, err = s.BillBudgetHold(ctx, "bid-1", 3)
+	require.NoError(t, err)
+	assert.Nil(t, hold, "a hold is billed once")
+
+	hold, err = s.ReleaseBudgetHold(ctx, "bid-1")
+	require.NoError(t, err)
+	assert.Nil(t, hold)
+}
+
+func TestService_BillTestBudgetHold(t *testing.T) {
+	s, mock, _ := newHoldService(t)
+	ctx := context.Background()
+
+	allowed, err := s.HoldBudget(ctx, &models.BudgetHold{BidID: "bid-1", CampaignID: uuid.New(), Amount: 4, Test: true}, time.Minute)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	hold, _, err := s.BillBudgetHold(ctx, "bid-1", 4)
+	require.NoError(t, err)
+	assert.True(t, hold.Test)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, mock.Calls("UPDATE campaigns"), "test bids spend nothing")
+}
+
+func TestService_ReleaseExpiredHolds(t *testing.T) {
+	s, mock, redisClient := newHoldService(t)
+	ctx := context.Background()
+	campaignID := uuid.New()
+	require.NoError(t, redisClient.SetCampaignBudget(campaignID.String(), 10, 100))
+
+	for bidID, ttl := range map[string]time.Duration{"expired": -time.Minute, "pending": time.Minute} {
+		allowed, err := s.HoldBudget(ctx, &models.BudgetHold{BidID: bidID, CampaignID: campaignID, Amount: 2}, ttl)
+		require.NoError(t, err)
+		require.True(t, allowed)
+	}
+
+	released, err := s.ReleaseExpiredHolds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	hold, err := s.BudgetHold(ctx, "expired")
+	require.NoError(t, err)
+	assert.Nil(t, hold)
+
+	hold, err = s.BudgetHold(ctx, "pending")
+	require.NoError(t, err)
+	assert.NotNil(t, hold)
+
+	allowed, err := s.HoldBudget(ctx, &models.BudgetHold{BidID: "bid-3", CampaignID: campaignID, Amount: 8}, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, allowed, "the released amount is back in the daily budget")
+
+	released, err = s.ReleaseExpiredHolds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, released)
+	assert.Empty(t, mock.Calls("UPDATE campaigns"), "released holds spend nothing")
+}
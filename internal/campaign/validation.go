@@ -0,0 +1,198 @@
+package campaign
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/ad-delivery-simulator/internal/bidding"
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/targeting"
+)
+
+var iabCategoryPattern = regexp.MustCompile(`^IAB[0-9]+(-[0-9]+)?$`)
+
+func ValidateCampaign(campaign *models.Campaign) error {
+	if _, err := bidding.ForCampaign(campaign); err != nil {
+		return &models.ValidationError{Field: "bid_strategy", Message: err.Error()}
+	}
+
+	for _, category := range campaign.Categories {
+		if !iabCategoryPattern.MatchString(category) {
+			return &models.ValidationError{Field: "categories", Message: fmt.Sprintf("%q is not an IAB category", category)}
+		}
+	}
+
+	switch campaign.Priority {
+	case "", models.PrioritySponsorship, models.PriorityGuaranteed, models.PriorityPricePriority, models.PriorityHouse:
+	default:
+		return &models.ValidationError{Field: "priority", Message: fmt.Sprintf("must be %q, %q, %q or %q",
+			models.PrioritySponsorship, models.PriorityGuaranteed, models.PriorityPricePriority, models.PriorityHouse)}
+	}
+
+	if campaign.Priority == models.PriorityGuaranteed {
+		if campaign.DeliveryGoal == nil || campaign.DeliveryGoal.Impressions <= 0 {
+			return &models.ValidationError{Field: "delivery_goal", Message: "guaranteed campaigns need an impression goal"}
+		}
+		if campaign.EndDate == nil {
+			return &models.ValidationError{Field: "end_date", Message: "guaranteed campaigns need an end date"}
+		}
+	} else if campaign.DeliveryGoal != nil {
+		return &models.ValidationError{Field: "delivery_goal", Message: "only guaranteed campaigns have delivery goals"}
+	}
+
+	for i, label := range campaign.CompetitiveLabels {
+		if label == "" {
+			return &models.ValidationError{Field: fmt.Sprintf("competitive_labels[%d]", i), Message: "label is empty"}
+		}
+	}
+
+	if campaign.TargetingRules != nil {
+		for i, rule := range campaign.TargetingRules.Geo {
+			if err := validateGeoRule(rule); err != nil {
+				return &models.ValidationError{Field: fmt.Sprintf("targeting_rules.geo[%d]", i), Message: err.Error()}
+			}
+		}
+
+		for i, rule := range campaign.TargetingRules.DayParting {
+			if err := validateDayPart(rule); err != nil {
+				return &models.ValidationError{Field: fmt.Sprintf("targeting_rules.day_parting[%d]", i), Message: err.Error()}
+			}
+		}
+		if _, err := campaign.TargetingRules.DayPartLocation(); err != nil {
+			return &models.ValidationError{Field: "targeting_rules.day_part_timezone", Message: fmt.Sprintf("unknown timezone %q", campaign.TargetingRules.DayPartTimezone)}
+		}
+
+		if device := campaign.TargetingRules.Device; device != nil {
+			if err := validateDevice(device); err != nil {
+				return &models.ValidationError{Field: "targeting_rules.device", Message: err.Error()}
+			}
+		}
+
+		if content := campaign.TargetingRules.Content; content != nil {
+			if err := validateContent(content); err != nil {
+				return &models.ValidationError{Field: "targeting_rules.content", Message: err.Error()}
+			}
+		}
+
+		if kv := campaign.TargetingRules.KeyValues; kv != nil {
+			if kv.Match != "" && kv.Match != models.KeyValueMatchAll && kv.Match != models.KeyValueMatchAny {
+				return &models.ValidationError{Field: "targeting_rules.key_values.match", Message: fmt.Sprintf("must be %q or %q", models.KeyValueMatchAll, models.KeyValueMatchAny)}
+			}
+			for key, values := range kv.Values {
+				if len(values) == 0 {
+					return &models.ValidationError{Field: "targeting_rules.key_values.values", Message: fmt.Sprintf("key %q has no values", key)}
+				}
+			}
+		}
+
+		if expression := campaign.TargetingRules.Expression; expression != "" {
+			if _, err := targeting.Compile(expression); err != nil {
+				validationErr := &models.ValidationError{Field: "targeting_rules.expression", Message: err.Error()}
+				if exprErr, ok := err.(*targeting.Error); ok {
+					validationErr.Message, validationErr.Line, validationErr.Column = exprErr.Message, exprErr.Line, exprErr.Column
+				}
+				return validationErr
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateGeoRule(rule models.GeoRule) error {
+	if rule.Mode != models.GeoModeInclude && rule.Mode != models.GeoModeExclude {
+		return fmt.Errorf("mode must be %q or %q", models.GeoModeInclude, models.GeoModeExclude)
+	}
+
+	if rule.RadiusKM < 0 {
+		return fmt.Errorf("radius_km must not be negative")
+	}
+	if rule.RadiusKM > 0 && (rule.Lat < -90 || rule.Lat > 90 || rule.Lon < -180 || rule.Lon > 180) {
+		return fmt.Errorf("lat/lon out of range")
+	}
+	if (rule.Lat != 0 || rule.Lon != 0) && rule.RadiusKM == 0 {
+		return fmt.Errorf("lat/lon require radius_km")
+	}
+
+	if rule.Country == "" && rule.Region == "" && rule.Metro == "" && rule.City == "" && rule.ZIP == "" && rule.RadiusKM == 0 {
+		return fmt.Errorf("rule must set a country, region, metro, city, zip or radius")
+	}
+
+	return nil
+}
+
+func validateDayPart(rule models.DayPartRule) error {
+	if rule.DayOfWeek < 0 || rule.DayOfWeek > 6 {
+		return fmt.Errorf("day_of_week must be between 0 (Sunday) and 6")
+	}
+	if rule.StartHour < 0 || rule.StartHour > 23 {
+		return fmt.Errorf("start_hour must be between 0 and 23")
+	}
+	if rule.EndHour < 0 || rule.EndHour > 24 {
+		return fmt.Errorf("end_hour must be between 0 and 24")
+	}
+	if rule.StartHour == rule.EndHour {
+		return fmt.Errorf("start_hour and end_hour must differ; use 0 and 24 for a whole day")
+	}
+	return nil
+}
+
+func validateContent(content *models.ContentTargeting) error {
+	for _, categories := range [][]string{content.IncludeCategories, content.ExcludeCategories} {
+		for _, category := range categories {
+			if !iabCategoryPattern.MatchString(category) {
+				return fmt.Errorf("%q is not an IAB category", category)
+			}
+		}
+	}
+
+	if content.MaxMediaRating < 0 || content.MaxMediaRating > 3 {
+		return fmt.Errorf("max_media_rating must be between 1 and 3")
+	}
+	return nil
+}
+
+func validateDevice(device *models.DeviceTargeting) error {
+	if device.InventoryType != "" && device.InventoryType != models.InventoryApp && device.InventoryType != models.InventorySite {
+		return fmt.Errorf("inventory_type must be %q or %q", models.InventoryApp, models.InventorySite)
+	}
+
+	if device.OS != nil {
+		for _, ranges := range [][]models.OSRange{device.OS.Include, device.OS.Exclude} {
+			for _, r := range ranges {
+				if err := validateOSRange(r); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if device.ConnectionTypes != nil {
+		for _, connection := range append(device.ConnectionTypes.Include, device.ConnectionTypes.Exclude...) {
+			if n, err := strconv.Atoi(connection); err != nil || n < 0 {
+				return fmt.Errorf("connection type %q is not an OpenRTB connectiontype code", connection)
+			}
+		}
+	}
+	return nil
+}
+
+func validateOSRange(r models.OSRange) error {
+	if r.OS == "" {
+		return fmt.Errorf("os range needs an os")
+	}
+
+	for _, version := range []string{r.MinVersion, r.MaxVersion} {
+		if _, ok := models.ParseVersion(version); version != "" && !ok {
+			return fmt.Errorf("%q is not a version such as \"17.4\"", version)
+		}
+	}
+
+	if r.MinVersion != "" && r.MaxVersion != "" {
+		if matched, _ := (models.OSRange{OS: r.OS, MaxVersion: r.MaxVersion}).Contains(r.OS, r.MinVersion); !matched {
+			return fmt.Errorf("%s min_version %s is above max_version %s", r.OS, r.MinVersion, r.MaxVersion)
+		}
+	}
+	return nil
+}
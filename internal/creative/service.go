@@ -0,0 +1,327 @@
+package creative
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const creativeColumns = `
+	id, campaign_id, name, type, format, width, height, asset_url,
+	click_url, impression_url, html, duration, mime_type, skippable,
+	skip_offset, native_assets, status, created_at, updated_at`
+
+type Service struct {
+	db         *sql.DB
+	logger     *logrus.Logger
+	mu         sync.RWMutex
+	byCampaign map[uuid.UUID][]*models.AdCreative
+}
+
+func NewService(db *sql.DB, logger *logrus.Logger) *Service {
+	return &Service{
+		db:         db,
+		logger:     logger,
+		byCampaign: make(map[uuid.UUID][]*models.AdCreative),
+	}
+}
+
+func (s *Service) Start(ctx context.Context, refreshInterval time.Duration) error {
+	if err := s.Refresh(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Refresh(ctx); err != nil {
+					s.logger.WithError(err).Error("Failed to refresh creatives")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *Service) Refresh(ctx context.Context) error {
+	query := `SELECT ` + creativeColumns + ` FROM ad_creatives WHERE status = $1`
+
+	rows, err := s.db.QueryContext(ctx, query, models.CreativeStatusActive)
+	if err != nil {
+		return fmt.Errorf("failed to load creatives: %w", err)
+	}
+	defer rows.Close()
+
+	byCampaign := make(map[uuid.UUID][]*models.AdCreative)
+	for rows.Next() {
+		creative, err := scanCreative(rows)
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to scan creative")
+			continue
+		}
+		byCampaign[creative.CampaignID] = append(byCampaign[creative.CampaignID], creative)
+	}
+
+	s.mu.Lock()
+	s.byCampaign = byCampaign
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Service) ActiveCreatives(campaignID uuid.UUID) []*models.AdCreative {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.byCampaign[campaignID]
+}
+
+func (s *Service) CreateCreative(ctx context.Context, creative *models.AdCreative) error {
+	if creative.Status == "" {
+		creative.Status = models.CreativeStatusActive
+	}
+	if err := validateCreative(creative); err != nil {
+		return err
+	}
+
+	creative.ID = uuid.New()
+	creative.CreatedAt = time.Now()
+	creative.UpdatedAt = time.Now()
+
+	nativeJSON, _ := nativeAssetsJSON(creative)
+
+	query := `
+		INSERT INTO ad_creatives (` + creativeColumns + `
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		creative.ID, creative.CampaignID, creative.Name, creative.Type, creative.Format,
+		creative.Width, creative.Height, creative.AssetURL, creative.ClickURL,
+		creative.ImpressionURL, creative.HTML, creative.Duration, creative.MIMEType,
+		creative.Skippable, creative.SkipOffset, nativeJSON, creative.Status, creative.CreatedAt, creative.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create creative: %w", err)
+	}
+
+	s.store(creative)
+	return nil
+}
+
+func (s *Service) GetCreative(ctx context.Context, creativeID uuid.UUID) (*models.AdCreative, error) {
+	query := `SELECT ` + creativeColumns + ` FROM ad_creatives WHERE id = $1`
+
+	creative, err := scanCreative(s.db.QueryRowContext(ctx, query, creativeID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("creative not found")
+		}
+		return nil, fmt.Errorf("failed to get creative: %w", err)
+	}
+
+	return creative, nil
+}
+
+func (s *Service) ListCreatives(ctx context.Context, campaignID uuid.UUID) ([]*models.AdCreative, error) {
+	query := `SELECT ` + creativeColumns + ` FROM ad_creatives WHERE campaign_id = $1 AND status != $2`
+
+	rows, err := s.db.QueryContext(ctx, query, campaignID, models.CreativeStatusArchived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list creatives: %w", err)
+	}
+	defer rows.Close()
+
+	var creatives []*models.AdCreative
+	for rows.Next() {
+		creative, err := scanCreative(rows)
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to scan creative")
+			continue
+		}
+		creatives = append(creatives, creative)
+	}
+
+	return creatives, nil
+}
+
+func (s *Service) UpdateCreative(ctx context.Context, creative *models.AdCreative) error {
+	if creative.Status == "" {
+		creative.Status = models.CreativeStatusActive
+	}
+	if err := validateCreative(creative); err != nil {
+		return err
+	}
+
+	creative.UpdatedAt = time.Now()
+
+	nativeJSON, _ := nativeAssetsJSON(creative)
+
+	query := `
+		UPDATE ad_creatives SET
+			campaign_id = $2, name = $3, type = $4, format = $5, width = $6, height = $7,
+			asset_url = $8, click_url = $9, impression_url = $10, html = $11,
+			duration = $12, mime_type = $13, skippable = $14, skip_offset = $15,
+			native_assets = $16, status = $17, updated_at = $18
+		WHERE id = $1
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		creative.ID, creative.CampaignID, creative.Name, creative.Type, creative.Format,
+		creative.Width, creative.Height, creative.AssetURL, creative.ClickURL,
+		creative.ImpressionURL, creative.HTML, creative.Duration, creative.MIMEType,
+		creative.Skippable, creative.SkipOffset, nativeJSON, creative.Status, creative.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update creative: %w", err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("creative not found")
+	}
+
+	s.store(creative)
+	return nil
+}
+
+func (s *Service) DeleteCreative(ctx context.Context, creativeID uuid.UUID) error {
+	query := `UPDATE ad_creatives SET status = $2, updated_at = NOW() WHERE id = $1`
+
+	if _, err := s.db.ExecContext(ctx, query, creativeID, models.CreativeStatusArchived); err != nil {
+		return fmt.Errorf("failed to delete creative: %w", err)
+	}
+
+	s.mu.Lock()
+	s.removeLocked(creativeID)
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Service) store(creative *models.AdCreative) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeLocked(creative.ID)
+
+	if creative.Status != models.CreativeStatusActive {
+		return
+	}
+
+	copied := *creative
+	s.byCampaign[creative.CampaignID] = append(s.byCampaign[creative.CampaignID], &copied)
+}
+
+func (s *Service) removeLocked(creativeID uuid.UUID) {
+	for campaignID, creatives := range s.byCampaign {
+		for i, c := range creatives {
+			if c.ID != creativeID {
+				continue
+			}
+			remaining := make([]*models.AdCreative, 0, len(creatives)-1)
+			remaining = append(remaining, creatives[:i]...)
+			remaining = append(remaining, creatives[i+1:]...)
+			s.byCampaign[campaignID] = remaining
+			return
+		}
+	}
+}
+
+func validateCreative(creative *models.AdCreative) error {
+	if creative.CampaignID == uuid.Nil {
+		return &models.ValidationError{Field: "campaign_id", Message: "campaign ID is required"}
+	}
+
+	switch creative.Type {
+	case models.CreativeTypeBanner:
+		if creative.Format != models.CreativeFormatResponsive && (creative.Width <= 0 || creative.Height <= 0) {
+			return &models.ValidationError{Field: "width", Message: "banner creatives need a width and height"}
+		}
+		if creative.Format == "" {
+			creative.Format = models.CreativeFormat(fmt.Sprintf("%dx%d", creative.Width, creative.Height))
+		}
+		if creative.AssetURL == "" && creative.HTML == "" {
+			return &models.ValidationError{Field: "asset_url", Message: "banner creatives need an asset URL or HTML"}
+		}
+	case models.CreativeTypeVideo:
+		if creative.Duration <= 0 {
+			return &models.ValidationError{Field: "duration", Message: "video creatives need a duration in seconds"}
+		}
+		if creative.MIMEType == "" || creative.AssetURL == "" {
+			return &models.ValidationError{Field: "asset_url", Message: "video creatives need a media file URL and MIME type"}
+		}
+	case models.CreativeTypeNative:
+		if creative.Native == nil || creative.Native.Title == "" {
+			return &models.ValidationError{Field: "native", Message: "native creatives need at least a title"}
+		}
+		if creative.ClickURL == "" {
+			return &models.ValidationError{Field: "click_url", Message: "native creatives need a click URL"}
+		}
+	case models.CreativeTypeAudio:
+	default:
+		return &models.ValidationError{Field: "type", Message: fmt.Sprintf("unknown creative type %q", creative.Type)}
+	}
+
+	return nil
+}
+
+func nativeAssetsJSON(creative *models.AdCreative) ([]byte, error) {
+	if creative.Native == nil {
+		return nil, nil
+	}
+	return json.Marshal(creative.Native)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCreative(row rowScanner) (*models.AdCreative, error) {
+	creative := &models.AdCreative{}
+	var format, assetURL, clickURL, impressionURL, html, mimeType, status sql.NullString
+	var width, height, duration, skipOffset sql.NullInt64
+	var skippable sql.NullBool
+	var nativeJSON []byte
+
+	err := row.Scan(
+		&creative.ID, &creative.CampaignID, &creative.Name, &creative.Type, &format,
+		&width, &height, &assetURL, &clickURL, &impressionURL, &html,
+		&duration, &mimeType, &skippable, &skipOffset, &nativeJSON, &status,
+		&creative.CreatedAt, &creative.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	creative.Format = models.CreativeFormat(format.String)
+	creative.Width = int(width.Int64)
+	creative.Height = int(height.Int64)
+	creative.AssetURL = assetURL.String
+	creative.ClickURL = clickURL.String
+	creative.ImpressionURL = impressionURL.String
+	creative.HTML = html.String
+	creative.Duration = int(duration.Int64)
+	creative.MIMEType = mimeType.String
+	creative.Skippable = skippable.Bool
+	creative.SkipOffset = int(skipOffset.Int64)
+	if len(nativeJSON) > 0 {
+		json.Unmarshal(nativeJSON, &creative.Native)
+	}
+	creative.Status = status.String
+
+	return creative, nil
+}
@@ -0,0 +1,214 @@
+package creative
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/sqltest"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var scanColumns = []string{
+	"id", "campaign_id", "name", "type", "format", "width", "height", "asset_url",
+	"click_url", "impression_url", "html", "duration", "mime_type", "skippable",
+	"skip_offset", "native_assets", "status", "created_at", "updated_at",
+}
+
+func creativeRow(c models.AdCreative, nativeJSON []byte) []driver.Value {
+	now := time.Now()
+	return []driver.Value{
+		c.ID.String(), c.CampaignID.String(), c.Name, string(c.Type), string(c.Format),
+		int64(c.Width), int64(c.Height), c.AssetURL, c.ClickURL, c.ImpressionURL, nil,
+		int64(c.Duration), c.MIMEType, c.Skippable, int64(c.SkipOffset), nativeJSON, c.Status,
+		now, now,
+	}
+}
+
+func TestValidateCreative(t *testing.T) {
+	campaignID := uuid.New()
+	native := &models.NativeCreative{Title: "Summer sale", Image: &models.NativeImage{URL: "https://cdn.example.com/main.jpg", W: 1200, H: 627}}
+
+	tests := []struct {
+		name     string
+		creative models.AdCreative
+		field    string
+	}{
+		{"Banner", models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeBanner, Width: 300, Height: 250, AssetURL: "https://cdn.example.com/a.png"}, ""},
+		{"Responsive banner", models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeBanner, Format: models.CreativeFormatResponsive, HTML: "<div></div>"}, ""},
+		{"No campaign", models.AdCreative{Type: models.CreativeTypeAudio}, "campaign_id"},
+		{"Banner without size", models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeBanner, AssetURL: "https://cdn.example.com/a.png"}, "width"},
+		{"Banner without asset", models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeBanner, Width: 300, Height: 250}, "asset_url"},
+		{"Video", models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeVideo, Duration: 30, MIMEType: "video/mp4", AssetURL: "https://cdn.example.com/a.mp4"}, ""},
+		{"Video without duration", models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeVideo, MIMEType: "video/mp4", AssetURL: "https://cdn.example.com/a.mp4"}, "duration"},
+		{"Video without MIME type", models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeVideo, Duration: 30, AssetURL: "https://cdn.example.com/a.mp4"}, "asset_url"},
+		{"Native", models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeNative, Native: native, ClickURL: "https://example.com"}, ""},
+		{"Native without assets", models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeNative, ClickURL: "https://example.com"}, "native"},
+		{"Native without title", models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeNative, Native: &models.NativeCreative{Body: "Up to 50% off"}, ClickURL: "https://example.com"}, "native"},
+		{"Native without click URL", models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeNative, Native: native}, "click_url"},
+		{"Audio", models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeAudio}, ""},
+		{"Unknown type", models.AdCreative{CampaignID: campaignID, Type: "hologram"}, "type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCreative(&tt.creative)
+			if tt.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *models.ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.field, validationErr.Field)
+		})
+	}
+}
+
+func TestValidateCreative_DerivesBannerFormat(t *testing.T) {
+	creative := &models.AdCreative{CampaignID: uuid.New(), Type: models.CreativeTypeBanner, Width: 728, Height: 90, HTML: "<div></div>"}
+
+	require.NoError(t, validateCreative(creative))
+	assert.Equal(t, models.CreativeFormat728x90, creative.Format)
+}
+
+func TestService_CreateCreative(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	mock.OnExec("INSERT INTO ad_creatives", 1)
+	s := NewService(db, logrus.New())
+	ctx := context.Background()
+	campaignID := uuid.New()
+
+	assert.Error(t, s.CreateCreative(ctx, &models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeNative}))
+	assert.Empty(t, mock.Calls("INSERT INTO ad_creatives"), "invalid creatives aren't written")
+
+	creative := &models.AdCreative{
+		CampaignID: campaignID,
+		Type:       models.CreativeTypeNative,
+		ClickURL:   "https://example.com",
+		Native:     &models.NativeCreative{Title: "Summer sale", CTA: "Shop now"},
+	}
+	require.NoError(t, s.CreateCreative(ctx, creative))
+	assert.NotEqual(t, uuid.Nil, creative.ID)
+	assert.Equal(t, models.CreativeStatusActive, creative.Status)
+
+	calls := mock.Calls("INSERT INTO ad_creatives")
+	require.Len(t, calls, 1)
+	assert.Equal(t, creative.ID.String(), calls[0].Args[0])
+	assert.JSONEq(t, `{"title": "Summer sale", "body": "", "cta": "Shop now", "sponsored": ""}`, string(calls[0].Args[15].([]byte)))
+
+	active := s.ActiveCreatives(campaignID)
+	require.Len(t, active, 1)
+	assert.Equal(t, creative.ID, active[0].ID)
+
+	paused := &models.AdCreative{CampaignID: campaignID, Type: models.CreativeTypeAudio, Status: models.CreativeStatusPaused}
+	require.NoError(t, s.CreateCreative(ctx, paused))
+	assert.Len(t, s.ActiveCreatives(campaignID), 1, "paused creatives aren't served")
+	assert.Nil(t, mock.Calls("INSERT INTO ad_creatives")[1].Args[15], "no native assets are stored as NULL")
+}
+
+func TestService_UpdateCreative(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	s := NewService(db, logrus.New())
+	ctx := context.Background()
+	from, to := uuid.New(), uuid.New()
+
+	creative := models.AdCreative{ID: uuid.New(), CampaignID: from, Type: models.CreativeTypeAudio, Status: models.CreativeStatusActive}
+	s.store(&creative)
+
+	mock.OnExec("UPDATE ad_creatives SET", 0)
+	missing := models.AdCreative{ID: uuid.New(), CampaignID: from, Type: models.CreativeTypeAudio}
+	assert.EqualError(t, s.UpdateCreative(ctx, &missing), "creative not found")
+	assert.Len(t, s.ActiveCreatives(from), 1)
+
+	mock.OnExec("UPDATE ad_creatives SET", 1)
+	creative.CampaignID = to
+	require.NoError(t, s.UpdateCreative(ctx, &creative))
+	assert.Empty(t, s.ActiveCreatives(from))
+	assert.Len(t, s.ActiveCreatives(to), 1, "the creative moves to its new campaign")
+
+	creative.Status = models.CreativeStatusPaused
+	require.NoError(t, s.UpdateCreative(ctx, &creative))
+	assert.Empty(t, s.ActiveCreatives(to))
+}
+
+func TestService_DeleteCreative(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	mock.OnExec("UPDATE ad_creatives SET status", 1)
+	s := NewService(db, logrus.New())
+	campaignID := uuid.New()
+
+	kept := models.AdCreative{ID: uuid.New(), CampaignID: campaignID, Status: models.CreativeStatusActive}
+	deleted := models.AdCreative{ID: uuid.New(), CampaignID: campaignID, Status: models.CreativeStatusActive}
+	s.store(&kept)
+	s.store(&deleted)
+
+	require.NoError(t, s.DeleteCreative(context.Background(), deleted.ID))
+
+	active := s.ActiveCreatives(campaignID)
+	require.Len(t, active, 1)
+	assert.Equal(t, kept.ID, active[0].ID)
+
+	calls := mock.Calls("UPDATE ad_creatives SET status")
+	require.Len(t, calls, 1)
+	assert.Equal(t, models.CreativeStatusArchived, calls[0].Args[1])
+}
+
+func TestService_GetAndListCreatives(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	s := NewService(db, logrus.New())
+	ctx := context.Background()
+	campaignID := uuid.New()
+
+	video := models.AdCreative{
+		ID: uuid.New(), CampaignID: campaignID, Name: "Pre-roll", Type: models.CreativeTypeVideo,
+		Duration: 15, MIMEType: "video/mp4", AssetURL: "https://cdn.example.com/a.mp4",
+		Skippable: true, SkipOffset: 5, Status: models.CreativeStatusPaused,
+	}
+	mock.OnQuery("WHERE campaign_id = $1", scanColumns, creativeRow(video, nil))
+	mock.OnQuery("WHERE id = $1", scanColumns)
+
+	creatives, err := s.ListCreatives(ctx, campaignID)
+	require.NoError(t, err)
+	require.Len(t, creatives, 1)
+	assert.Equal(t, video.ID, creatives[0].ID)
+	assert.Equal(t, 15, creatives[0].Duration)
+	assert.True(t, creatives[0].Skippable)
+	assert.Equal(t, "", creatives[0].HTML)
+	assert.Nil(t, creatives[0].Native)
+
+	_, err = s.GetCreative(ctx, uuid.New())
+	assert.EqualError(t, err, "creative not found")
+}
+
+func TestService_Refresh(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	s := NewService(db, logrus.New())
+	first, second := uuid.New(), uuid.New()
+
+	stale := models.AdCreative{ID: uuid.New(), CampaignID: first, Status: models.CreativeStatusActive}
+	s.store(&stale)
+
+	native := models.AdCreative{ID: uuid.New(), CampaignID: first, Type: models.CreativeTypeNative, ClickURL: "https://example.com", Status: models.CreativeStatusActive}
+	banner := models.AdCreative{ID: uuid.New(), CampaignID: first, Type: models.CreativeTypeBanner, Format: models.CreativeFormat300x250, Width: 300, Height: 250, Status: models.CreativeStatusActive}
+	audio := models.AdCreative{ID: uuid.New(), CampaignID: second, Type: models.CreativeTypeAudio, Status: models.CreativeStatusActive}
+	mock.OnQuery("FROM ad_creatives WHERE status", scanColumns,
+		creativeRow(native, []byte(`{"title": "Summer sale", "icon": {"url": "https://cdn.example.com/icon.png", "w": 80, "h": 80}}`)),
+		creativeRow(banner, nil),
+		creativeRow(audio, nil),
+	)
+
+	require.NoError(t, s.Refresh(context.Background()))
+
+	active := s.ActiveCreatives(first)
+	require.Len(t, active, 2, "creatives missing from the database are dropped")
+	assert.Equal(t, native.ID, active[0].ID)
+	assert.Equal(t, &models.NativeCreative{Title: "Summer sale", Icon: &models.NativeImage{URL: "https://cdn.example.com/icon.png", W: 80, H: 80}}, active[0].Native)
+	assert.Equal(t, models.CreativeFormat300x250, active[1].Format)
+	assert.Len(t, s.ActiveCreatives(second), 1)
+	assert.Empty(t, s.ActiveCreatives(uuid.New()))
+}
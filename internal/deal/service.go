@@ -0,0 +1,247 @@
+package deal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+type Service struct {
+	db     *sql.DB
+	logger *logrus.Logger
+	mu     sync.RWMutex
+	deals  map[string]*models.PrivateDeal
+}
+
+func NewService(db *sql.DB, logger *logrus.Logger) *Service {
+	return &Service{
+		db:     db,
+		logger: logger,
+		deals:  make(map[string]*models.PrivateDeal),
+	}
+}
+
+func (s *Service) Start(ctx context.Context, refreshInterval time.Duration) error {
+	if err := s.Refresh(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Refresh(ctx); err != nil {
+					s.logger.WithError(err).Error("Failed to refresh deals")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *Service) Refresh(ctx context.Context) error {
+	deals, err := s.ListDeals(ctx)
+	if err != nil {
+		return err
+	}
+
+	cache := make(map[string]*models.PrivateDeal, len(deals))
+	for _, deal := range deals {
+		cache[deal.ID] = deal
+	}
+
+	s.mu.Lock()
+	s.deals = cache
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Service) Lookup(dealID string) (*models.PrivateDeal, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deal, exists := s.deals[dealID]
+	return deal, exists
+}
+
+func (s *Service) CreateDeal(ctx context.Context, deal *models.PrivateDeal) error {
+	if deal.ID == "" {
+		return &models.ValidationError{Field: "id", Message: "deal ID is required"}
+	}
+	if err := validateDeal(deal); err != nil {
+		return err
+	}
+	if deal.Status == "" {
+		deal.Status = models.DealStatusActive
+	}
+
+	deal.CreatedAt = time.Now()
+	deal.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO deals (
+			id, name, publisher_id, bid_floor, priority, status,
+			start_date, end_date, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		deal.ID, deal.Name, deal.PublisherID, deal.BidFloor, deal.Priority, deal.Status,
+		deal.StartDate, deal.EndDate, deal.CreatedAt, deal.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create deal: %w", err)
+	}
+
+	s.store(deal)
+	return nil
+}
+
+func (s *Service) GetDeal(ctx context.Context, dealID string) (*models.PrivateDeal, error) {
+	query := `
+		SELECT id, name, publisher_id, bid_floor, priority, status,
+			start_date, end_date, created_at, updated_at
+		FROM deals WHERE id = $1
+	`
+
+	deal, err := scanDeal(s.db.QueryRowContext(ctx, query, dealID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("deal not found")
+		}
+		return nil, fmt.Errorf("failed to get deal: %w", err)
+	}
+
+	return deal, nil
+}
+
+func (s *Service) ListDeals(ctx context.Context) ([]*models.PrivateDeal, error) {
+	query := `
+		SELECT id, name, publisher_id, bid_floor, priority, status,
+			start_date, end_date, created_at, updated_at
+		FROM deals WHERE status != $1
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, models.DealStatusArchived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deals: %w", err)
+	}
+	defer rows.Close()
+
+	var deals []*models.PrivateDeal
+	for rows.Next() {
+		deal, err := scanDeal(rows)
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to scan deal")
+			continue
+		}
+		deals = append(deals, deal)
+	}
+
+	return deals, nil
+}
+
+func (s *Service) UpdateDeal(ctx context.Context, deal *models.PrivateDeal) error {
+	if err := validateDeal(deal); err != nil {
+		return err
+	}
+	if deal.Status == "" {
+		deal.Status = models.DealStatusActive
+	}
+
+	deal.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE deals SET
+			name = $2, publisher_id = $3, bid_floor = $4, priority = $5,
+			status = $6, start_date = $7, end_date = $8, updated_at = $9
+		WHERE id = $1
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		deal.ID, deal.Name, deal.PublisherID, deal.BidFloor, deal.Priority,
+		deal.Status, deal.StartDate, deal.EndDate, deal.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update deal: %w", err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("deal not found")
+	}
+
+	s.store(deal)
+	return nil
+}
+
+func (s *Service) DeleteDeal(ctx context.Context, dealID string) error {
+	query := `UPDATE deals SET status = $2, updated_at = NOW() WHERE id = $1`
+
+	if _, err := s.db.ExecContext(ctx, query, dealID, models.DealStatusArchived); err != nil {
+		return fmt.Errorf("failed to delete deal: %w", err)
+	}
+
+	s.mu.Lock()
+	delete(s.deals, dealID)
+	s.mu.Unlock()
+
+	return nil
+}
+
+func validateDeal(deal *models.PrivateDeal) error {
+	if deal.BidFloor < 0 {
+		return &models.ValidationError{Field: "bid_floor", Message: "must not be negative"}
+	}
+	if deal.Priority < 0 {
+		return &models.ValidationError{Field: "priority", Message: "must not be negative"}
+	}
+	return nil
+}
+
+func (s *Service) store(deal *models.PrivateDeal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *deal
+	s.deals[deal.ID] = &copied
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDeal(row rowScanner) (*models.PrivateDeal, error) {
+	deal := &models.PrivateDeal{}
+	var publisherID sql.NullString
+	var startDate, endDate sql.NullTime
+
+	err := row.Scan(
+		&deal.ID, &deal.Name, &publisherID, &deal.BidFloor, &deal.Priority, &deal.Status,
+		&startDate, &endDate, &deal.CreatedAt, &deal.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	deal.PublisherID = publisherID.String
+	if startDate.Valid {
+		deal.StartDate = &startDate.Time
+	}
+	if endDate.Valid {
+		deal.EndDate = &endDate.Time
+	}
+
+	return deal, nil
+}
@@ -0,0 +1,166 @@
+package deal
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/sqltest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var dealColumns = []string{
+	"id", "name", "publisher_id", "bid_floor", "priority", "status",
+	"start_date", "end_date", "created_at", "updated_at",
+}
+
+func TestValidateDeal(t *testing.T) {
+	tests := []struct {
+		name  string
+		deal  models.PrivateDeal
+		field string
+	}{
+		{"Valid", models.PrivateDeal{ID: "deal-1", BidFloor: 2.5, Priority: 1}, ""},
+		{"Zero floor and priority", models.PrivateDeal{ID: "deal-1"}, ""},
+		{"Negative floor", models.PrivateDeal{ID: "deal-1", BidFloor: -0.01}, "bid_floor"},
+		{"Negative priority", models.PrivateDeal{ID: "deal-1", Priority: -1}, "priority"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDeal(&tt.deal)
+			if tt.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *models.ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.field, validationErr.Field)
+		})
+	}
+}
+
+func TestService_Store(t *testing.T) {
+	s := NewService(nil, logrus.New())
+
+	deal := &models.PrivateDeal{ID: "deal-1", BidFloor: 2.5, Status: models.DealStatusActive}
+	s.store(deal)
+	deal.BidFloor = 9
+
+	cached, exists := s.Lookup("deal-1")
+	require.True(t, exists)
+	assert.Equal(t, 2.5, cached.BidFloor, "the cache keeps its own copy")
+
+	s.store(&models.PrivateDeal{ID: "deal-1", BidFloor: 3, Status: models.DealStatusPaused})
+	cached, _ = s.Lookup("deal-1")
+	assert.Equal(t, 3.0, cached.BidFloor)
+	assert.Equal(t, models.DealStatusPaused, cached.Status)
+
+	_, exists = s.Lookup("deal-2")
+	assert.False(t, exists)
+}
+
+func TestService_CreateDeal(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	mock.OnExec("INSERT INTO deals", 1)
+	s := NewService(db, logrus.New())
+	ctx := context.Background()
+
+	assert.Error(t, s.CreateDeal(ctx, &models.PrivateDeal{Name: "No ID"}))
+	assert.Error(t, s.CreateDeal(ctx, &models.PrivateDeal{ID: "deal-1", BidFloor: -1}))
+	assert.Empty(t, mock.Calls("INSERT INTO deals"), "invalid deals aren't written")
+
+	deal := &models.PrivateDeal{ID: "deal-1", Name: "Premium", BidFloor: 4}
+	require.NoError(t, s.CreateDeal(ctx, deal))
+	assert.Equal(t, models.DealStatusActive, deal.Status)
+	assert.False(t, deal.CreatedAt.IsZero())
+
+	calls := mock.Calls("INSERT INTO deals")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "deal-1", calls[0].Args[0])
+	assert.Equal(t, string(models.DealStatusActive), calls[0].Args[5])
+
+	cached, exists := s.Lookup("deal-1")
+	require.True(t, exists)
+	assert.Equal(t, 4.0, cached.BidFloor)
+}
+
+func TestService_UpdateDeal(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	s := NewService(db, logrus.New())
+	ctx := context.Background()
+
+	mock.OnExec("UPDATE deals SET", 0)
+	assert.EqualError(t, s.UpdateDeal(ctx, &models.PrivateDeal{ID: "missing"}), "deal not found")
+	_, exists := s.Lookup("missing")
+	assert.False(t, exists)
+
+	mock.OnExec("UPDATE deals SET", 1)
+	require.NoError(t, s.UpdateDeal(ctx, &models.PrivateDeal{ID: "deal-1", BidFloor: 6, Status: models.DealStatusPaused}))
+	cached, exists := s.Lookup("deal-1")
+	require.True(t, exists)
+	assert.Equal(t, models.DealStatusPaused, cached.Status)
+}
+
+func TestService_DeleteDeal(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	mock.OnExec("UPDATE deals SET status", 1)
+	s := NewService(db, logrus.New())
+	s.store(&models.PrivateDeal{ID: "deal-1", Status: models.DealStatusActive})
+
+	require.NoError(t, s.DeleteDeal(context.Background(), "deal-1"))
+	_, exists := s.Lookup("deal-1")
+	assert.False(t, exists)
+
+	calls := mock.Calls("UPDATE deals SET status")
+	require.Len(t, calls, 1)
+	assert.Equal(t, string(models.DealStatusArchived), calls[0].Args[1])
+}
+
+func TestService_Refresh(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	s := NewService(db, logrus.New())
+	s.store(&models.PrivateDeal{ID: "stale", Status: models.DealStatusActive})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	end := now.Add(24 * time.Hour)
+	mock.OnQuery("FROM deals WHERE status", dealColumns,
+		[]driver.Value{"deal-1", "Premium", "pub-1", 2.5, int64(1), "active", now, end, now, now},
+		[]driver.Value{"deal-2", "Open", nil, 0.5, int64(0), "paused", nil, nil, now, now},
+	)
+
+	require.NoError(t, s.Refresh(context.Background()))
+
+	_, exists := s.Lookup("stale")
+	assert.False(t, exists, "deals missing from the database are dropped")
+
+	deal, exists := s.Lookup("deal-1")
+	require.True(t, exists)
+	assert.Equal(t, "pub-1", deal.PublisherID)
+	assert.Equal(t, 1, deal.Priority)
+	require.NotNil(t, deal.EndDate)
+	assert.True(t, deal.EndDate.Equal(end))
+	assert.True(t, deal.IsLive(now))
+
+	deal, exists = s.Lookup("deal-2")
+	require.True(t, exists)
+	assert.Equal(t, "", deal.PublisherID)
+	assert.Nil(t, deal.StartDate)
+	assert.False(t, deal.IsLive(now))
+}
+
+func TestService_RefreshKeepsCacheOnError(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	mock.OnError("FROM deals WHERE status", errors.New("connection refused"))
+	s := NewService(db, logrus.New())
+	s.store(&models.PrivateDeal{ID: "deal-1", Status: models.DealStatusActive})
+
+	assert.Error(t, s.Refresh(context.Background()))
+	_, exists := s.Lookup("deal-1")
+	assert.True(t, exists)
+}
@@ -0,0 +1,311 @@
+package inventory
+
+import (
+	"fmt"
+	"math/bits"
+	"net"
+	"strings"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+// domainTrie holds domains by label from the TLD down, so a lookup walks at
+// most one node per label and matches a listed domain or any subdomain.
+type domainTrie struct {
+	children map[string]*domainTrie
+	terminal bool
+}
+
+func newDomainTrie() *domainTrie {
+	return &domainTrie{children: make(map[string]*domainTrie)}
+}
+
+func (t *domainTrie) insert(domain string) {
+	node := t
+	labels := strings.Split(domain, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		child, exists := node.children[labels[i]]
+		if !exists {
+			child = &domainTrie{children: make(map[string]*domainTrie)}
+			node.children[labels[i]] = child
+		}
+		node = child
+	}
+	node.terminal = true
+}
+
+func (t *domainTrie) contains(domain string) bool {
+	node := t
+	for end := len(domain); end > 0; {
+		start := strings.LastIndexByte(domain[:end], '.') + 1
+		child, exists := node.children[domain[start:end]]
+		if !exists {
+			return false
+		}
+		if child.terminal {
+			return true
+		}
+		node = child
+		end = start - 1
+	}
+	return false
+}
+
+// ipNode is a node of a path-compressed binary radix tree over 128-bit
+// addresses. IPv4 is stored IPv4-mapped, so one tree holds both families.
+type ipNode struct {
+	prefix   [16]byte
+	length   int
+	terminal bool
+	children [2]*ipNode
+}
+
+type ipTrie struct {
+	root *ipNode
+}
+
+func bitAt(addr [16]byte, i int) int {
+	return int(addr[i/8]>>(7-uint(i%8))) & 1
+}
+
+func maskAddr(addr [16]byte, length int) [16]byte {
+	var masked [16]byte
+	for i := 0; i < 16 && length > 0; i++ {
+		if length >= 8 {
+			masked[i] = addr[i]
+		} else {
+			masked[i] = addr[i] & ^byte(0xff>>uint(length))
+		}
+		length -= 8
+	}
+	return masked
+}
+
+// commonPrefix returns how many leading bits a and b share, up to limit.
+func commonPrefix(a, b [16]byte, limit int) int {
+	n := 0
+	for i := 0; i < 16 && n < limit; i++ {
+		if x := a[i] ^ b[i]; x != 0 {
+			n += bits.LeadingZeros8(x)
+			break
+		}
+		n += 8
+	}
+	if n > limit {
+		return limit
+	}
+	return n
+}
+
+func (t *ipTrie) insert(addr [16]byte, length int) {
+	addr = maskAddr(addr, length)
+
+	link := &t.root
+	for {
+		node := *link
+		if node == nil {
+			*link = &ipNode{prefix: addr, length: length, terminal: true}
+			return
+		}
+
+		limit := node.length
+		if length < limit {
+			limit = length
+		}
+		common := commonPrefix(node.prefix, addr, limit)
+		if common < node.length {
+			split := &ipNode{prefix: maskAddr(addr, common), length: common}
+			split.children[bitAt(node.prefix, common)] = node
+			if common == length {
+				split.terminal = true
+			} else {
+				split.children[bitAt(addr, common)] = &ipNode{prefix: addr, length: length, terminal: true}
+			}
+			*link = split
+			return
+		}
+
+		if node.length == length {
+			node.terminal = true
+			return
+		}
+		link = &node.children[bitAt(addr, node.length)]
+	}
+}
+
+func (t *ipTrie) contains(addr [16]byte) bool {
+	for node := t.root; node != nil; {
+		if commonPrefix(node.prefix, addr, node.length) < node.length {
+			return false
+		}
+		if node.terminal {
+			return true
+		}
+		if node.length == 128 {
+			return false
+		}
+		node = node.children[bitAt(addr, node.length)]
+	}
+	return false
+}
+
+func toAddr(ip net.IP) ([16]byte, bool) {
+	var addr [16]byte
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return addr, false
+	}
+	copy(addr[:], ip16)
+	return addr, true
+}
+
+// matcher is the in-memory form of one list's entries.
+type matcher struct {
+	domains *domainTrie
+	values  map[string]struct{}
+	ips     *ipTrie
+}
+
+func newMatcher(listType models.InventoryListType, entries []string) *matcher {
+	m := &matcher{}
+	switch listType {
+	case models.InventoryListDomain:
+		m.domains = newDomainTrie()
+		for _, entry := range entries {
+			m.domains.insert(entry)
+		}
+	case models.InventoryListIP:
+		m.ips = &ipTrie{}
+		for _, entry := range entries {
+			if _, network, err := net.ParseCIDR(entry); err == nil {
+				addr, _ := toAddr(network.IP)
+				ones, size := network.Mask.Size()
+				m.ips.insert(addr, ones+128-size)
+			}
+		}
+	default:
+		m.values = make(map[string]struct{}, len(entries))
+		for _, entry := range entries {
+			m.values[entry] = struct{}{}
+		}
+	}
+	return m
+}
+
+// maxEntryLength matches the inventory_list_entries value column.
+const maxEntryLength = 255
+
+// Normalize validates a list entry of the given type and returns it in the
+// form it is stored and matched in: lower-cased domains and bundles without
+// schemes or wildcards, and IPs as canonical CIDRs.
+func Normalize(listType models.InventoryListType, entry string) (string, error) {
+	entry = strings.TrimSpace(entry)
+	if entry == "" {
+		return "", fmt.Errorf("entry is empty")
+	}
+	if len(entry) > maxEntryLength {
+		return "", fmt.Errorf("entry is longer than %d characters", maxEntryLength)
+	}
+
+	switch listType {
+	case models.InventoryListDomain:
+		domain := strings.ToLower(entry)
+		if i := strings.Index(domain, "://"); i >= 0 {
+			domain = domain[i+3:]
+		}
+		if i := strings.IndexAny(domain, "/:?#"); i >= 0 {
+			domain = domain[:i]
+		}
+		domain = strings.TrimSuffix(strings.TrimPrefix(domain, "*."), ".")
+		if domain == "" || strings.Contains(domain, "..") || strings.HasPrefix(domain, ".") {
+			return "", fmt.Errorf("%q is not a domain", entry)
+		}
+		for _, r := range domain {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+				return "", fmt.Errorf("%q is not a domain", entry)
+			}
+		}
+		return domain, nil
+
+	case models.InventoryListBundle:
+		if strings.ContainsAny(entry, " \t") {
+			return "", fmt.Errorf("%q is not an app bundle", entry)
+		}
+		return strings.ToLower(entry), nil
+
+	case models.InventoryListPublisher:
+		return entry, nil
+
+	case models.InventoryListIP:
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return "", fmt.Errorf("%q is not an IP address or CIDR", entry)
+			}
+			if ip.To4() != nil {
+				return ip.String() + "/32", nil
+			}
+			return ip.String() + "/128", nil
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return "", fmt.Errorf("%q is not an IP address or CIDR", entry)
+		}
+		return network.String(), nil
+	}
+
+	return "", fmt.Errorf("unknown list type %q", listType)
+}
+
+// RequestValues is what a request is matched on for each list type.
+type RequestValues struct {
+	Domain    string
+	Bundle    string
+	Publisher string
+	IP        net.IP
+}
+
+// ValuesFor extracts the site or app domain, app bundle, publisher ID and
+// device IP from request.
+func ValuesFor(request *models.BidRequest) RequestValues {
+	var values RequestValues
+	var publisher *models.Publisher
+	if request.Site != nil {
+		values.Domain = request.Site.Domain
+		publisher = request.Site.Publisher
+	} else if request.App != nil {
+		values.Domain = request.App.Domain
+		values.Bundle = strings.ToLower(request.App.Bundle)
+		publisher = request.App.Publisher
+	}
+	values.Domain = strings.TrimSuffix(strings.ToLower(values.Domain), ".")
+	if publisher != nil {
+		values.Publisher = publisher.ID
+	}
+
+	if request.Device.IP != "" {
+		values.IP = net.ParseIP(request.Device.IP)
+	} else if request.Device.IPv6 != "" {
+		values.IP = net.ParseIP(request.Device.IPv6)
+	}
+	return values
+}
+
+// contains reports whether the request's value for the list's type is in
+// it. Requests without that value are in no list.
+func (m *matcher) contains(listType models.InventoryListType, values RequestValues) bool {
+	switch listType {
+	case models.InventoryListDomain:
+		return values.Domain != "" && m.domains.contains(values.Domain)
+	case models.InventoryListIP:
+		addr, ok := toAddr(values.IP)
+		return ok && m.ips.contains(addr)
+	case models.InventoryListBundle:
+		_, exists := m.values[values.Bundle]
+		return values.Bundle != "" && exists
+	case models.InventoryListPublisher:
+		_, exists := m.values[values.Publisher]
+		return values.Publisher != "" && exists
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package inventory
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainTrie(t *testing.T) {
+	trie := newDomainTrie()
+	trie.insert("example.com")
+	trie.insert("news.example.org")
+
+	assert.True(t, trie.contains("example.com"))
+	assert.True(t, trie.contains("www.example.com"))
+	assert.True(t, trie.contains("a.b.news.example.org"))
+	assert.False(t, trie.contains("example.org"))
+	assert.False(t, trie.contains("badexample.com"))
+	assert.False(t, trie.contains("com"))
+	assert.False(t, trie.contains(""))
+}
+
+func TestIPTrie_MatchesLinearScan(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+
+	var networks []*net.IPNet
+	trie := &ipTrie{}
+	for i := 0; i < 2000; i++ {
+		var cidr string
+		if r.Intn(4) == 0 {
+			cidr = fmt.Sprintf("2001:db8:%x::/%d", r.Intn(16), 32+r.Intn(33))
+		} else {
+			cidr = fmt.Sprintf("10.%d.%d.0/%d", r.Intn(4), r.Intn(256), 8+r.Intn(25))
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		networks = append(networks, network)
+
+		addr, _ := toAddr(network.IP)
+		ones, size := network.Mask.Size()
+		trie.insert(addr, ones+128-size)
+	}
+
+	for i := 0; i < 5000; i++ {
+		var ip net.IP
+		if r.Intn(4) == 0 {
+			ip = net.ParseIP(fmt.Sprintf("2001:db8:%x::%x", r.Intn(20), r.Intn(65536)))
+		} else {
+			ip = net.IPv4(10, byte(r.Intn(6)), byte(r.Intn(256)), byte(r.Intn(256)))
+		}
+
+		expected := false
+		for _, network := range networks {
+			if network.Contains(ip) {
+				expected = true
+				break
+			}
+		}
+
+		addr, _ := toAddr(ip)
+		assert.Equal(t, expected, trie.contains(addr), ip.String())
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		listType models.InventoryListType
+		entry    string
+		expected string
+		valid    bool
+	}{
+		{models.InventoryListDomain, " News.Example.COM ", "news.example.com", true},
+		{models.InventoryListDomain, "https://example.com/path?q=1", "example.com", true},
+		{models.InventoryListDomain, "*.example.com.", "example.com", true},
+		{models.InventoryListDomain, "exa mple.com", "", false},
+		{models.InventoryListDomain, "example..com", "", false},
+		{models.InventoryListBundle, "com.Example.App", "com.example.app", true},
+		{models.InventoryListBundle, "com example", "", false},
+		{models.InventoryListPublisher, "pub-123", "pub-123", true},
+		{models.InventoryListIP, "192.168.1.7", "192.168.1.7/32", true},
+		{models.InventoryListIP, "192.168.1.7/24", "192.168.1.0/24", true},
+		{models.InventoryListIP, "2001:DB8::1", "2001:db8::1/128", true},
+		{models.InventoryListIP, "300.1.1.1", "", false},
+		{models.InventoryListDomain, strings.Repeat("a", 256), "", false},
+		{models.InventoryListDomain, "", "", false},
+	}
+
+	for _, tt := range tests {
+		normalized, err := Normalize(tt.listType, tt.entry)
+		if !tt.valid {
+			assert.Error(t, err, tt.entry)
+			continue
+		}
+		assert.NoError(t, err, tt.entry)
+		assert.Equal(t, tt.expected, normalized)
+	}
+}
+
+func TestParseEntries(t *testing.T) {
+	body := "# brand safety\nexample.com\n\nEXAMPLE.com\nnot a domain\nnews.example.org\n"
+
+	entries, invalid, err := ParseEntries(strings.NewReader(body), models.InventoryListDomain)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "news.example.org"}, entries)
+	assert.Equal(t, []EntryError{{Line: 5, Entry: "not a domain", Message: `"not a domain" is not a domain`}}, invalid)
+}
+
+func serviceWith(lists map[models.InventoryListType][]string) (*Service, map[models.InventoryListType]uuid.UUID) {
+	s := NewService(nil, logrus.New())
+	ids := make(map[models.InventoryListType]uuid.UUID)
+	for listType, entries := range lists {
+		list := models.InventoryList{ID: uuid.New(), Name: string(listType), Type: listType}
+		s.lists[list.ID] = &cachedList{list: list, matcher: newMatcher(listType, entries)}
+		ids[listType] = list.ID
+	}
+	return s, ids
+}
+
+func TestService_Allowed(t *testing.T) {
+	s, ids := serviceWith(map[models.InventoryListType][]string{
+		models.InventoryListDomain:    {"example.com"},
+		models.InventoryListBundle:    {"com.example.game"},
+		models.InventoryListPublisher: {"pub-1"},
+		models.InventoryListIP:        {"203.0.113.0/24"},
+	})
+
+	site := ValuesFor(&models.BidRequest{
+		Site:   &models.Site{Domain: "WWW.Example.com", Publisher: &models.Publisher{ID: "pub-1"}},
+		Device: models.Device{IP: "198.51.100.4"},
+	})
+	app := ValuesFor(&models.BidRequest{
+		App:    &models.App{Bundle: "com.example.game"},
+		Device: models.Device{IP: "203.0.113.9"},
+	})
+
+	tests := []struct {
+		name     string
+		refs     *models.InventoryListRefs
+		values   RequestValues
+		expected bool
+	}{
+		{"No lists", nil, site, true},
+		{"Allowed domain", &models.InventoryListRefs{Allow: []uuid.UUID{ids[models.InventoryListDomain]}}, site, true},
+		{"Domain allow list on app", &models.InventoryListRefs{Allow: []uuid.UUID{ids[models.InventoryListDomain]}}, app, false},
+		{"Allow lists of two types", &models.InventoryListRefs{Allow: []uuid.UUID{ids[models.InventoryListDomain], ids[models.InventoryListPublisher]}}, site, true},
+		{"Blocked IP", &models.InventoryListRefs{Block: []uuid.UUID{ids[models.InventoryListIP]}}, app, false},
+		{"IP not blocked", &models.InventoryListRefs{Block: []uuid.UUID{ids[models.InventoryListIP]}}, site, true},
+		{"Blocked bundle", &models.InventoryListRefs{Block: []uuid.UUID{ids[models.InventoryListBundle]}}, app, false},
+		{"Missing list", &models.InventoryListRefs{Block: []uuid.UUID{uuid.New()}}, site, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, reason := s.Allowed(tt.refs, tt.values)
+			assert.Equal(t, tt.expected, allowed, reason)
+		})
+	}
+}
+
+func BenchmarkService_Allowed(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	domains := make([]string, 300000)
+	for i := range domains {
+		domains[i] = fmt.Sprintf("site%d.example%d.com", r.Int(), i%100)
+	}
+	cidrs := make([]string, 300000)
+	for i := range cidrs {
+		cidrs[i] = fmt.Sprintf("%d.%d.%d.0/24", r.Intn(224), r.Intn(256), r.Intn(256))
+	}
+	s, ids := serviceWith(map[models.InventoryListType][]string{
+		models.InventoryListDomain: domains,
+		models.InventoryListIP:     cidrs,
+	})
+	refs := &models.InventoryListRefs{Block: []uuid.UUID{ids[models.InventoryListDomain], ids[models.InventoryListIP]}}
+	values := ValuesFor(&models.BidRequest{Site: &models.Site{Domain: "www.news.example.net"}, Device: models.Device{IP: "192.0.2.1"}})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Allowed(refs, values)
+	}
+}
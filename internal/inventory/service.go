@@ -0,0 +1,439 @@
+package inventory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrListNotFound is returned for operations on a list that doesn't exist.
+var ErrListNotFound = fmt.Errorf("inventory list not found")
+
+// ErrListInUse is returned when deleting a list campaigns still attach.
+var ErrListInUse = fmt.Errorf("inventory list is attached to campaigns")
+
+// cachedList is a loaded list. write is the service write that stored it,
+// or 0 when Refresh loaded it.
+type cachedList struct {
+	list    models.InventoryList
+	matcher *matcher
+	write   uint64
+}
+
+// Service stores inventory lists in Postgres and keeps a compiled copy of
+// each in memory for the auction. Refresh only reloads the entries of lists
+// whose updated_at changed, so large lists aren't rebuilt every interval.
+// Writes through the service update the cache as they happen; writes counts
+// them, and deleted records the write that deleted each list, so Refresh
+// keeps the changes made while it was reading Postgres.
+type Service struct {
+	db      *sql.DB
+	logger  *logrus.Logger
+	mu      sync.RWMutex
+	lists   map[uuid.UUID]*cachedList
+	writes  uint64
+	deleted map[uuid.UUID]uint64
+}
+
+func NewService(db *sql.DB, logger *logrus.Logger) *Service {
+	return &Service{
+		db:      db,
+		logger:  logger,
+		lists:   make(map[uuid.UUID]*cachedList),
+		deleted: make(map[uuid.UUID]uint64),
+	}
+}
+
+func (s *Service) Start(ctx context.Context, refreshInterval time.Duration) error {
+	if err := s.Refresh(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Refresh(ctx); err != nil {
+					s.logger.WithError(err).Error("Failed to refresh inventory lists")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Refresh reloads the lists from Postgres. Lists created, uploaded to or
+// deleted through the service while it runs keep their newer state.
+func (s *Service) Refresh(ctx context.Context) error {
+	s.mu.RLock()
+	start := s.writes
+	s.mu.RUnlock()
+
+	lists, err := s.ListLists(ctx)
+	if err != nil {
+		return err
+	}
+
+	cache := make(map[uuid.UUID]*cachedList, len(lists))
+	for _, list := range lists {
+		s.mu.RLock()
+		cached, exists := s.lists[list.ID]
+		s.mu.RUnlock()
+
+		if exists && cached.list.UpdatedAt.Equal(list.UpdatedAt) {
+			cache[list.ID] = cached
+			continue
+		}
+
+		compiled, err := s.compile(ctx, list)
+		if err != nil {
+			return err
+		}
+		cache[list.ID] = compiled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, cached := range s.lists {
+		if cached.write > start {
+			cache[id] = cached
+		}
+	}
+	for id, write := range s.deleted {
+		if write > start {
+			delete(cache, id)
+		} else {
+			delete(s.deleted, id)
+		}
+	}
+	s.lists = cache
+
+	return nil
+}
+
+// storeLocked caches a list written through the service.
+func (s *Service) storeLocked(cached *cachedList) {
+	s.writes++
+	cached.write = s.writes
+	s.lists[cached.list.ID] = cached
+}
+
+func (s *Service) compile(ctx context.Context, list *models.InventoryList) (*cachedList, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT value FROM inventory_list_entries WHERE list_id = $1`, list.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load inventory list entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]string, 0, list.EntryCount)
+	for rows.Next() {
+		var entry string
+		if err := rows.Scan(&entry); err != nil {
+			return nil, fmt.Errorf("failed to scan inventory list entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load inventory list entries: %w", err)
+	}
+
+	return &cachedList{list: *list, matcher: newMatcher(list.Type, entries)}, nil
+}
+
+// Exists reports whether the list is loaded.
+func (s *Service) Exists(listID uuid.UUID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.lists[listID]
+	return exists
+}
+
+// Allowed applies a campaign's allow and block lists to a request. For each
+// list type the campaign has allow lists of, the request must be in one of
+// them, and it must not be in any block list. A list that isn't loaded
+// fails closed. reason describes the first list that rejected the request.
+func (s *Service) Allowed(refs *models.InventoryListRefs, values RequestValues) (allowed bool, reason string) {
+	if refs == nil || (len(refs.Allow) == 0 && len(refs.Block) == 0) {
+		return true, ""
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range refs.Block {
+		cached, exists := s.lists[id]
+		if !exists {
+			return false, fmt.Sprintf("block list %s not loaded", id)
+		}
+		if cached.matcher.contains(cached.list.Type, values) {
+			return false, fmt.Sprintf("in %s block list %q", cached.list.Type, cached.list.Name)
+		}
+	}
+
+	allowedTypes := make(map[models.InventoryListType]bool)
+	for _, id := range refs.Allow {
+		cached, exists := s.lists[id]
+		if !exists {
+			return false, fmt.Sprintf("allow list %s not loaded", id)
+		}
+		if !allowedTypes[cached.list.Type] {
+			allowedTypes[cached.list.Type] = cached.matcher.contains(cached.list.Type, values)
+		}
+	}
+	for listType, matched := range allowedTypes {
+		if !matched {
+			return false, fmt.Sprintf("not in any %s allow list", listType)
+		}
+	}
+
+	return true, ""
+}
+
+func (s *Service) CreateList(ctx context.Context, list *models.InventoryList) error {
+	if list.Name == "" {
+		return &models.ValidationError{Field: "name", Message: "list name is required"}
+	}
+	switch list.Type {
+	case models.InventoryListDomain, models.InventoryListBundle, models.InventoryListPublisher, models.InventoryListIP:
+	default:
+		return &models.ValidationError{Field: "type", Message: fmt.Sprintf("must be %q, %q, %q or %q",
+			models.InventoryListDomain, models.InventoryListBundle, models.InventoryListPublisher, models.InventoryListIP)}
+	}
+
+	list.ID = uuid.New()
+	list.EntryCount = 0
+	list.CreatedAt = time.Now()
+	list.UpdatedAt = list.CreatedAt
+
+	query := `
+		INSERT INTO inventory_lists (id, name, type, entry_count, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	if _, err := s.db.ExecContext(ctx, query,
+		list.ID, list.Name, list.Type, list.EntryCount, list.CreatedAt, list.UpdatedAt,
+	); err != nil {
+		return fmt.Errorf("failed to create inventory list: %w", err)
+	}
+
+	s.mu.Lock()
+	s.storeLocked(&cachedList{list: *list, matcher: newMatcher(list.Type, nil)})
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Service) GetList(ctx context.Context, listID uuid.UUID) (*models.InventoryList, error) {
+	query := `
+		SELECT id, name, type, entry_count, created_at, updated_at
+		FROM inventory_lists WHERE id = $1
+	`
+
+	list, err := scanList(s.db.QueryRowContext(ctx, query, listID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrListNotFound
+		}
+		return nil, fmt.Errorf("failed to get inventory list: %w", err)
+	}
+
+	return list, nil
+}
+
+func (s *Service) ListLists(ctx context.Context) ([]*models.InventoryList, error) {
+	query := `
+		SELECT id, name, type, entry_count, created_at, updated_at
+		FROM inventory_lists ORDER BY name
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inventory lists: %w", err)
+	}
+	defer rows.Close()
+
+	var lists []*models.InventoryList
+	for rows.Next() {
+		list, err := scanList(rows)
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to scan inventory list")
+			continue
+		}
+		lists = append(lists, list)
+	}
+
+	return lists, nil
+}
+
+// DeleteList deletes a list, unless campaigns still attach it as an allow
+// or block list; the error then names them.
+func (s *Service) DeleteList(ctx context.Context, listID uuid.UUID) error {
+	campaigns, err := s.attachedCampaigns(ctx, listID)
+	if err != nil {
+		return err
+	}
+	if len(campaigns) > 0 {
+		return fmt.Errorf("%w: %s", ErrListInUse, strings.Join(campaigns, ", "))
+	}
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM inventory_lists WHERE id = $1`, listID)
+	if err != nil {
+		return fmt.Errorf("failed to delete inventory list: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrListNotFound
+	}
+
+	s.mu.Lock()
+	s.writes++
+	s.deleted[listID] = s.writes
+	delete(s.lists, listID)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// attachedCampaigns returns the names of the campaigns whose targeting
+// rules attach the list.
+func (s *Service) attachedCampaigns(ctx context.Context, listID uuid.UUID) ([]string, error) {
+	query := `
+		SELECT name FROM campaigns
+		WHERE targeting_rules->'inventory_lists'->'allow' ? $1
+			OR targeting_rules->'inventory_lists'->'block' ? $1
+		ORDER BY name
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, listID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find campaigns using inventory list: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan campaign: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find campaigns using inventory list: %w", err)
+	}
+
+	return names, nil
+}
+
+// UploadEntries adds already-normalized entries to a list, or replaces its
+// entries when replace is set. Entries are streamed into a temporary table
+// with COPY and merged in one statement, so uploads of hundreds of thousands
+// of entries take one round trip per batch rather than one per entry.
+func (s *Service) UploadEntries(ctx context.Context, listID uuid.UUID, entries []string, replace bool) (*models.InventoryList, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin upload: %w", err)
+	}
+	defer tx.Rollback()
+
+	list, err := scanList(tx.QueryRowContext(ctx, `
+		SELECT id, name, type, entry_count, created_at, updated_at
+		FROM inventory_lists WHERE id = $1 FOR UPDATE
+	`, listID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrListNotFound
+		}
+		return nil, fmt.Errorf("failed to get inventory list: %w", err)
+	}
+
+	if replace {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM inventory_list_entries WHERE list_id = $1`, listID); err != nil {
+			return nil, fmt.Errorf("failed to clear inventory list: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `CREATE TEMP TABLE inventory_upload (value VARCHAR(255)) ON COMMIT DROP`); err != nil {
+		return nil, fmt.Errorf("failed to stage upload: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("inventory_upload", "value"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage upload: %w", err)
+	}
+	for _, entry := range entries {
+		if _, err := stmt.ExecContext(ctx, entry); err != nil {
+			stmt.Close()
+			return nil, fmt.Errorf("failed to stage upload: %w", err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return nil, fmt.Errorf("failed to stage upload: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return nil, fmt.Errorf("failed to stage upload: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO inventory_list_entries (list_id, value)
+		SELECT DISTINCT $1::UUID, value FROM inventory_upload
+		ON CONFLICT DO NOTHING
+	`, listID); err != nil {
+		return nil, fmt.Errorf("failed to save inventory list entries: %w", err)
+	}
+
+	list.UpdatedAt = time.Now()
+	if err := tx.QueryRowContext(ctx, `
+		UPDATE inventory_lists SET
+			entry_count = (SELECT COUNT(*) FROM inventory_list_entries WHERE list_id = $1),
+			updated_at = $2
+		WHERE id = $1
+		RETURNING entry_count
+	`, listID, list.UpdatedAt).Scan(&list.EntryCount); err != nil {
+		return nil, fmt.Errorf("failed to update inventory list: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit upload: %w", err)
+	}
+
+	compiled, err := s.compile(ctx, list)
+	if err != nil {
+		s.logger.WithError(err).WithField("list_id", listID).Warn("Failed to reload inventory list after upload")
+		return list, nil
+	}
+	s.mu.Lock()
+	s.storeLocked(compiled)
+	s.mu.Unlock()
+
+	return list, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanList(row rowScanner) (*models.InventoryList, error) {
+	list := &models.InventoryList{}
+	err := row.Scan(&list.ID, &list.Name, &list.Type, &list.EntryCount, &list.CreatedAt, &list.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,86 @@
+package inventory
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/sqltest"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var listColumns = []string{"id", "name", "type", "entry_count", "created_at", "updated_at"}
+
+func listRow(list *models.InventoryList) []driver.Value {
+	return []driver.Value{list.ID.String(), list.Name, string(list.Type), int64(list.EntryCount), list.CreatedAt, list.UpdatedAt}
+}
+
+func TestService_RefreshKeepsConcurrentWrites(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	s := NewService(db, logrus.New())
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	kept := &models.InventoryList{ID: uuid.New(), Name: "Kept", Type: models.InventoryListDomain, CreatedAt: now, UpdatedAt: now}
+	deleted := &models.InventoryList{ID: uuid.New(), Name: "Deleted", Type: models.InventoryListDomain, CreatedAt: now, UpdatedAt: now}
+	mock.OnQuery("FROM inventory_lists ORDER BY name", listColumns, listRow(kept), listRow(deleted))
+	mock.OnQuery("FROM inventory_list_entries", []string{"value"}, []driver.Value{"example.com"})
+	require.NoError(t, s.Refresh(ctx))
+	require.True(t, s.Exists(deleted.ID))
+
+	mock.OnExec("INSERT INTO inventory_lists", 1)
+	mock.OnExec("DELETE FROM inventory_lists", 1)
+	mock.OnQuery("FROM campaigns", []string{"name"})
+
+	// The list is created and the other deleted after the refresh has read
+	// the lists, so its snapshot still has the old state.
+	created := &models.InventoryList{Name: "Created", Type: models.InventoryListBundle}
+	var once sync.Once
+	mock.OnCall("FROM inventory_lists ORDER BY name", func() {
+		once.Do(func() {
+			require.NoError(t, s.CreateList(ctx, created))
+			require.NoError(t, s.DeleteList(ctx, deleted.ID))
+		})
+	})
+	require.NoError(t, s.Refresh(ctx))
+
+	assert.True(t, s.Exists(kept.ID))
+	assert.True(t, s.Exists(created.ID), "a list created during the refresh is kept")
+	assert.False(t, s.Exists(deleted.ID), "a list deleted during the refresh stays deleted")
+
+	mock.OnQuery("FROM inventory_lists ORDER BY name", listColumns, listRow(kept))
+	require.NoError(t, s.Refresh(ctx))
+	assert.False(t, s.Exists(created.ID), "lists written before a refresh follow Postgres")
+}
+
+func TestService_DeleteListInUse(t *testing.T) {
+	db, mock := sqltest.Open(t)
+	s := NewService(db, logrus.New())
+	ctx := context.Background()
+
+	list := &models.InventoryList{ID: uuid.New(), Name: "Blocklist", Type: models.InventoryListDomain}
+	s.lists[list.ID] = &cachedList{list: *list, matcher: newMatcher(list.Type, nil)}
+
+	mock.OnExec("DELETE FROM inventory_lists", 1)
+	mock.OnQuery("FROM campaigns", []string{"name"}, []driver.Value{"Spring sale"}, []driver.Value{"Summer sale"})
+
+	err := s.DeleteList(ctx, list.ID)
+	assert.ErrorIs(t, err, ErrListInUse)
+	assert.EqualError(t, err, "inventory list is attached to campaigns: Spring sale, Summer sale")
+	assert.True(t, s.Exists(list.ID))
+	assert.Empty(t, mock.Calls("DELETE FROM inventory_lists"))
+
+	calls := mock.Calls("FROM campaigns")
+	require.Len(t, calls, 1)
+	assert.Equal(t, list.ID.String(), calls[0].Args[0])
+
+	mock.OnQuery("FROM campaigns", []string{"name"})
+	require.NoError(t, s.DeleteList(ctx, list.ID))
+	assert.False(t, s.Exists(list.ID))
+}
@@ -0,0 +1,54 @@
+package inventory
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+// maxReportedErrors caps how many invalid entries an upload reports.
+const maxReportedErrors = 100
+
+// EntryError is an invalid line in an upload.
+type EntryError struct {
+	Line    int    `json:"line"`
+	Entry   string `json:"entry"`
+	Message string `json:"message"`
+}
+
+// ParseEntries reads one entry per line, skipping blank lines and # comments,
+// and normalizes each for listType. Duplicates are dropped. It returns the
+// first invalid entries, if any, alongside the valid ones.
+func ParseEntries(r io.Reader, listType models.InventoryListType) ([]string, []EntryError, error) {
+	var entries []string
+	var invalid []EntryError
+	seen := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			continue
+		}
+
+		entry, err := Normalize(listType, raw)
+		if err != nil {
+			if len(invalid) < maxReportedErrors {
+				invalid = append(invalid, EntryError{Line: line, Entry: raw, Message: err.Error()})
+			}
+			continue
+		}
+		if _, exists := seen[entry]; exists {
+			continue
+		}
+		seen[entry] = struct{}{}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return entries, invalid, nil
+}
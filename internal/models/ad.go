@@ -7,22 +7,33 @@ import (
 )
 
 type AdCreative struct {
-	ID           uuid.UUID      `json:"id" db:"id"`
-	CampaignID   uuid.UUID      `json:"campaign_id" db:"campaign_id"`
-	Name         string         `json:"name" db:"name"`
-	Type         CreativeType   `json:"type" db:"type"`
-	Format       CreativeFormat `json:"format" db:"format"`
-	Width        int            `json:"width" db:"width"`
-	Height       int            `json:"height" db:"height"`
-	AssetURL     string         `json:"asset_url" db:"asset_url"`
-	ClickURL     string         `json:"click_url" db:"click_url"`
-	ImpressionURL string        `json:"impression_url" db:"impression_url"`
-	HTML         string         `json:"html" db:"html"`
-	Status       string         `json:"status" db:"status"`
-	CreatedAt    time.Time      `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at" db:"updated_at"`
+	ID            uuid.UUID       `json:"id" db:"id"`
+	CampaignID    uuid.UUID       `json:"campaign_id" db:"campaign_id"`
+	Name          string          `json:"name" db:"name"`
+	Type          CreativeType    `json:"type" db:"type"`
+	Format        CreativeFormat  `json:"format" db:"format"`
+	Width         int             `json:"width" db:"width"`
+	Height        int             `json:"height" db:"height"`
+	AssetURL      string          `json:"asset_url" db:"asset_url"`
+	ClickURL      string          `json:"click_url" db:"click_url"`
+	ImpressionURL string          `json:"impression_url" db:"impression_url"`
+	HTML          string          `json:"html" db:"html"`
+	Duration      int             `json:"duration" db:"duration"`
+	MIMEType      string          `json:"mime_type" db:"mime_type"`
+	Skippable     bool            `json:"skippable" db:"skippable"`
+	SkipOffset    int             `json:"skip_offset" db:"skip_offset"`
+	Native        *NativeCreative `json:"native,omitempty" db:"native_assets"`
+	Status        string          `json:"status" db:"status"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at" db:"updated_at"`
 }
 
+const (
+	CreativeStatusActive   = "active"
+	CreativeStatusPaused   = "paused"
+	CreativeStatusArchived = "archived"
+)
+
 type CreativeType string
 
 const (
@@ -45,19 +56,22 @@ const (
 )
 
 type TrackingEvent struct {
-	ID           uuid.UUID  `json:"id" db:"id"`
-	Type         EventType  `json:"type" db:"type"`
-	CampaignID   uuid.UUID  `json:"campaign_id" db:"campaign_id"`
-	CreativeID   uuid.UUID  `json:"creative_id" db:"creative_id"`
-	UserID       string     `json:"user_id" db:"user_id"`
-	SessionID    string     `json:"session_id" db:"session_id"`
-	IP           string     `json:"ip" db:"ip"`
-	UserAgent    string     `json:"user_agent" db:"user_agent"`
-	Referrer     string     `json:"referrer" db:"referrer"`
-	Price        float64    `json:"price" db:"price"`
-	Timestamp    time.Time  `json:"timestamp" db:"timestamp"`
-	ProcessedAt  *time.Time `json:"processed_at" db:"processed_at"`
-	Metadata     string     `json:"metadata" db:"metadata"`
+	ID          uuid.UUID  `json:"id" db:"id"`
+	Type        EventType  `json:"type" db:"type"`
+	CampaignID  uuid.UUID  `json:"campaign_id" db:"campaign_id"`
+	CreativeID  uuid.UUID  `json:"creative_id" db:"creative_id"`
+	UserID      string     `json:"user_id" db:"user_id"`
+	SessionID   string     `json:"session_id" db:"session_id"`
+	IP          string     `json:"ip" db:"ip"`
+	UserAgent   string     `json:"user_agent" db:"user_agent"`
+	Referrer    string     `json:"referrer" db:"referrer"`
+	SiteID      string     `json:"site_id,omitempty" db:"site_id"`
+	DeviceType  int        `json:"device_type,omitempty" db:"device_type"`
+	Test        bool       `json:"test,omitempty" db:"-"`
+	Price       float64    `json:"price" db:"price"`
+	Timestamp   time.Time  `json:"timestamp" db:"timestamp"`
+	ProcessedAt *time.Time `json:"processed_at" db:"processed_at"`
+	Metadata    string     `json:"metadata" db:"metadata"`
 }
 
 type EventType string
@@ -67,16 +81,32 @@ const (
 	EventTypeClick      EventType = "click"
 	EventTypeConversion EventType = "conversion"
 	EventTypeViewable   EventType = "viewable"
+
+	EventTypeVideoStart         EventType = "video_start"
+	EventTypeVideoFirstQuartile EventType = "video_first_quartile"
+	EventTypeVideoMidpoint      EventType = "video_midpoint"
+	EventTypeVideoThirdQuartile EventType = "video_third_quartile"
+	EventTypeVideoComplete      EventType = "video_complete"
+)
+
+type AuctionType string
+
+const (
+	AuctionTypeFirstPrice  AuctionType = "first-price"
+	AuctionTypeSecondPrice AuctionType = "second-price"
+	AuctionTypeFixedPrice  AuctionType = "fixed-price"
 )
 
 type AuctionResult struct {
-	ID              uuid.UUID  `json:"id"`
-	BidRequestID    string     `json:"bid_request_id"`
-	WinningBidID    *uuid.UUID `json:"winning_bid_id"`
-	WinningPrice    float64    `json:"winning_price"`
-	SecondPrice     float64    `json:"second_price"`
-	TotalBids       int        `json:"total_bids"`
-	AuctionType     string     `json:"auction_type"`
-	ProcessingTime  int64      `json:"processing_time_ms"`
-	Timestamp       time.Time  `json:"timestamp"`
+	ID             uuid.UUID   `json:"id"`
+	BidRequestID   string      `json:"bid_request_id"`
+	ImpID          string      `json:"imp_id"`
+	WinningBidID   *uuid.UUID  `json:"winning_bid_id"`
+	WinningPrice   float64     `json:"winning_price"`
+	WinningBid     float64     `json:"winning_bid"`
+	SecondPrice    float64     `json:"second_price"`
+	TotalBids      int         `json:"total_bids"`
+	AuctionType    AuctionType `json:"auction_type"`
+	ProcessingTime int64       `json:"processing_time_ms"`
+	Timestamp      time.Time   `json:"timestamp"`
 }
\ No newline at end of file
@@ -39,6 +39,10 @@ type BidResponse struct {
 	Ext        interface{} `json:"ext,omitempty"`
 }
 
+type BidResponseExt struct {
+	Test int `json:"test,omitempty"`
+}
+
 type SeatBid struct {
 	Bid   []Bid       `json:"bid"`
 	Seat  string      `json:"seat,omitempty"`
@@ -47,35 +51,45 @@ type SeatBid struct {
 }
 
 type Bid struct {
-	ID          string      `json:"id"`
-	ImpID       string      `json:"impid"`
-	Price       float64     `json:"price"`
-	NURL        string      `json:"nurl,omitempty"`
-	BURL        string      `json:"burl,omitempty"`
-	LURL        string      `json:"lurl,omitempty"`
-	AdM         string      `json:"adm,omitempty"`
-	AdID        string      `json:"adid,omitempty"`
-	ADomain     []string    `json:"adomain,omitempty"`
-	Bundle      string      `json:"bundle,omitempty"`
-	IURL        string      `json:"iurl,omitempty"`
-	CID         string      `json:"cid,omitempty"`
-	CrID        string      `json:"crid,omitempty"`
-	Tactic      string      `json:"tactic,omitempty"`
-	Cat         []string    `json:"cat,omitempty"`
-	Attr        []int       `json:"attr,omitempty"`
-	API         int         `json:"api,omitempty"`
-	Protocol    int         `json:"protocol,omitempty"`
-	QAGMediaRating int      `json:"qagmediarating,omitempty"`
-	Language    string      `json:"language,omitempty"`
-	DealID      string      `json:"dealid,omitempty"`
-	W           int         `json:"w,omitempty"`
-	H           int         `json:"h,omitempty"`
-	WRatio      int         `json:"wratio,omitempty"`
-	HRatio      int         `json:"hratio,omitempty"`
-	Exp         int         `json:"exp,omitempty"`
-	Ext         interface{} `json:"ext,omitempty"`
+	ID             string      `json:"id"`
+	ImpID          string      `json:"impid"`
+	Price          float64     `json:"price"`
+	NURL           string      `json:"nurl,omitempty"`
+	BURL           string      `json:"burl,omitempty"`
+	LURL           string      `json:"lurl,omitempty"`
+	AdM            string      `json:"adm,omitempty"`
+	AdID           string      `json:"adid,omitempty"`
+	ADomain        []string    `json:"adomain,omitempty"`
+	Bundle         string      `json:"bundle,omitempty"`
+	IURL           string      `json:"iurl,omitempty"`
+	CID            string      `json:"cid,omitempty"`
+	CrID           string      `json:"crid,omitempty"`
+	Tactic         string      `json:"tactic,omitempty"`
+	Cat            []string    `json:"cat,omitempty"`
+	Attr           []int       `json:"attr,omitempty"`
+	API            int         `json:"api,omitempty"`
+	Protocol       int         `json:"protocol,omitempty"`
+	QAGMediaRating int         `json:"qagmediarating,omitempty"`
+	Language       string      `json:"language,omitempty"`
+	DealID         string      `json:"dealid,omitempty"`
+	W              int         `json:"w,omitempty"`
+	H              int         `json:"h,omitempty"`
+	WRatio         int         `json:"wratio,omitempty"`
+	HRatio         int         `json:"hratio,omitempty"`
+	Exp            int         `json:"exp,omitempty"`
+	MType          int         `json:"mtype,omitempty"`
+	Dur            int         `json:"dur,omitempty"`
+	Ext            interface{} `json:"ext,omitempty"`
 }
 
+// Bid mtype values.
+const (
+	MarkupBanner = 1
+	MarkupVideo  = 2
+	MarkupAudio  = 3
+	MarkupNative = 4
+)
+
 type Impression struct {
 	ID                string      `json:"id"`
 	Metric            []Metric    `json:"metric,omitempty"`
@@ -94,6 +108,7 @@ type Impression struct {
 	Secure            int         `json:"secure,omitempty"`
 	IFrameBuster      []string    `json:"iframebuster,omitempty"`
 	Exp               int         `json:"exp,omitempty"`
+	Rwdd              int         `json:"rwdd,omitempty"`
 	Ext               interface{} `json:"ext,omitempty"`
 }
 
@@ -152,9 +167,23 @@ type Video struct {
 	CompanionAd    []Banner    `json:"companionad,omitempty"`
 	API            []int       `json:"api,omitempty"`
 	CompanionType  []int       `json:"companiontype,omitempty"`
+	RqdDurs        []int       `json:"rqddurs,omitempty"`
+	PodID          string      `json:"podid,omitempty"`
+	PodDur         int         `json:"poddur,omitempty"`
+	PodSeq         int         `json:"podseq,omitempty"`
+	SlotInPod      int         `json:"slotinpod,omitempty"`
+	MaxSeq         int         `json:"maxseq,omitempty"`
 	Ext            interface{} `json:"ext,omitempty"`
 }
 
+// Video slotinpod values.
+const (
+	SlotInPodAny         = 0
+	SlotInPodFirst       = 1
+	SlotInPodFirstOrLast = 2
+	SlotInPodLast        = -1
+)
+
 type Audio struct {
 	MIMEs         []string    `json:"mimes"`
 	MinDuration   int         `json:"minduration,omitempty"`
@@ -186,43 +215,46 @@ type Native struct {
 }
 
 type Site struct {
-	ID            string      `json:"id,omitempty"`
-	Name          string      `json:"name,omitempty"`
-	Domain        string      `json:"domain,omitempty"`
-	Cat           []string    `json:"cat,omitempty"`
-	SectionCat    []string    `json:"sectioncat,omitempty"`
-	PageCat       []string    `json:"pagecat,omitempty"`
-	Page          string      `json:"page,omitempty"`
-	Ref           string      `json:"ref,omitempty"`
-	Search        string      `json:"search,omitempty"`
-	Mobile        int         `json:"mobile,omitempty"`
-	PrivacyPolicy int         `json:"privacypolicy,omitempty"`
-	Publisher     *Publisher  `json:"publisher,omitempty"`
-	Content       *Content    `json:"content,omitempty"`
-	Keywords      string      `json:"keywords,omitempty"`
-	Ext           interface{} `json:"ext,omitempty"`
+	ID                     string      `json:"id,omitempty"`
+	Name                   string      `json:"name,omitempty"`
+	Domain                 string      `json:"domain,omitempty"`
+	Cat                    []string    `json:"cat,omitempty"`
+	SectionCat             []string    `json:"sectioncat,omitempty"`
+	PageCat                []string    `json:"pagecat,omitempty"`
+	Page                   string      `json:"page,omitempty"`
+	Ref                    string      `json:"ref,omitempty"`
+	Search                 string      `json:"search,omitempty"`
+	Mobile                 int         `json:"mobile,omitempty"`
+	PrivacyPolicy          int         `json:"privacypolicy,omitempty"`
+	Publisher              *Publisher  `json:"publisher,omitempty"`
+	Content                *Content    `json:"content,omitempty"`
+	Keywords               string      `json:"keywords,omitempty"`
+	InventoryPartnerDomain string      `json:"inventorypartnerdomain,omitempty"`
+	Ext                    interface{} `json:"ext,omitempty"`
 }
 
 type App struct {
-	ID            string      `json:"id,omitempty"`
-	Name          string      `json:"name,omitempty"`
-	Bundle        string      `json:"bundle,omitempty"`
-	Domain        string      `json:"domain,omitempty"`
-	StoreURL      string      `json:"storeurl,omitempty"`
-	Cat           []string    `json:"cat,omitempty"`
-	SectionCat    []string    `json:"sectioncat,omitempty"`
-	PageCat       []string    `json:"pagecat,omitempty"`
-	Ver           string      `json:"ver,omitempty"`
-	PrivacyPolicy int         `json:"privacypolicy,omitempty"`
-	Paid          int         `json:"paid,omitempty"`
-	Publisher     *Publisher  `json:"publisher,omitempty"`
-	Content       *Content    `json:"content,omitempty"`
-	Keywords      string      `json:"keywords,omitempty"`
-	Ext           interface{} `json:"ext,omitempty"`
+	ID                     string      `json:"id,omitempty"`
+	Name                   string      `json:"name,omitempty"`
+	Bundle                 string      `json:"bundle,omitempty"`
+	Domain                 string      `json:"domain,omitempty"`
+	StoreURL               string      `json:"storeurl,omitempty"`
+	Cat                    []string    `json:"cat,omitempty"`
+	SectionCat             []string    `json:"sectioncat,omitempty"`
+	PageCat                []string    `json:"pagecat,omitempty"`
+	Ver                    string      `json:"ver,omitempty"`
+	PrivacyPolicy          int         `json:"privacypolicy,omitempty"`
+	Paid                   int         `json:"paid,omitempty"`
+	Publisher              *Publisher  `json:"publisher,omitempty"`
+	Content                *Content    `json:"content,omitempty"`
+	Keywords               string      `json:"keywords,omitempty"`
+	InventoryPartnerDomain string      `json:"inventorypartnerdomain,omitempty"`
+	Ext                    interface{} `json:"ext,omitempty"`
 }
 
 type Device struct {
 	UA             string      `json:"ua,omitempty"`
+	SUA            *UserAgent  `json:"sua,omitempty"`
 	Geo            *Geo        `json:"geo,omitempty"`
 	DNT            int         `json:"dnt,omitempty"`
 	LMT            int         `json:"lmt,omitempty"`
@@ -264,9 +296,46 @@ type User struct {
 	CustomData string      `json:"customdata,omitempty"`
 	Geo        *Geo        `json:"geo,omitempty"`
 	Data       []Data      `json:"data,omitempty"`
+	Consent    string      `json:"consent,omitempty"`
+	EIDs       []EID       `json:"eids,omitempty"`
 	Ext        interface{} `json:"ext,omitempty"`
 }
 
+// UserAgent is the structured user agent from User-Agent Client Hints.
+type UserAgent struct {
+	Browsers     []BrandVersion `json:"browsers,omitempty"`
+	Platform     *BrandVersion  `json:"platform,omitempty"`
+	Mobile       int            `json:"mobile,omitempty"`
+	Architecture string         `json:"architecture,omitempty"`
+	Bitness      string         `json:"bitness,omitempty"`
+	Model        string         `json:"model,omitempty"`
+	Source       int            `json:"source,omitempty"`
+	Ext          interface{}    `json:"ext,omitempty"`
+}
+
+type BrandVersion struct {
+	Brand   string      `json:"brand"`
+	Version []string    `json:"version,omitempty"`
+	Ext     interface{} `json:"ext,omitempty"`
+}
+
+// EID is a set of user IDs from one identity source, such as a UID2 or
+// ID5 provider.
+type EID struct {
+	Inserter string      `json:"inserter,omitempty"`
+	Source   string      `json:"source"`
+	Matcher  string      `json:"matcher,omitempty"`
+	MM       int         `json:"mm,omitempty"`
+	UIDs     []UID       `json:"uids"`
+	Ext      interface{} `json:"ext,omitempty"`
+}
+
+type UID struct {
+	ID    string      `json:"id"`
+	AType int         `json:"atype,omitempty"`
+	Ext   interface{} `json:"ext,omitempty"`
+}
+
 type Geo struct {
 	Lat           float64     `json:"lat,omitempty"`
 	Lon           float64     `json:"lon,omitempty"`
@@ -367,14 +436,38 @@ type Metric struct {
 }
 
 type Source struct {
-	FD     int         `json:"fd,omitempty"`
-	TID    string      `json:"tid,omitempty"`
-	PChain string      `json:"pchain,omitempty"`
+	FD     int          `json:"fd,omitempty"`
+	TID    string       `json:"tid,omitempty"`
+	PChain string       `json:"pchain,omitempty"`
+	SChain *SupplyChain `json:"schain,omitempty"`
+	Ext    interface{}  `json:"ext,omitempty"`
+}
+
+// SupplyChain lists every seller that took part in selling the impression,
+// from the publisher onward.
+type SupplyChain struct {
+	Complete int               `json:"complete"`
+	Nodes    []SupplyChainNode `json:"nodes"`
+	Ver      string            `json:"ver"`
+	Ext      interface{}       `json:"ext,omitempty"`
+}
+
+type SupplyChainNode struct {
+	ASI    string      `json:"asi"`
+	SID    string      `json:"sid"`
+	RID    string      `json:"rid,omitempty"`
+	Name   string      `json:"name,omitempty"`
+	Domain string      `json:"domain,omitempty"`
+	HP     int         `json:"hp"`
 	Ext    interface{} `json:"ext,omitempty"`
 }
 
 type Regs struct {
 	CoppaCompliant int         `json:"coppa,omitempty"`
+	GDPR           *int        `json:"gdpr,omitempty"`
+	USPrivacy      string      `json:"us_privacy,omitempty"`
+	GPP            string      `json:"gpp,omitempty"`
+	GPPSID         []int       `json:"gpp_sid,omitempty"`
 	Ext            interface{} `json:"ext,omitempty"`
 }
 
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -23,31 +24,113 @@ const (
 	BidTypeCPA BidType = "CPA"
 )
 
+// CampaignPriority is a campaign's line-item tier. A bid from a higher tier
+// beats any bid from a lower one; price only decides within a tier.
+type CampaignPriority string
+
+const (
+	PrioritySponsorship   CampaignPriority = "sponsorship"
+	PriorityGuaranteed    CampaignPriority = "guaranteed"
+	PriorityPricePriority CampaignPriority = "price_priority"
+	PriorityHouse         CampaignPriority = "house"
+)
+
+// Tier ranks priorities from house (0) up to sponsorship (3). Campaigns
+// without a priority are price priority.
+func (p CampaignPriority) Tier() int {
+	switch p {
+	case PrioritySponsorship:
+		return 3
+	case PriorityGuaranteed:
+		return 2
+	case PriorityHouse:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// DeliveryGoal is how many impressions a guaranteed campaign has to deliver
+// between its start and end dates. Delivery is counted from billing notices.
+type DeliveryGoal struct {
+	Impressions int64 `json:"impressions"`
+}
+
 type Campaign struct {
-	ID               uuid.UUID         `json:"id" db:"id"`
-	Name             string            `json:"name" db:"name"`
-	AdvertiserID     string            `json:"advertiser_id" db:"advertiser_id"`
-	Status           CampaignStatus    `json:"status" db:"status"`
-	BudgetDaily      float64           `json:"budget_daily" db:"budget_daily"`
-	BudgetTotal      float64           `json:"budget_total" db:"budget_total"`
-	SpentDaily       float64           `json:"spent_daily" db:"spent_daily"`
-	SpentTotal       float64           `json:"spent_total" db:"spent_total"`
-	BidType          BidType           `json:"bid_type" db:"bid_type"`
-	BidAmount        float64           `json:"bid_amount" db:"bid_amount"`
-	TargetingRules   *TargetingRules   `json:"targeting_rules" db:"targeting_rules"`
-	FrequencyCapping *FrequencyCapping `json:"frequency_capping" db:"frequency_capping"`
-	StartDate        time.Time         `json:"start_date" db:"start_date"`
-	EndDate          *time.Time        `json:"end_date" db:"end_date"`
-	CreatedAt        time.Time         `json:"created_at" db:"created_at"`
-	UpdatedAt        time.Time         `json:"updated_at" db:"updated_at"`
+	ID                uuid.UUID          `json:"id" db:"id"`
+	Name              string             `json:"name" db:"name"`
+	AdvertiserID      string             `json:"advertiser_id" db:"advertiser_id"`
+	Seat              string             `json:"seat" db:"seat"`
+	AdvertiserDomains []string           `json:"advertiser_domains" db:"advertiser_domains"`
+	Categories        []string           `json:"categories" db:"categories"`
+	AppBundle         string             `json:"app_bundle" db:"app_bundle"`
+	Status            CampaignStatus     `json:"status" db:"status"`
+	Priority          CampaignPriority   `json:"priority" db:"priority"`
+	DeliveryGoal      *DeliveryGoal      `json:"delivery_goal,omitempty" db:"delivery_goal"`
+	BudgetDaily       float64            `json:"budget_daily" db:"budget_daily"`
+	BudgetTotal       float64            `json:"budget_total" db:"budget_total"`
+	SpentDaily        float64            `json:"spent_daily" db:"spent_daily"`
+	SpentTotal        float64            `json:"spent_total" db:"spent_total"`
+	BidType           BidType            `json:"bid_type" db:"bid_type"`
+	BidAmount         float64            `json:"bid_amount" db:"bid_amount"`
+	BidStrategy       string             `json:"bid_strategy" db:"bid_strategy"`
+	BidStrategyParams map[string]float64 `json:"bid_strategy_params" db:"bid_strategy_params"`
+	DealIDs           []string           `json:"deal_ids" db:"deal_ids"`
+	// CompetitiveLabels keep the campaign out of the other slots of a request
+	// won by a campaign with a shared label, advertiser or IAB category.
+	CompetitiveLabels []string          `json:"competitive_labels" db:"competitive_labels"`
+	TargetingRules    *TargetingRules   `json:"targeting_rules" db:"targeting_rules"`
+	FrequencyCapping  *FrequencyCapping `json:"frequency_capping" db:"frequency_capping"`
+	StartDate         time.Time         `json:"start_date" db:"start_date"`
+	EndDate           *time.Time        `json:"end_date" db:"end_date"`
+	CreatedAt         time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+func (c *Campaign) SeatID() string {
+	if c.Seat != "" {
+		return c.Seat
+	}
+	return c.AdvertiserID
 }
 
 type TargetingRules struct {
-	GeoTargeting    []string          `json:"geo_targeting"`
-	DeviceTypes     []string          `json:"device_types"`
-	UserSegments    []string          `json:"user_segments"`
-	DayParting      []DayPartRule     `json:"day_parting"`
-	CustomTargeting map[string]string `json:"custom_targeting"`
+	GeoTargeting []string         `json:"geo_targeting"`
+	Geo          []GeoRule        `json:"geo"`
+	DeviceTypes  []string         `json:"device_types"`
+	Device       *DeviceTargeting `json:"device,omitempty"`
+	UserSegments []string         `json:"user_segments"`
+	AdSizes      []string         `json:"ad_sizes"`
+	DayParting   []DayPartRule    `json:"day_parting"`
+	// DayPartTimezone is the IANA zone day_parting is evaluated in. With
+	// DayPartUserTime, the user's geo.utcoffset is used instead when the
+	// request has one.
+	DayPartTimezone string             `json:"day_part_timezone,omitempty"`
+	DayPartUserTime bool               `json:"day_part_user_time,omitempty"`
+	CustomTargeting map[string]string  `json:"custom_targeting"`
+	KeyValues       *KeyValueTargeting `json:"key_values"`
+	Content         *ContentTargeting  `json:"content,omitempty"`
+	InventoryLists  *InventoryListRefs `json:"inventory_lists,omitempty"`
+	// Expression, when set, replaces the geo, device type, device, segment,
+	// content and day-part rules above with a boolean targeting expression;
+	// see internal/targeting.
+	Expression string `json:"expression,omitempty"`
+}
+
+type KeyValueMatch string
+
+const (
+	KeyValueMatchAll KeyValueMatch = "all"
+	KeyValueMatchAny KeyValueMatch = "any"
+)
+
+// KeyValueTargeting matches keys in the request's site.ext and imp.ext. A key
+// matches when the request carries any of its values; Match says whether every
+// key (the default) or any one key has to match. CustomTargeting is the older
+// form: every key must equal its single value.
+type KeyValueTargeting struct {
+	Match  KeyValueMatch       `json:"match"`
+	Values map[string][]string `json:"values"`
 }
 
 type DayPartRule struct {
@@ -72,4 +155,19 @@ type CampaignMetrics struct {
 	CPC         float64   `json:"cpc"`
 	CPM         float64   `json:"cpm"`
 	Date        time.Time `json:"date"`
-}
\ No newline at end of file
+}
+
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// Line and Column locate errors in a targeting expression.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("invalid %s at %d:%d: %s", e.Field, e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+}
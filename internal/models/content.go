@@ -0,0 +1,33 @@
+package models
+
+// ContentTargeting matches the page or app an ad would appear in.
+// Categories match the site or app's cat, sectioncat and pagecat and the
+// content's cat, and a parent category such as IAB17 covers its children.
+// Keywords match the site, app and content keywords, ignoring case. Every
+// list that is set must match; requests that don't carry a signal an
+// include list needs never match, while a missing signal passes an exclude.
+type ContentTargeting struct {
+	IncludeCategories []string `json:"include_categories,omitempty"`
+	ExcludeCategories []string `json:"exclude_categories,omitempty"`
+	IncludeKeywords   []string `json:"include_keywords,omitempty"`
+	ExcludeKeywords   []string `json:"exclude_keywords,omitempty"`
+	Languages         []string `json:"languages,omitempty"`
+	Genres            []string `json:"genres,omitempty"`
+	// Ratings are content ratings such as "TV-PG"; MaxMediaRating is the
+	// highest IQG media rating allowed (1 all audiences, 2 over 12, 3 mature).
+	Ratings        []string `json:"ratings,omitempty"`
+	MaxMediaRating int      `json:"max_media_rating,omitempty"`
+	// LiveStream, when set, requires live (true) or on-demand (false) content.
+	LiveStream *bool `json:"livestream,omitempty"`
+}
+
+// RequestContent returns the content object of the request's site or app.
+func (r *BidRequest) RequestContent() *Content {
+	if r.Site != nil {
+		return r.Site.Content
+	}
+	if r.App != nil {
+		return r.App.Content
+	}
+	return nil
+}
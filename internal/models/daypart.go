@@ -0,0 +1,52 @@
+package models
+
+import (
+	"sync"
+	"time"
+	_ "time/tzdata" // day-parting timezones must resolve on hosts without zoneinfo
+)
+
+// HoursPerWeek is the number of hour slots day-parting rules are laid out on.
+const HoursPerWeek = 7 * 24
+
+// Span returns how many hours the rule covers. A rule whose EndHour isn't
+// after its StartHour runs past midnight, so {day_of_week: 5, start_hour: 22,
+// end_hour: 2} covers Friday 10pm to Saturday 2am. Equal hours cover nothing.
+func (r DayPartRule) Span() int {
+	switch {
+	case r.EndHour == r.StartHour:
+		return 0
+	case r.EndHour > r.StartHour:
+		return r.EndHour - r.StartHour
+	}
+	return r.EndHour + 24 - r.StartHour
+}
+
+// Covers reports whether the hour starting at hour on weekday is in the rule.
+func (r DayPartRule) Covers(weekday time.Weekday, hour int) bool {
+	since := (int(weekday)*24 + hour - (r.DayOfWeek*24 + r.StartHour)) % HoursPerWeek
+	if since < 0 {
+		since += HoursPerWeek
+	}
+	return since < r.Span()
+}
+
+var locations sync.Map
+
+// DayPartLocation returns the timezone day_parting is evaluated in, or the
+// server's local zone when day_part_timezone isn't set.
+func (t *TargetingRules) DayPartLocation() (*time.Location, error) {
+	if t.DayPartTimezone == "" {
+		return time.Local, nil
+	}
+
+	if cached, ok := locations.Load(t.DayPartTimezone); ok {
+		return cached.(*time.Location), nil
+	}
+	location, err := time.LoadLocation(t.DayPartTimezone)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(t.DayPartTimezone, location)
+	return location, nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+type DealStatus string
+
+const (
+	DealStatusActive   DealStatus = "active"
+	DealStatusPaused   DealStatus = "paused"
+	DealStatusArchived DealStatus = "archived"
+)
+
+type PrivateDeal struct {
+	ID          string     `json:"id" db:"id"`
+	Name        string     `json:"name" db:"name"`
+	PublisherID string     `json:"publisher_id" db:"publisher_id"`
+	BidFloor    float64    `json:"bid_floor" db:"bid_floor"`
+	Priority    int        `json:"priority" db:"priority"`
+	Status      DealStatus `json:"status" db:"status"`
+	StartDate   *time.Time `json:"start_date" db:"start_date"`
+	EndDate     *time.Time `json:"end_date" db:"end_date"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+func (d *PrivateDeal) IsLive(now time.Time) bool {
+	if d.Status != DealStatusActive {
+		return false
+	}
+	if d.StartDate != nil && now.Before(*d.StartDate) {
+		return false
+	}
+	if d.EndDate != nil && !now.Before(*d.EndDate) {
+		return false
+	}
+	return true
+}
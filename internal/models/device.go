@@ -0,0 +1,114 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Filter is an include and exclude list of values. A value passes when
+// Include is empty or contains it, and Exclude doesn't. Requests that don't
+// carry the value fail a non-empty Include and pass Exclude.
+type Filter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// OSRange is an operating system, optionally limited to versions between
+// MinVersion and MaxVersion inclusive. Versions compare numerically to the
+// precision of the bound, so a max of "16" includes 16.4.
+type OSRange struct {
+	OS         string `json:"os"`
+	MinVersion string `json:"min_version,omitempty"`
+	MaxVersion string `json:"max_version,omitempty"`
+}
+
+// OSFilter includes and excludes OS version ranges. A request with an
+// unknown version can't match an include range with bounds, and is treated
+// as matching an exclude range with bounds for its OS.
+type OSFilter struct {
+	Include []OSRange `json:"include,omitempty"`
+	Exclude []OSRange `json:"exclude,omitempty"`
+}
+
+const (
+	InventoryApp  = "app"
+	InventorySite = "site"
+)
+
+// DeviceTargeting narrows a campaign by device, network and inventory.
+// Connection types are OpenRTB connectiontype codes as strings, like
+// device_types. Site domains also match their subdomains.
+type DeviceTargeting struct {
+	OS              *OSFilter `json:"os,omitempty"`
+	Make            *Filter   `json:"make,omitempty"`
+	Model           *Filter   `json:"model,omitempty"`
+	ConnectionTypes *Filter   `json:"connection_types,omitempty"`
+	Carrier         *Filter   `json:"carrier,omitempty"`
+	MCCMNC          *Filter   `json:"mccmnc,omitempty"`
+	Language        *Filter   `json:"language,omitempty"`
+	// InventoryType limits the campaign to "app" or "site" requests.
+	InventoryType string  `json:"inventory_type,omitempty"`
+	AppBundles    *Filter `json:"app_bundles,omitempty"`
+	SiteDomains   *Filter `json:"site_domains,omitempty"`
+}
+
+// ParseVersion splits a dotted version such as "17.4.1" into its numeric
+// components. It reports false for anything else.
+func ParseVersion(version string) ([]int, bool) {
+	if version == "" {
+		return nil, false
+	}
+
+	parts := strings.Split(version, ".")
+	components := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		components[i] = n
+	}
+	return components, true
+}
+
+// compareVersions compares version with bound on the bound's components
+// only, treating missing version components as 0.
+func compareVersions(version, bound []int) int {
+	for i, b := range bound {
+		v := 0
+		if i < len(version) {
+			v = version[i]
+		}
+		if v != b {
+			if v < b {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Contains reports whether a device running os at version is in the range.
+// known is false when the OS matches but the range has version bounds and
+// version is missing or unparseable.
+func (r OSRange) Contains(os, version string) (matched, known bool) {
+	if !strings.EqualFold(r.OS, os) {
+		return false, true
+	}
+	if r.MinVersion == "" && r.MaxVersion == "" {
+		return true, true
+	}
+
+	parsed, ok := ParseVersion(version)
+	if !ok {
+		return false, false
+	}
+	if min, ok := ParseVersion(r.MinVersion); ok && compareVersions(parsed, min) < 0 {
+		return false, true
+	}
+	if max, ok := ParseVersion(r.MaxVersion); ok && compareVersions(parsed, max) > 0 {
+		return false, true
+	}
+	return true, true
+}
@@ -0,0 +1,41 @@
+package models
+
+type GeoMode string
+
+const (
+	GeoModeInclude GeoMode = "include"
+	GeoModeExclude GeoMode = "exclude"
+)
+
+// GeoRule targets or excludes one location. Every field that is set must
+// match, so {country: "US", city: "Springfield", region: "IL"} is one city.
+// RadiusKM with Lat/Lon matches requests within that distance of the point.
+type GeoRule struct {
+	Mode     GeoMode `json:"mode"`
+	Country  string  `json:"country,omitempty"`
+	Region   string  `json:"region,omitempty"`
+	Metro    string  `json:"metro,omitempty"`
+	City     string  `json:"city,omitempty"`
+	ZIP      string  `json:"zip,omitempty"`
+	Lat      float64 `json:"lat,omitempty"`
+	Lon      float64 `json:"lon,omitempty"`
+	RadiusKM float64 `json:"radius_km,omitempty"`
+}
+
+func (r GeoRule) Excludes() bool {
+	return r.Mode == GeoModeExclude
+}
+
+// GeoRules returns the campaign's structured geo rules together with the
+// legacy geo_targeting country list, which is treated as country includes.
+func (t *TargetingRules) GeoRules() []GeoRule {
+	if len(t.GeoTargeting) == 0 {
+		return t.Geo
+	}
+
+	rules := make([]GeoRule, 0, len(t.GeoTargeting)+len(t.Geo))
+	for _, country := range t.GeoTargeting {
+		rules = append(rules, GeoRule{Mode: GeoModeInclude, Country: country})
+	}
+	return append(rules, t.Geo...)
+}
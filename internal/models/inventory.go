@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type InventoryListType string
+
+const (
+	InventoryListDomain    InventoryListType = "domain"
+	InventoryListBundle    InventoryListType = "bundle"
+	InventoryListPublisher InventoryListType = "publisher"
+	InventoryListIP        InventoryListType = "ip"
+)
+
+// InventoryList is a named, reusable list of site domains, app bundles,
+// publisher IDs or IP CIDRs that campaigns attach as allow or block lists.
+// Entries are uploaded separately and can number in the hundreds of
+// thousands.
+type InventoryList struct {
+	ID         uuid.UUID         `json:"id" db:"id"`
+	Name       string            `json:"name" db:"name"`
+	Type       InventoryListType `json:"type" db:"type"`
+	EntryCount int               `json:"entry_count" db:"entry_count"`
+	CreatedAt  time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// InventoryListRefs attaches inventory lists to a campaign. For each list
+// type with allow lists, the request must be in one of them; it must not be
+// in any block list.
+type InventoryListRefs struct {
+	Allow []uuid.UUID `json:"allow,omitempty"`
+	Block []uuid.UUID `json:"block,omitempty"`
+}
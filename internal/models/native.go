@@ -0,0 +1,173 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// OpenRTB Native 1.2 image asset types.
+const (
+	NativeImageTypeIcon = 1
+	NativeImageTypeMain = 3
+)
+
+// OpenRTB Native 1.2 data asset types.
+const (
+	NativeDataTypeSponsored = 1
+	NativeDataTypeDesc      = 2
+	NativeDataTypeCTAText   = 12
+)
+
+const (
+	NativeEventImpression = 1
+	NativeMethodImage     = 1
+)
+
+// NativeCreative holds the assets a native creative can offer.
+type NativeCreative struct {
+	Title     string       `json:"title"`
+	Body      string       `json:"body"`
+	CTA       string       `json:"cta"`
+	Sponsored string       `json:"sponsored"`
+	Image     *NativeImage `json:"image,omitempty"`
+	Icon      *NativeImage `json:"icon,omitempty"`
+}
+
+type NativeImage struct {
+	URL string `json:"url"`
+	W   int    `json:"w"`
+	H   int    `json:"h"`
+}
+
+type NativeRequest struct {
+	Ver           string               `json:"ver,omitempty"`
+	Context       int                  `json:"context,omitempty"`
+	PlcmtType     int                  `json:"plcmttype,omitempty"`
+	PlcmtCnt      int                  `json:"plcmtcnt,omitempty"`
+	Assets        []NativeRequestAsset `json:"assets"`
+	EventTrackers []NativeEventTracker `json:"eventtrackers,omitempty"`
+	Privacy       int                  `json:"privacy,omitempty"`
+
+	// Wrapped records whether the request used the Native 1.0 "native"
+	// envelope, so the response can be wrapped the same way.
+	Wrapped bool `json:"-"`
+}
+
+type NativeRequestAsset struct {
+	ID       int             `json:"id"`
+	Required int             `json:"required,omitempty"`
+	Title    *NativeTitleReq `json:"title,omitempty"`
+	Img      *NativeImageReq `json:"img,omitempty"`
+	Video    *Video          `json:"video,omitempty"`
+	Data     *NativeDataReq  `json:"data,omitempty"`
+}
+
+type NativeTitleReq struct {
+	Len int `json:"len"`
+}
+
+type NativeImageReq struct {
+	Type  int      `json:"type,omitempty"`
+	W     int      `json:"w,omitempty"`
+	WMin  int      `json:"wmin,omitempty"`
+	H     int      `json:"h,omitempty"`
+	HMin  int      `json:"hmin,omitempty"`
+	MIMEs []string `json:"mimes,omitempty"`
+}
+
+type NativeDataReq struct {
+	Type int `json:"type"`
+	Len  int `json:"len,omitempty"`
+}
+
+type NativeEventTracker struct {
+	Event   int   `json:"event"`
+	Methods []int `json:"methods"`
+}
+
+type NativeResponse struct {
+	Ver           string                   `json:"ver,omitempty"`
+	Assets        []NativeResponseAsset    `json:"assets"`
+	Link          NativeLink               `json:"link"`
+	ImpTrackers   []string                 `json:"imptrackers,omitempty"`
+	EventTrackers []NativeEventTrackerResp `json:"eventtrackers,omitempty"`
+}
+
+type NativeResponseAsset struct {
+	ID       int              `json:"id"`
+	Required int              `json:"required,omitempty"`
+	Title    *NativeTitleResp `json:"title,omitempty"`
+	Img      *NativeImageResp `json:"img,omitempty"`
+	Data     *NativeDataResp  `json:"data,omitempty"`
+}
+
+type NativeTitleResp struct {
+	Text string `json:"text"`
+	Len  int    `json:"len,omitempty"`
+}
+
+type NativeImageResp struct {
+	Type int    `json:"type,omitempty"`
+	URL  string `json:"url"`
+	W    int    `json:"w,omitempty"`
+	H    int    `json:"h,omitempty"`
+}
+
+type NativeDataResp struct {
+	Type  int    `json:"type,omitempty"`
+	Value string `json:"value"`
+	Len   int    `json:"len,omitempty"`
+}
+
+type NativeLink struct {
+	URL           string   `json:"url"`
+	ClickTrackers []string `json:"clicktrackers,omitempty"`
+}
+
+type NativeEventTrackerResp struct {
+	Event  int    `json:"event"`
+	Method int    `json:"method"`
+	URL    string `json:"url"`
+}
+
+// ParseRequest decodes the Native markup request carried in Native.Request.
+// Both the 1.2 bare object and the 1.0 {"native": {...}} envelope are accepted.
+func (n *Native) ParseRequest() (*NativeRequest, error) {
+	if n.Request == "" {
+		return nil, fmt.Errorf("empty native request")
+	}
+
+	var envelope struct {
+		Native *NativeRequest `json:"native"`
+	}
+	if err := json.Unmarshal([]byte(n.Request), &envelope); err != nil {
+		return nil, fmt.Errorf("invalid native request: %w", err)
+	}
+	if envelope.Native != nil {
+		envelope.Native.Wrapped = true
+		return envelope.Native, nil
+	}
+
+	var request NativeRequest
+	if err := json.Unmarshal([]byte(n.Request), &request); err != nil {
+		return nil, fmt.Errorf("invalid native request: %w", err)
+	}
+
+	return &request, nil
+}
+
+// SupportsEventTracker reports whether the request accepts the given
+// event/method pair through eventtrackers.
+func (r *NativeRequest) SupportsEventTracker(event, method int) bool {
+	for _, tracker := range r.EventTrackers {
+		if tracker.Event != event {
+			continue
+		}
+		for _, m := range tracker.Methods {
+			if m == method {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OpenRTB substitution macros used in nurl, burl and lurl.
+const (
+	MacroAuctionID    = "${AUCTION_ID}"
+	MacroAuctionPrice = "${AUCTION_PRICE}"
+	MacroAuctionLoss  = "${AUCTION_LOSS}"
+)
+
+type NoticeType string
+
+const (
+	NoticeTypeWin     NoticeType = "win"
+	NoticeTypeBilling NoticeType = "billing"
+	NoticeTypeLoss    NoticeType = "loss"
+)
+
+type AuctionNotice struct {
+	Type       NoticeType `json:"type"`
+	BidID      string     `json:"bid_id"`
+	CampaignID uuid.UUID  `json:"campaign_id"`
+	AuctionID  string     `json:"auction_id"`
+	Price      float64    `json:"price"`
+	LossReason int        `json:"loss_reason,omitempty"`
+	Charged    float64    `json:"charged,omitempty"`
+	Test       bool       `json:"test,omitempty"`
+	Timestamp  time.Time  `json:"timestamp"`
+}
+
+// BudgetHold is the budget a winning bid holds until its billing notice
+// arrives. Test bids hold nothing, but their hold still records the bid, so
+// notices can't change whether a bid counts as a test.
+type BudgetHold struct {
+	BidID      string
+	CampaignID uuid.UUID
+	AuctionID  string
+	Amount     float64
+	Test       bool
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// OpenRTB 2.6 promoted several fields that 2.5 senders carry in ext. The
+// decoders below fill the 2.6 field from its 2.5 ext location when the
+// request doesn't set it, so the rest of the code only reads the 2.6 field.
+// A malformed ext value is ignored rather than failing the request.
+
+// extFields returns the members of an object's ext, nil when it has none.
+func extFields(data []byte) map[string]json.RawMessage {
+	var object struct {
+		Ext map[string]json.RawMessage `json:"ext"`
+	}
+	if json.Unmarshal(data, &object) != nil {
+		return nil
+	}
+	return object.Ext
+}
+
+// fromExt decodes the ext member name into dst, reporting whether it was
+// present and well formed.
+func fromExt(ext map[string]json.RawMessage, name string, dst interface{}) bool {
+	raw, exists := ext[name]
+	if !exists {
+		return false
+	}
+	return json.Unmarshal(raw, dst) == nil
+}
+
+// UnmarshalJSON reads source.ext.schain for 2.5 senders.
+func (s *Source) UnmarshalJSON(data []byte) error {
+	type source Source
+	if err := json.Unmarshal(data, (*source)(s)); err != nil {
+		return err
+	}
+
+	if s.SChain == nil {
+		var schain SupplyChain
+		if fromExt(extFields(data), "schain", &schain) {
+			s.SChain = &schain
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON reads user.ext.eids and user.ext.consent for 2.5 senders.
+func (u *User) UnmarshalJSON(data []byte) error {
+	type user User
+	if err := json.Unmarshal(data, (*user)(u)); err != nil {
+		return err
+	}
+
+	ext := extFields(data)
+	if u.EIDs == nil {
+		var eids []EID
+		if fromExt(ext, "eids", &eids) {
+			u.EIDs = eids
+		}
+	}
+	if u.Consent == "" {
+		var consent string
+		if fromExt(ext, "consent", &consent) {
+			u.Consent = consent
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON reads regs.ext.gdpr, us_privacy, gpp and gpp_sid for 2.5
+// senders.
+func (r *Regs) UnmarshalJSON(data []byte) error {
+	type regs Regs
+	if err := json.Unmarshal(data, (*regs)(r)); err != nil {
+		return err
+	}
+
+	ext := extFields(data)
+	if r.GDPR == nil {
+		var gdpr int
+		if fromExt(ext, "gdpr", &gdpr) {
+			r.GDPR = &gdpr
+		}
+	}
+	if r.USPrivacy == "" {
+		var usPrivacy string
+		if fromExt(ext, "us_privacy", &usPrivacy) {
+			r.USPrivacy = usPrivacy
+		}
+	}
+	if r.GPP == "" {
+		var gpp string
+		if fromExt(ext, "gpp", &gpp) {
+			r.GPP = gpp
+		}
+	}
+	if r.GPPSID == nil {
+		var sids []int
+		if fromExt(ext, "gpp_sid", &sids) {
+			r.GPPSID = sids
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON reads video.ext.podid, poddur and maxseq, the ad pod
+// extension 2.5 senders use.
+func (v *Video) UnmarshalJSON(data []byte) error {
+	type video Video
+	if err := json.Unmarshal(data, (*video)(v)); err != nil {
+		return err
+	}
+
+	ext := extFields(data)
+	if v.PodID == "" {
+		var podID string
+		if fromExt(ext, "podid", &podID) {
+			v.PodID = podID
+		}
+	}
+	if v.PodDur == 0 {
+		var podDur int
+		if fromExt(ext, "poddur", &podDur) {
+			v.PodDur = podDur
+		}
+	}
+	if v.MaxSeq == 0 {
+		var maxSeq int
+		if fromExt(ext, "maxseq", &maxSeq) {
+			v.MaxSeq = maxSeq
+		}
+	}
+	return nil
+}
+
+// Platform returns the device's operating system and version, falling back
+// to the structured user agent's platform when os or osv is missing.
+func (d *Device) Platform() (os, osv string) {
+	os, osv = d.OS, d.OSV
+	if d.SUA == nil || d.SUA.Platform == nil {
+		return os, osv
+	}
+
+	brand := d.SUA.Platform.Brand
+	if os == "" {
+		os = brand
+	}
+	if osv == "" && strings.EqualFold(os, brand) {
+		osv = strings.Join(d.SUA.Platform.Version, ".")
+	}
+	return os, osv
+}
+
+// MarkupType is the bid mtype for creatives of type t, 0 when unknown.
+func MarkupType(t CreativeType) int {
+	switch t {
+	case CreativeTypeBanner:
+		return MarkupBanner
+	case CreativeTypeVideo:
+		return MarkupVideo
+	case CreativeTypeAudio:
+		return MarkupAudio
+	case CreativeTypeNative:
+		return MarkupNative
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBidRequest_DecodesOpenRTB25Ext(t *testing.T) {
+	body := `{
+		"id": "req-1",
+		"imp": [{"id": "1", "video": {"mimes": ["video/mp4"], "ext": {"podid": "break-1", "poddur": 60, "maxseq": 3}}}],
+		"device": {"ua": "Mozilla/5.0"},
+		"user": {"ext": {"consent": "CPXxRfAPXxRfAAfKABENB", "eids": [{"source": "uidapi.com", "uids": [{"id": "abc", "atype": 3}]}]}},
+		"source": {"tid": "t-1", "ext": {"schain": {"complete": 1, "ver": "1.0", "nodes": [{"asi": "exchange.com", "sid": "1234", "hp": 1}]}}},
+		"regs": {"ext": {"gdpr": 1, "us_privacy": "1YNN", "gpp": "DBABMA~CPXxRfAPXxRfAAfKABENB", "gpp_sid": [2]}}
+	}`
+
+	var request BidRequest
+	assert.NoError(t, json.Unmarshal([]byte(body), &request))
+
+	video := request.Imp[0].Video
+	assert.Equal(t, "break-1", video.PodID)
+	assert.Equal(t, 60, video.PodDur)
+	assert.Equal(t, 3, video.MaxSeq)
+
+	assert.Equal(t, "CPXxRfAPXxRfAAfKABENB", request.User.Consent)
+	assert.Equal(t, []EID{{Source: "uidapi.com", UIDs: []UID{{ID: "abc", AType: 3}}}}, request.User.EIDs)
+
+	assert.Equal(t, "t-1", request.Source.TID)
+	assert.Equal(t, &SupplyChain{Complete: 1, Ver: "1.0", Nodes: []SupplyChainNode{{ASI: "exchange.com", SID: "1234", HP: 1}}}, request.Source.SChain)
+
+	assert.Equal(t, 1, *request.Regs.GDPR)
+	assert.Equal(t, "1YNN", request.Regs.USPrivacy)
+	assert.Equal(t, "DBABMA~CPXxRfAPXxRfAAfKABENB", request.Regs.GPP)
+	assert.Equal(t, []int{2}, request.Regs.GPPSID)
+}
+
+func TestBidRequest_DecodesOpenRTB26(t *testing.T) {
+	body := `{
+		"id": "req-1",
+		"imp": [{"id": "1", "rwdd": 1, "video": {"podid": "break-1", "slotinpod": 1, "rqddurs": [15, 30], "ext": {"podid": "stale"}}}],
+		"site": {"domain": "news.example.com", "inventorypartnerdomain": "partner.example.com"},
+		"device": {"sua": {"platform": {"brand": "Android", "version": ["13"]}, "mobile": 1}},
+		"user": {"eids": [{"source": "id5-sync.com", "uids": [{"id": "xyz"}]}], "ext": {"eids": "malformed"}},
+		"source": {"schain": {"complete": 0, "ver": "1.0", "nodes": []}},
+		"regs": {"gpp": "DBACNY~CPXxRfAPXxRfAAfKABENB", "gpp_sid": [7, 8], "ext": {"gpp_sid": "malformed"}}
+	}`
+
+	var request BidRequest
+	assert.NoError(t, json.Unmarshal([]byte(body), &request))
+
+	imp := request.Imp[0]
+	assert.Equal(t, 1, imp.Rwdd)
+	assert.Equal(t, "break-1", imp.Video.PodID, "the 2.6 field wins over ext")
+	assert.Equal(t, SlotInPodFirst, imp.Video.SlotInPod)
+	assert.Equal(t, []int{15, 30}, imp.Video.RqdDurs)
+	assert.Equal(t, "partner.example.com", request.Site.InventoryPartnerDomain)
+	assert.Equal(t, "id5-sync.com", request.User.EIDs[0].Source)
+	assert.Equal(t, 0, request.Source.SChain.Complete)
+	assert.Equal(t, []int{7, 8}, request.Regs.GPPSID)
+	assert.Nil(t, request.Regs.GDPR)
+
+	os, osv := request.Device.Platform()
+	assert.Equal(t, "Android", os)
+	assert.Equal(t, "13", osv)
+}
+
+func TestBidRequest_IgnoresMalformedExt(t *testing.T) {
+	body := `{"id": "req-1", "imp": [{"id": "1", "video": {"ext": {"poddur": "sixty", "maxseq": 2}}}], "regs": {"ext": {"gdpr": "yes", "us_privacy": "1YNN"}}}`
+
+	var request BidRequest
+	assert.NoError(t, json.Unmarshal([]byte(body), &request))
+	assert.Equal(t, 0, request.Imp[0].Video.PodDur)
+	assert.Equal(t, 2, request.Imp[0].Video.MaxSeq)
+	assert.Nil(t, request.Regs.GDPR)
+	assert.Equal(t, "1YNN", request.Regs.USPrivacy)
+}
+
+func TestDevice_Platform(t *testing.T) {
+	sua := &UserAgent{Platform: &BrandVersion{Brand: "iOS", Version: []string{"17", "4"}}}
+
+	os, osv := (&Device{OS: "iOS", SUA: sua}).Platform()
+	assert.Equal(t, "iOS", os)
+	assert.Equal(t, "17.4", osv)
+
+	os, osv = (&Device{OS: "Android", SUA: sua}).Platform()
+	assert.Equal(t, "Android", os)
+	assert.Equal(t, "", osv, "another platform's version doesn't apply")
+
+	os, osv = (&Device{OS: "iOS", OSV: "16.0", SUA: sua}).Platform()
+	assert.Equal(t, "16.0", osv)
+}
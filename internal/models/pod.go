@@ -0,0 +1,6 @@
+package models
+
+// BidExt carries a pod bid's position in the ad break.
+type BidExt struct {
+	Sequence int `json:"sequence,omitempty"`
+}
@@ -0,0 +1,287 @@
+package prediction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/pkg/kafka"
+	"github.com/ad-delivery-simulator/pkg/redis"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Key is the context a click and conversion rate is learned for.
+type Key struct {
+	CampaignID uuid.UUID
+	SiteID     string
+	DeviceType int
+}
+
+// RequestKey returns the key a bid for the campaign on request is predicted
+// under. Apps are keyed by their ID in place of a site.
+func RequestKey(campaignID uuid.UUID, request *models.BidRequest) Key {
+	key := Key{CampaignID: campaignID, DeviceType: request.Device.DeviceType}
+	if request.Site != nil {
+		key.SiteID = request.Site.ID
+	} else if request.App != nil {
+		key.SiteID = request.App.ID
+	}
+	return key
+}
+
+type Config struct {
+	PriorCTR float64
+	PriorCVR float64
+	// ImpressionWeight and ClickWeight are how many impressions and clicks of
+	// evidence each level borrows from the level above it.
+	ImpressionWeight float64
+	ClickWeight      float64
+	// MaxImpressions halves a context's counts once it has seen this many
+	// impressions, so old traffic fades and the model follows drift.
+	MaxImpressions float64
+}
+
+type counts struct {
+	Impressions float64 `json:"impressions"`
+	Clicks      float64 `json:"clicks"`
+	Conversions float64 `json:"conversions"`
+}
+
+func (c *counts) observe(eventType models.EventType, maxImpressions float64) {
+	switch eventType {
+	case models.EventTypeImpression:
+		c.Impressions++
+	case models.EventTypeClick:
+		c.Clicks++
+	case models.EventTypeConversion:
+		c.Conversions++
+	}
+
+	if maxImpressions > 0 && c.Impressions > maxImpressions {
+		c.Impressions /= 2
+		c.Clicks /= 2
+		c.Conversions /= 2
+	}
+}
+
+// Model predicts click-through rates with Beta-Bernoulli smoothing over a
+// hierarchy: global, campaign, campaign×site and campaign×site×device. Each
+// level's rate is its own counts smoothed toward the level above, so sparse
+// contexts fall back to the campaign's rate and new campaigns to the global
+// one. Conversions usually arrive by postback without the site they came
+// from, so conversion rates are learned per campaign only.
+type Model struct {
+	mu     sync.RWMutex
+	cfg    Config
+	global counts
+	levels map[string]*counts
+	redis  *redis.Client
+	logger *logrus.Logger
+}
+
+type snapshot struct {
+	Global    counts             `json:"global"`
+	Levels    map[string]*counts `json:"levels"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+func NewModel(redisClient *redis.Client, cfg Config, logger *logrus.Logger) *Model {
+	if cfg.PriorCTR <= 0 {
+		cfg.PriorCTR = 0.001
+	}
+	if cfg.PriorCVR <= 0 {
+		cfg.PriorCVR = 0.01
+	}
+	if cfg.ImpressionWeight <= 0 {
+		cfg.ImpressionWeight = 1000
+	}
+	if cfg.ClickWeight <= 0 {
+		cfg.ClickWeight = 100
+	}
+
+	return &Model{
+		cfg:    cfg,
+		levels: make(map[string]*counts),
+		redis:  redisClient,
+		logger: logger,
+	}
+}
+
+// Start restores the last snapshot and learns from the impression, click and
+// conversion topics, saving a snapshot every snapshotInterval and on shutdown.
+func (m *Model) Start(ctx context.Context, consumer *kafka.Consumer, brokers []string, groupID string, snapshotInterval time.Duration) error {
+	if err := m.Load(); err != nil {
+		return err
+	}
+
+	if snapshotInterval <= 0 {
+		snapshotInterval = 30 * time.Second
+	}
+
+	for _, topic := range []string{"impressions", "clicks", "conversions"} {
+		go consumer.ConsumeFromTopic(ctx, topic, brokers, groupID, m.handleEvent)
+	}
+
+	go func() {
+		ticker := time.NewTicker(snapshotInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				if err := m.Save(); err != nil {
+					m.logger.WithError(err).Error("Failed to save prediction model")
+				}
+				return
+			case <-ticker.C:
+				if err := m.Save(); err != nil {
+					m.logger.WithError(err).Error("Failed to save prediction model")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (m *Model) handleEvent(ctx context.Context, message []byte) error {
+	var event models.TrackingEvent
+	if err := json.Unmarshal(message, &event); err != nil {
+		return fmt.Errorf("invalid tracking event: %w", err)
+	}
+	if event.CampaignID == uuid.Nil {
+		return fmt.Errorf("tracking event without campaign ID")
+	}
+
+	m.Observe(Key{CampaignID: event.CampaignID, SiteID: event.SiteID, DeviceType: event.DeviceType}, event.Type)
+	return nil
+}
+
+// Observe records an impression, click or conversion. Events without a site
+// only update the global and campaign levels.
+func (m *Model) Observe(key Key, eventType models.EventType) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	levels := levelKeys(key)
+	if eventType == models.EventTypeConversion {
+		levels = levels[:1]
+	}
+
+	m.global.observe(eventType, 0)
+	for _, level := range levels {
+		c, exists := m.levels[level]
+		if !exists {
+			c = &counts{}
+			m.levels[level] = c
+		}
+		c.observe(eventType, m.cfg.MaxImpressions)
+	}
+}
+
+// Predict returns the smoothed click-through rate and the conversion rate per
+// click for key.
+func (m *Model) Predict(key Key) (ctr, cvr float64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ctr = smooth(m.global.Clicks, m.global.Impressions, m.cfg.PriorCTR, m.cfg.ImpressionWeight)
+	cvr = smooth(m.global.Conversions, m.global.Clicks, m.cfg.PriorCVR, m.cfg.ClickWeight)
+
+	for i, level := range levelKeys(key) {
+		c, exists := m.levels[level]
+		if !exists {
+			break
+		}
+		ctr = smooth(c.Clicks, c.Impressions, ctr, m.cfg.ImpressionWeight)
+		if i == 0 {
+			cvr = smooth(c.Conversions, c.Clicks, cvr, m.cfg.ClickWeight)
+		}
+	}
+
+	return ctr, cvr
+}
+
+// smooth is the posterior mean of a Beta prior with mean prior and weight
+// pseudo-trials after observing successes in trials.
+func smooth(successes, trials, prior, weight float64) float64 {
+	return (successes + prior*weight) / (trials + weight)
+}
+
+func levelKeys(key Key) []string {
+	campaign := key.CampaignID.String()
+	if key.SiteID == "" {
+		return []string{campaign}
+	}
+	site := campaign + "|" + key.SiteID
+	return []string{campaign, site, site + "|" + strconv.Itoa(key.DeviceType)}
+}
+
+// Save writes a snapshot of the model's counts to Redis.
+func (m *Model) Save() error {
+	m.mu.RLock()
+	data, err := json.Marshal(m.snapshot())
+	m.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode prediction model: %w", err)
+	}
+
+	if err := m.redis.SavePredictionModel(data); err != nil {
+		return fmt.Errorf("failed to save prediction model: %w", err)
+	}
+	return nil
+}
+
+// Load replaces the model's counts with the snapshot in Redis, if any.
+func (m *Model) Load() error {
+	data, err := m.redis.GetPredictionModel()
+	if err != nil {
+		return fmt.Errorf("failed to load prediction model: %w", err)
+	}
+	if data == nil {
+		return nil
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("failed to decode prediction model: %w", err)
+	}
+
+	m.mu.Lock()
+	m.restore(&snap)
+	m.mu.Unlock()
+
+	m.logger.WithFields(logrus.Fields{
+		"contexts":   len(snap.Levels),
+		"updated_at": snap.UpdatedAt,
+	}).Info("Restored prediction model")
+	return nil
+}
+
+func (m *Model) snapshot() *snapshot {
+	snap := &snapshot{
+		Global:    m.global,
+		Levels:    make(map[string]*counts, len(m.levels)),
+		UpdatedAt: time.Now(),
+	}
+	for key, c := range m.levels {
+		copied := *c
+		snap.Levels[key] = &copied
+	}
+	return snap
+}
+
+func (m *Model) restore(snap *snapshot) {
+	m.global = snap.Global
+	m.levels = make(map[string]*counts, len(snap.Levels))
+	for key, c := range snap.Levels {
+		if c != nil {
+			m.levels[key] = c
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package prediction
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func observeN(m *Model, key Key, eventType models.EventType, n int) {
+	for i := 0; i < n; i++ {
+		m.Observe(key, eventType)
+	}
+}
+
+func TestModel_PredictsPriorWithoutData(t *testing.T) {
+	m := NewModel(nil, Config{PriorCTR: 0.002, PriorCVR: 0.05}, nil)
+
+	ctr, cvr := m.Predict(Key{CampaignID: uuid.New(), SiteID: "site-1"})
+	assert.InDelta(t, 0.002, ctr, 1e-9)
+	assert.InDelta(t, 0.05, cvr, 1e-9)
+}
+
+func TestModel_LearnsPerContext(t *testing.T) {
+	m := NewModel(nil, Config{}, nil)
+	campaignID := uuid.New()
+	good := Key{CampaignID: campaignID, SiteID: "good", DeviceType: 2}
+	poor := Key{CampaignID: campaignID, SiteID: "poor", DeviceType: 2}
+
+	observeN(m, good, models.EventTypeImpression, 20000)
+	observeN(m, good, models.EventTypeClick, 200)
+	observeN(m, poor, models.EventTypeImpression, 20000)
+	observeN(m, poor, models.EventTypeClick, 10)
+
+	goodCTR, _ := m.Predict(good)
+	poorCTR, _ := m.Predict(poor)
+	assert.InDelta(t, 0.01, goodCTR, 0.001)
+	assert.InDelta(t, 0.0005, poorCTR, 0.0002)
+
+	// An unseen site backs off to the campaign's rate across both sites.
+	unseenCTR, _ := m.Predict(Key{CampaignID: campaignID, SiteID: "new", DeviceType: 2})
+	assert.InDelta(t, 210.0/40000, unseenCTR, 0.0005)
+}
+
+func TestModel_LearnsConversionsPerCampaign(t *testing.T) {
+	m := NewModel(nil, Config{}, nil)
+	campaignID := uuid.New()
+	key := Key{CampaignID: campaignID, SiteID: "site-1"}
+
+	observeN(m, key, models.EventTypeClick, 500)
+	observeN(m, Key{CampaignID: campaignID}, models.EventTypeConversion, 40)
+	observeN(m, key, models.EventTypeConversion, 10)
+
+	assert.Equal(t, float64(50), m.levels[campaignID.String()].Conversions)
+	assert.Zero(t, m.levels[campaignID.String()+"|site-1"].Conversions)
+
+	_, cvr := m.Predict(key)
+	assert.InDelta(t, 0.1, cvr, 0.02)
+}
+
+func TestModel_DecaysPastMaxImpressions(t *testing.T) {
+	m := NewModel(nil, Config{MaxImpressions: 100}, nil)
+	key := Key{CampaignID: uuid.New()}
+
+	observeN(m, key, models.EventTypeClick, 10)
+	observeN(m, key, models.EventTypeImpression, 101)
+
+	c := m.levels[key.CampaignID.String()]
+	assert.InDelta(t, 50.5, c.Impressions, 1e-9)
+	assert.InDelta(t, 5, c.Clicks, 1e-9)
+}
+
+func TestModel_SnapshotRoundTrip(t *testing.T) {
+	m := NewModel(nil, Config{}, nil)
+	key := Key{CampaignID: uuid.New(), SiteID: "site-1", DeviceType: 1}
+	observeN(m, key, models.EventTypeImpression, 1000)
+	observeN(m, key, models.EventTypeClick, 30)
+
+	data, err := json.Marshal(m.snapshot())
+	assert.NoError(t, err)
+
+	var snap snapshot
+	assert.NoError(t, json.Unmarshal(data, &snap))
+
+	restored := NewModel(nil, Config{}, nil)
+	restored.restore(&snap)
+
+	wantCTR, wantCVR := m.Predict(key)
+	gotCTR, gotCVR := restored.Predict(key)
+	assert.Equal(t, wantCTR, gotCTR)
+	assert.Equal(t, wantCVR, gotCVR)
+}
+
+func TestRequestKey(t *testing.T) {
+	campaignID := uuid.New()
+
+	key := RequestKey(campaignID, &models.BidRequest{App: &models.App{ID: "app-1"}, Device: models.Device{DeviceType: 4}})
+	assert.Equal(t, Key{CampaignID: campaignID, SiteID: "app-1", DeviceType: 4}, key)
+}
@@ -0,0 +1,180 @@
+// Package sqltest is an in-memory database/sql driver for service tests.
+// Each statement is answered by the most recently added stub whose pattern
+// appears in the query, and every statement is recorded so tests can check
+// what was written.
+package sqltest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type stub struct {
+	pattern  string
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+	err      error
+}
+
+// Call is a statement the driver received.
+type Call struct {
+	Query string
+	Args  []driver.Value
+}
+
+type hook struct {
+	pattern string
+	fn      func()
+}
+
+// DB holds the stubs and calls behind a *sql.DB returned by Open.
+type DB struct {
+	mu    sync.Mutex
+	stubs []stub
+	hooks []hook
+	calls []Call
+}
+
+// Open returns a *sql.DB backed by a new DB, closed when the test ends.
+func Open(t testing.TB) (*sql.DB, *DB) {
+	d := &DB{}
+	db := sql.OpenDB(connector{d})
+	t.Cleanup(func() { db.Close() })
+	return db, d
+}
+
+// OnQuery answers queries containing pattern with rows of the given columns.
+func (d *DB) OnQuery(pattern string, columns []string, rows ...[]driver.Value) {
+	d.add(stub{pattern: pattern, columns: columns, rows: rows})
+}
+
+// OnExec answers statements containing pattern with affected rows.
+func (d *DB) OnExec(pattern string, affected int64) {
+	d.add(stub{pattern: pattern, affected: affected})
+}
+
+// OnError fails statements containing pattern with err.
+func (d *DB) OnError(pattern string, err error) {
+	d.add(stub{pattern: pattern, err: err})
+}
+
+// OnCall runs fn whenever a statement containing pattern arrives, before it
+// is answered, so tests can interleave other work with it. fn may issue
+// statements of its own.
+func (d *DB) OnCall(pattern string, fn func()) {
+	d.mu.Lock()
+	d.hooks = append(d.hooks, hook{pattern: pattern, fn: fn})
+	d.mu.Unlock()
+}
+
+// Calls returns the statements received so far whose query contains pattern.
+func (d *DB) Calls(pattern string) []Call {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var calls []Call
+	for _, call := range d.calls {
+		if strings.Contains(call.Query, pattern) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (d *DB) add(s stub) {
+	d.mu.Lock()
+	d.stubs = append(d.stubs, s)
+	d.mu.Unlock()
+}
+
+func (d *DB) answer(query string, args []driver.NamedValue) (stub, error) {
+	d.mu.Lock()
+	hooks := append([]hook(nil), d.hooks...)
+	d.mu.Unlock()
+	for _, h := range hooks {
+		if strings.Contains(query, h.pattern) {
+			h.fn()
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	d.calls = append(d.calls, Call{Query: query, Args: values})
+
+	for i := len(d.stubs) - 1; i >= 0; i-- {
+		if strings.Contains(query, d.stubs[i].pattern) {
+			return d.stubs[i], d.stubs[i].err
+		}
+	}
+	return stub{}, fmt.Errorf("sqltest: no stub for query %q", query)
+}
+
+type connector struct{ db *DB }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return conn(c), nil }
+func (c connector) Driver() driver.Driver                        { return sqlDriver{} }
+
+type sqlDriver struct{}
+
+func (sqlDriver) Open(string) (driver.Conn, error) {
+	return nil, fmt.Errorf("sqltest: use sqltest.Open")
+}
+
+type conn struct{ db *DB }
+
+func (c conn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("sqltest: prepared statements are not supported")
+}
+func (c conn) Close() error              { return nil }
+func (c conn) Begin() (driver.Tx, error) { return tx{}, nil }
+
+func (c conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s, err := c.db.answer(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(s.affected), nil
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s, err := c.db.answer(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{columns: s.columns, rows: s.rows}, nil
+}
+
+type tx struct{}
+
+func (tx) Commit() error   { return nil }
+func (tx) Rollback() error { return nil }
+
+type rows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,328 @@
+package targeting
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+)
+
+// Env is the request context an expression is evaluated against. The engine
+// fills it from the bid request; Geo is the device location with the user's
+// home location as fallback, and Now is on the campaign's day-parting clock.
+type Env struct {
+	Request    *models.BidRequest
+	Geo        *models.Geo
+	Segments   []string
+	Sizes      []string
+	KeyValues  map[string][]string
+	Categories []string
+	Keywords   []string
+	Now        time.Time
+}
+
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindNumber
+	kindList
+)
+
+func (k valueKind) String() string {
+	switch k {
+	case kindNumber:
+		return "number"
+	case kindList:
+		return "list"
+	}
+	return "string"
+}
+
+// field reads one request attribute. Exactly one accessor is set, matching
+// kind. Missing attributes read as "" or 0.
+type field struct {
+	kind valueKind
+	str  func(*Env) string
+	num  func(*Env) float64
+	list func(*Env) []string
+}
+
+func geoField(get func(*models.Geo) string) field {
+	return field{kind: kindString, str: func(env *Env) string {
+		if env.Geo == nil {
+			return ""
+		}
+		return get(env.Geo)
+	}}
+}
+
+func deviceString(get func(*models.Device) string) field {
+	return field{kind: kindString, str: func(env *Env) string { return get(&env.Request.Device) }}
+}
+
+func deviceOS(d *models.Device) string {
+	os, _ := d.Platform()
+	return os
+}
+
+func deviceOSV(d *models.Device) string {
+	_, osv := d.Platform()
+	return osv
+}
+
+func contentString(get func(*models.Content) string) field {
+	return field{kind: kindString, str: func(env *Env) string {
+		if content := env.Request.RequestContent(); content != nil {
+			return get(content)
+		}
+		return ""
+	}}
+}
+
+func contentNumber(get func(*models.Content) int) field {
+	return field{kind: kindNumber, num: func(env *Env) float64 {
+		if content := env.Request.RequestContent(); content != nil {
+			return float64(get(content))
+		}
+		return 0
+	}}
+}
+
+func siteString(get func(*models.Site) string) field {
+	return field{kind: kindString, str: func(env *Env) string {
+		if env.Request.Site == nil {
+			return ""
+		}
+		return get(env.Request.Site)
+	}}
+}
+
+func appString(get func(*models.App) string) field {
+	return field{kind: kindString, str: func(env *Env) string {
+		if env.Request.App == nil {
+			return ""
+		}
+		return get(env.Request.App)
+	}}
+}
+
+var fields = map[string]field{
+	"geo.country": geoField(func(g *models.Geo) string { return g.Country }),
+	"geo.region":  geoField(func(g *models.Geo) string { return g.Region }),
+	"geo.metro":   geoField(func(g *models.Geo) string { return g.Metro }),
+	"geo.city":    geoField(func(g *models.Geo) string { return g.City }),
+	"geo.zip":     geoField(func(g *models.Geo) string { return g.ZIP }),
+
+	"device.type":       {kind: kindNumber, num: func(env *Env) float64 { return float64(env.Request.Device.DeviceType) }},
+	"device.connection": {kind: kindNumber, num: func(env *Env) float64 { return float64(env.Request.Device.ConnectionType) }},
+	"device.os":         deviceString(deviceOS),
+	"device.make":       deviceString(func(d *models.Device) string { return d.Make }),
+	"device.model":      deviceString(func(d *models.Device) string { return d.Model }),
+	"device.language":   deviceString(func(d *models.Device) string { return d.Language }),
+	"device.carrier":    deviceString(func(d *models.Device) string { return d.Carrier }),
+	"device.mccmnc":     deviceString(func(d *models.Device) string { return d.MCCMNC }),
+	"device.osv":        deviceString(deviceOSV),
+
+	"site.id":     siteString(func(s *models.Site) string { return s.ID }),
+	"site.domain": siteString(func(s *models.Site) string { return s.Domain }),
+	"app.id":      appString(func(a *models.App) string { return a.ID }),
+	"app.bundle":  appString(func(a *models.App) string { return a.Bundle }),
+
+	// inventory is "app" or "site".
+	"inventory": {kind: kindString, str: func(env *Env) string {
+		if env.Request.App != nil {
+			return models.InventoryApp
+		}
+		if env.Request.Site != nil {
+			return models.InventorySite
+		}
+		return ""
+	}},
+
+	// site.cat is the IAB categories of the site or app.
+	"site.cat": {kind: kindList, list: func(env *Env) []string {
+		if env.Request.Site != nil {
+			return env.Request.Site.Cat
+		}
+		if env.Request.App != nil {
+			return env.Request.App.Cat
+		}
+		return nil
+	}},
+	// content.cat is every category of the site or app, its section, page and
+	// content; keywords are the lower-cased site or app and content keywords.
+	"content.cat": {kind: kindList, list: func(env *Env) []string { return env.Categories }},
+	"keywords":    {kind: kindList, list: func(env *Env) []string { return env.Keywords }},
+
+	"content.language":    contentString(func(c *models.Content) string { return c.Language }),
+	"content.genre":       contentString(func(c *models.Content) string { return c.Genre }),
+	"content.rating":      contentString(func(c *models.Content) string { return c.ContentRating }),
+	"content.mediarating": contentNumber(func(c *models.Content) int { return c.QAGMediaRating }),
+	"content.livestream":  contentNumber(func(c *models.Content) int { return c.LiveStream }),
+
+	// imp.size is the sizes of every impression in the request.
+	"imp.size": {kind: kindList, list: func(env *Env) []string { return env.Sizes }},
+
+	// hour and day are read from Now; day is 0 for Sunday.
+	"hour": {kind: kindNumber, num: func(env *Env) float64 { return float64(env.now().Hour()) }},
+	"day":  {kind: kindNumber, num: func(env *Env) float64 { return float64(env.now().Weekday()) }},
+}
+
+func (env *Env) now() time.Time {
+	if env.Now.IsZero() {
+		return time.Now()
+	}
+	return env.Now
+}
+
+// function is a predicate call such as segment("sports"). check validates
+// the literal arguments when the expression is compiled and returns the
+// evaluator, or an error message for the argument at the returned index.
+type function struct {
+	check func(args []literal) (evaluator, int, string)
+}
+
+var functions = map[string]function{
+	// segment("a", "b") matches users in any of the segments.
+	"segment": {check: func(args []literal) (evaluator, int, string) {
+		if len(args) == 0 {
+			return nil, 0, "segment() needs at least one segment"
+		}
+		names, i, msg := stringArgs(args)
+		if msg != "" {
+			return nil, i, msg
+		}
+		return func(env *Env) bool { return containsAny(env.Segments, names) }, 0, ""
+	}},
+
+	// category("IAB17") matches requests in any of the categories or their
+	// subcategories, so IAB17 also matches IAB17-3.
+	"category": {check: func(args []literal) (evaluator, int, string) {
+		if len(args) == 0 {
+			return nil, 0, "category() needs at least one category"
+		}
+		categories, i, msg := stringArgs(args)
+		if msg != "" {
+			return nil, i, msg
+		}
+		return func(env *Env) bool {
+			for _, have := range env.Categories {
+				for _, want := range categories {
+					if strings.EqualFold(have, want) || (len(have) > len(want) && strings.EqualFold(have[:len(want)+1], want+"-")) {
+						return true
+					}
+				}
+			}
+			return false
+		}, 0, ""
+	}},
+
+	// kv("section", "sports", "news") matches requests whose site.ext or
+	// imp.ext carries the key with any of the values.
+	"kv": {check: func(args []literal) (evaluator, int, string) {
+		if len(args) < 2 {
+			return nil, len(args), "kv() needs a key and at least one value"
+		}
+		values, i, msg := stringArgs(args)
+		if msg != "" {
+			return nil, i, msg
+		}
+		key, wanted := values[0], values[1:]
+		return func(env *Env) bool { return containsAny(env.KeyValues[key], wanted) }, 0, ""
+	}},
+
+	// os("iOS", "15", "17.2") matches devices running the OS, optionally
+	// between a minimum and maximum version.
+	"os": {check: func(args []literal) (evaluator, int, string) {
+		if len(args) == 0 || len(args) > 3 {
+			return nil, len(args), "os() needs an OS and optional min and max versions"
+		}
+		values, i, msg := stringArgs(args)
+		if msg != "" {
+			return nil, i, msg
+		}
+		r := models.OSRange{OS: values[0]}
+		if len(values) > 1 {
+			r.MinVersion = values[1]
+		}
+		if len(values) > 2 {
+			r.MaxVersion = values[2]
+		}
+		for i, version := range values[1:] {
+			if _, ok := models.ParseVersion(version); !ok && version != "" {
+				return nil, i + 1, "expected a version such as \"17.4\""
+			}
+		}
+		return func(env *Env) bool {
+			matched, _ := r.Contains(env.Request.Device.Platform())
+			return matched
+		}, 0, ""
+	}},
+
+	// within(lat, lon, km) matches requests located within km of the point.
+	// Requests without a location never match.
+	"within": {check: func(args []literal) (evaluator, int, string) {
+		if len(args) != 3 {
+			return nil, len(args), "within() needs lat, lon and a radius in km"
+		}
+		for i, arg := range args {
+			if arg.kind != kindNumber {
+				return nil, i, "within() arguments must be numbers"
+			}
+		}
+		lat, lon, radius := args[0].num, args[1].num, args[2].num
+		if lat < -90 || lat > 90 {
+			return nil, 0, "latitude must be between -90 and 90"
+		}
+		if lon < -180 || lon > 180 {
+			return nil, 1, "longitude must be between -180 and 180"
+		}
+		if radius <= 0 {
+			return nil, 2, "radius must be positive"
+		}
+		return func(env *Env) bool {
+			if env.Geo == nil || (env.Geo.Lat == 0 && env.Geo.Lon == 0) {
+				return false
+			}
+			return DistanceKM(lat, lon, env.Geo.Lat, env.Geo.Lon) <= radius
+		}, 0, ""
+	}},
+}
+
+func stringArgs(args []literal) ([]string, int, string) {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		if arg.kind != kindString {
+			return nil, i, "expected a string"
+		}
+		values[i] = arg.str
+	}
+	return values, 0, ""
+}
+
+func containsAny(have, want []string) bool {
+	for _, h := range have {
+		for _, w := range want {
+			if strings.EqualFold(h, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const earthRadiusKM = 6371.0
+
+// DistanceKM is the great-circle distance between two points.
+func DistanceKM(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKM * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,223 @@
+package targeting
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+	tokenEq
+	tokenNe
+	tokenLt
+	tokenLe
+	tokenGt
+	tokenGe
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenIn
+	tokenTrue
+	tokenFalse
+)
+
+var keywords = map[string]tokenKind{
+	"and":   tokenAnd,
+	"or":    tokenOr,
+	"not":   tokenNot,
+	"in":    tokenIn,
+	"true":  tokenTrue,
+	"false": tokenFalse,
+}
+
+type token struct {
+	kind tokenKind
+	pos  int
+	text string
+	str  string
+	num  float64
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.str)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// Error is a syntax or type error in an expression, located by byte offset
+// and by 1-based line and column.
+type Error struct {
+	Offset  int    `json:"offset"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+func errorAt(source string, offset int, format string, args ...interface{}) *Error {
+	line, column := 1, 1
+	for _, r := range source[:offset] {
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return &Error{Offset: offset, Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// lex splits source into tokens, ending with tokenEOF.
+func lex(source string) ([]token, error) {
+	var tokens []token
+
+	pos := 0
+	for pos < len(source) {
+		r, width := utf8.DecodeRuneInString(source[pos:])
+		if unicode.IsSpace(r) {
+			pos += width
+			continue
+		}
+
+		start := pos
+		switch {
+		case isIdentStart(r):
+			for pos < len(source) {
+				r, width := utf8.DecodeRuneInString(source[pos:])
+				if !isIdentPart(r) {
+					break
+				}
+				pos += width
+			}
+			text := source[start:pos]
+			kind, isKeyword := keywords[strings.ToLower(text)]
+			if !isKeyword {
+				kind = tokenIdent
+			}
+			tokens = append(tokens, token{kind: kind, pos: start, text: text})
+
+		case isDigit(source[pos]) || (r == '-' && pos+1 < len(source) && (isDigit(source[pos+1]) || source[pos+1] == '.')) || r == '.':
+			pos++
+			for pos < len(source) && (isDigit(source[pos]) || source[pos] == '.') {
+				pos++
+			}
+			text := source[start:pos]
+			num, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, errorAt(source, start, "invalid number %q", text)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, pos: start, text: text, num: num})
+
+		case r == '"':
+			str, end, err := lexString(source, start)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+			tokens = append(tokens, token{kind: tokenString, pos: start, text: source[start:pos], str: str})
+
+		default:
+			kind, width := operator(source[pos:])
+			if width == 0 {
+				return nil, errorAt(source, start, "unexpected character %q", r)
+			}
+			pos += width
+			tokens = append(tokens, token{kind: kind, pos: start, text: source[start:pos]})
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+// lexString reads the double-quoted string starting at start, which may
+// escape a quote or backslash with a backslash, and returns its value and the
+// offset just past the closing quote.
+func lexString(source string, start int) (string, int, error) {
+	var value strings.Builder
+
+	pos := start + 1
+	for pos < len(source) {
+		switch c := source[pos]; c {
+		case '"':
+			return value.String(), pos + 1, nil
+		case '\\':
+			if pos+1 >= len(source) || (source[pos+1] != '"' && source[pos+1] != '\\') {
+				return "", 0, errorAt(source, pos, `invalid escape, only \" and \\ are allowed`)
+			}
+			value.WriteByte(source[pos+1])
+			pos += 2
+		case '\n':
+			return "", 0, errorAt(source, start, "unterminated string")
+		default:
+			value.WriteByte(c)
+			pos++
+		}
+	}
+
+	return "", 0, errorAt(source, start, "unterminated string")
+}
+
+func operator(s string) (tokenKind, int) {
+	if len(s) >= 2 {
+		switch s[:2] {
+		case "==":
+			return tokenEq, 2
+		case "!=":
+			return tokenNe, 2
+		case "<=":
+			return tokenLe, 2
+		case ">=":
+			return tokenGe, 2
+		}
+	}
+
+	switch s[0] {
+	case '(':
+		return tokenLParen, 1
+	case ')':
+		return tokenRParen, 1
+	case '[':
+		return tokenLBracket, 1
+	case ']':
+		return tokenRBracket, 1
+	case ',':
+		return tokenComma, 1
+	case '<':
+		return tokenLt, 1
+	case '>':
+		return tokenGt, 1
+	}
+	return tokenEOF, 0
+}
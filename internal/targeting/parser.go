@@ -0,0 +1,362 @@
+// Package targeting compiles boolean targeting expressions such as
+//
+//	(geo.country in ["US", "CA"] and device.type == 4) or segment("sports")
+//
+// into evaluators that run against a bid request. Expressions combine
+// comparisons and predicate calls with and, or, not and parentheses. String
+// comparisons ignore case. List fields such as site.cat compare with == as
+// "contains" and with in as "shares any value with".
+package targeting
+
+import (
+	"strings"
+)
+
+type evaluator func(*Env) bool
+
+// Program is a compiled expression. It is safe for concurrent use.
+type Program struct {
+	source   string
+	eval     evaluator
+	segments bool
+}
+
+func (p *Program) String() string {
+	return p.source
+}
+
+// UsesSegments reports whether the expression calls segment(), so
+// evaluating it needs the user's segments.
+func (p *Program) UsesSegments() bool {
+	return p.segments
+}
+
+// Eval reports whether the request in env satisfies the expression.
+func (p *Program) Eval(env *Env) bool {
+	return p.eval(env)
+}
+
+// Compile parses and type-checks source. Errors are *Error and carry the
+// position of the offending token.
+func Compile(source string) (*Program, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{source: source, tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, p.errorf(p.peek(), "expression is empty")
+	}
+
+	eval, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorf(tok, "unexpected %s, expected and, or or end of expression", tok)
+	}
+
+	return &Program{source: source, eval: eval, segments: p.segments}, nil
+}
+
+type literal struct {
+	kind valueKind
+	tok  token
+	str  string
+	num  float64
+}
+
+type parser struct {
+	source   string
+	tokens   []token
+	pos      int
+	segments bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(tok token, format string, args ...interface{}) error {
+	return errorAt(p.source, tok.pos, format, args...)
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		return tok, p.errorf(tok, "unexpected %s, expected %s", tok, what)
+	}
+	return tok, nil
+}
+
+// parseOr handles or, which binds more loosely than and.
+func (p *parser) parseOr() (evaluator, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(env *Env) bool { return l(env) || right(env) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (evaluator, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(env *Env) bool { return l(env) && right(env) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (evaluator, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(env *Env) bool { return !operand(env) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (evaluator, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+
+	case tokenTrue, tokenFalse:
+		value := tok.kind == tokenTrue
+		return func(*Env) bool { return value }, nil
+
+	case tokenIdent:
+		if p.peek().kind == tokenLParen {
+			return p.parseCall(tok)
+		}
+		return p.parseComparison(tok)
+	}
+
+	return nil, p.errorf(tok, "unexpected %s, expected a comparison, function call or '('", tok)
+}
+
+func (p *parser) parseCall(name token) (evaluator, error) {
+	fn, exists := functions[strings.ToLower(name.text)]
+	if !exists {
+		return nil, p.errorf(name, "unknown function %q", name.text)
+	}
+	if strings.EqualFold(name.text, "segment") {
+		p.segments = true
+	}
+
+	p.next()
+	var args []literal
+	if p.peek().kind != tokenRParen {
+		for {
+			arg, err := p.parseLiteral()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+	closing, err := p.expect(tokenRParen, "',' or ')'")
+	if err != nil {
+		return nil, err
+	}
+
+	eval, argIndex, msg := fn.check(args)
+	if msg != "" {
+		at := closing
+		if argIndex < len(args) {
+			at = args[argIndex].tok
+		}
+		return nil, p.errorf(at, "%s", msg)
+	}
+	return eval, nil
+}
+
+func (p *parser) parseLiteral() (literal, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenString:
+		return literal{kind: kindString, tok: tok, str: tok.str}, nil
+	case tokenNumber:
+		return literal{kind: kindNumber, tok: tok, num: tok.num}, nil
+	}
+	return literal{}, p.errorf(tok, "unexpected %s, expected a string or number", tok)
+}
+
+// parseComparison parses `field op value`, `field in [...]` or
+// `field not in [...]` for the field named by name.
+func (p *parser) parseComparison(name token) (evaluator, error) {
+	f, exists := fields[strings.ToLower(name.text)]
+	if !exists {
+		return nil, p.errorf(name, "unknown field %q", name.text)
+	}
+
+	op := p.next()
+	switch op.kind {
+	case tokenIn:
+		return p.parseIn(f)
+
+	case tokenNot:
+		if _, err := p.expect(tokenIn, "in after not"); err != nil {
+			return nil, err
+		}
+		in, err := p.parseIn(f)
+		if err != nil {
+			return nil, err
+		}
+		return func(env *Env) bool { return !in(env) }, nil
+
+	case tokenEq, tokenNe:
+		value, err := p.parseValue(f)
+		if err != nil {
+			return nil, err
+		}
+		eq := equals(f, value)
+		if op.kind == tokenNe {
+			return func(env *Env) bool { return !eq(env) }, nil
+		}
+		return eq, nil
+
+	case tokenLt, tokenLe, tokenGt, tokenGe:
+		if f.kind != kindNumber {
+			return nil, p.errorf(op, "%s is a %s and can't be compared with %s", name.text, f.kind, op.text)
+		}
+		value, err := p.parseValue(f)
+		if err != nil {
+			return nil, err
+		}
+		return compare(f, op.kind, value.num), nil
+	}
+
+	return nil, p.errorf(op, "unexpected %s, expected ==, !=, <, <=, >, >=, in or not in after %s", op, name.text)
+}
+
+// parseValue parses a literal of the type the field compares with: strings
+// for string and list fields, numbers for number fields.
+func (p *parser) parseValue(f field) (literal, error) {
+	value, err := p.parseLiteral()
+	if err != nil {
+		return literal{}, err
+	}
+
+	want := kindString
+	if f.kind == kindNumber {
+		want = kindNumber
+	}
+	if value.kind != want {
+		return literal{}, p.errorf(value.tok, "expected a %s, got %s", want, value.tok)
+	}
+	return value, nil
+}
+
+func (p *parser) parseIn(f field) (evaluator, error) {
+	if _, err := p.expect(tokenLBracket, "'['"); err != nil {
+		return nil, err
+	}
+
+	var values []literal
+	for {
+		value, err := p.parseValue(f)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if p.peek().kind != tokenComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(tokenRBracket, "',' or ']'"); err != nil {
+		return nil, err
+	}
+
+	if f.kind == kindNumber {
+		nums := make([]float64, len(values))
+		for i, value := range values {
+			nums[i] = value.num
+		}
+		return func(env *Env) bool {
+			have := f.num(env)
+			for _, num := range nums {
+				if have == num {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+
+	strs := make([]string, len(values))
+	for i, value := range values {
+		strs[i] = value.str
+	}
+	if f.kind == kindList {
+		return func(env *Env) bool { return containsAny(f.list(env), strs) }, nil
+	}
+	return func(env *Env) bool { return containsAny([]string{f.str(env)}, strs) }, nil
+}
+
+func equals(f field, value literal) evaluator {
+	switch f.kind {
+	case kindNumber:
+		return func(env *Env) bool { return f.num(env) == value.num }
+	case kindList:
+		want := []string{value.str}
+		return func(env *Env) bool { return containsAny(f.list(env), want) }
+	}
+	return func(env *Env) bool { return strings.EqualFold(f.str(env), value.str) }
+}
+
+func compare(f field, op tokenKind, value float64) evaluator {
+	switch op {
+	case tokenLt:
+		return func(env *Env) bool { return f.num(env) < value }
+	case tokenLe:
+		return func(env *Env) bool { return f.num(env) <= value }
+	case tokenGt:
+		return func(env *Env) bool { return f.num(env) > value }
+	}
+	return func(env *Env) bool { return f.num(env) >= value }
+}
@@ -0,0 +1,152 @@
+package targeting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEnv() *Env {
+	return &Env{
+		Request: &models.BidRequest{
+			Device: models.Device{DeviceType: 4, OS: "iOS", OSV: "17.2"},
+			Site: &models.Site{
+				Domain:  "news.example.com",
+				Cat:     []string{"IAB17", "IAB12"},
+				Content: &models.Content{Language: "en", ContentRating: "TV-PG", QAGMediaRating: 1},
+			},
+		},
+		Geo:        &models.Geo{Country: "CA", Region: "ON", Lat: 43.65, Lon: -79.38},
+		Segments:   []string{"sports", "travel"},
+		Sizes:      []string{"300x250"},
+		KeyValues:  map[string][]string{"section": {"hockey"}},
+		Categories: []string{"IAB17", "IAB12", "IAB17-26"},
+		Keywords:   []string{"nhl", "playoffs"},
+		Now:        time.Date(2024, 1, 15, 9, 30, 0, 0, time.UTC), // Monday
+	}
+}
+
+func TestCompile_Eval(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   bool
+	}{
+		{`(geo.country in ["US","CA"] and device.type == 4) or segment("sports")`, true},
+		{`geo.country == "us"`, false},
+		{`geo.country == "ca" and geo.region != "QC"`, true},
+		{`geo.country not in ["CA"]`, false},
+		{`not device.type == 4`, false},
+		{`device.type in [1, 2] or device.os == "ios"`, true},
+		{`device.type >= 4 and device.type < 5`, true},
+		{`segment("auto", "travel")`, true},
+		{`segment("auto")`, false},
+		{`site.cat == "IAB17" and site.cat in ["IAB1", "IAB12"]`, true},
+		{`site.cat != "IAB17"`, false},
+		{`imp.size == "300x250"`, true},
+		{`kv("section", "football", "hockey")`, true},
+		{`kv("team", "leafs")`, false},
+		{`within(43.7, -79.4, 25)`, true},
+		{`within(40.7, -74.0, 25)`, false},
+		{`day == 1 and hour >= 9 and hour < 17`, true},
+		{`app.bundle == "com.example"`, false},
+		{`true and not false`, true},
+		{"segment(\"auto\")\n  or geo.city == \"\"", true},
+		{`segment("auto") or segment("travel") and device.type == 1`, false},
+		{`GEO.COUNTRY == "CA" AND Segment("sports")`, true},
+		{`category("IAB17-26") and not category("IAB7")`, true},
+		{`category("IAB1")`, false},
+		{`os("ios", "16", "17") and inventory == "site"`, true},
+		{`os("iOS", "17.3") or os("Android")`, false},
+		{`keywords in ["playoffs", "draft"] and content.language == "EN"`, true},
+		{`content.rating in ["TV-Y", "TV-G"] or content.mediarating > 1`, false},
+	}
+
+	env := testEnv()
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			program, err := Compile(tt.expression)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, program.Eval(env))
+		})
+	}
+}
+
+func TestCompile_UnknownGeo(t *testing.T) {
+	env := testEnv()
+	env.Geo = nil
+
+	for expression, expected := range map[string]bool{
+		`geo.country == "CA"`:       false,
+		`geo.country not in ["US"]`: true,
+		`within(43.7, -79.4, 25)`:   false,
+	} {
+		program, err := Compile(expression)
+		require.NoError(t, err)
+		assert.Equal(t, expected, program.Eval(env), expression)
+	}
+}
+
+func TestCompile_UsesSegments(t *testing.T) {
+	for expression, expected := range map[string]bool{
+		`segment("sports")`:                          true,
+		`geo.country == "CA" or not SEGMENT("auto")`: true,
+		`geo.country == "segment"`:                   false,
+		`kv("segment", "sports")`:                    false,
+	} {
+		program, err := Compile(expression)
+		require.NoError(t, err)
+		assert.Equal(t, expected, program.UsesSegments(), expression)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		expression string
+		line       int
+		column     int
+		message    string
+	}{
+		{``, 1, 1, "expression is empty"},
+		{`geo.country in ["US" "CA"]`, 1, 22, `unexpected "CA", expected ',' or ']'`},
+		{`(device.type == 4`, 1, 18, "unexpected end of expression, expected ')'"},
+		{`geo.contry == "US"`, 1, 1, `unknown field "geo.contry"`},
+		{`device.type == "4"`, 1, 16, `expected a number, got "4"`},
+		{`geo.country > "US"`, 1, 13, `geo.country is a string and can't be compared with >`},
+		{`geo.country`, 1, 12, "unexpected end of expression, expected ==, !=, <, <=, >, >=, in or not in after geo.country"},
+		{`segment()`, 1, 9, "segment() needs at least one segment"},
+		{`segment("a", 4)`, 1, 14, "expected a string"},
+		{`within(95, 0, 10)`, 1, 8, "latitude must be between -90 and 90"},
+		{`os("iOS", "17.x")`, 1, 11, `expected a version such as "17.4"`},
+		{`lookup("x")`, 1, 1, `unknown function "lookup"`},
+		{`geo.country == "US" device.type == 4`, 1, 21, `unexpected "device.type", expected and, or or end of expression`},
+		{"segment(\"a\") or\n  geo.country == 'US'", 2, 18, `unexpected character '\''`},
+		{`geo.country == "US`, 1, 16, "unterminated string"},
+		{`geo.country not ["US"]`, 1, 17, `unexpected "[", expected in after not`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Compile(tt.expression)
+			require.Error(t, err)
+
+			exprErr, ok := err.(*Error)
+			require.True(t, ok, "error is %T", err)
+			assert.Equal(t, tt.message, exprErr.Message)
+			assert.Equal(t, tt.line, exprErr.Line, "line")
+			assert.Equal(t, tt.column, exprErr.Column, "column")
+		})
+	}
+}
+
+func BenchmarkProgram_Eval(b *testing.B) {
+	program, err := Compile(`(geo.country in ["US","CA"] and device.type == 4) or segment("sports")`)
+	require.NoError(b, err)
+	env := testEnv()
+
+	for i := 0; i < b.N; i++ {
+		program.Eval(env)
+	}
+}
@@ -0,0 +1,173 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/pkg/kafka"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var ErrNoBudgetHold = errors.New("no pending budget hold for bid")
+
+// ErrUnexpandedMacro is returned for notices whose exchange left a macro
+// unexpanded that no stored auction can fill.
+var ErrUnexpandedMacro = errors.New("unexpanded macro with no stored auction to fill it")
+
+var noticeCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "auction_notices_total",
+	Help: "Total number of win, billing and loss notices",
+}, []string{"type"})
+
+// TrackWin records a win notice. Like the billing and loss notices, it takes
+// the test flag from the bid's budget hold, since anyone can add test=1 to a
+// notice URL. The URL's flag only stands for bids without a hold.
+func (s *Service) TrackWin(ctx context.Context, notice *models.AuctionNotice) error {
+	notice.Type = models.NoticeTypeWin
+
+	hold, err := s.campaignService.BudgetHold(ctx, notice.BidID)
+	if err != nil {
+		return err
+	}
+	if hold != nil {
+		notice.Test = hold.Test
+	}
+
+	return s.recordNotice(ctx, notice, "wins")
+}
+
+// TrackBilling bills the budget held for the bid at auction time. Notices for
+// holds that were already billed or released return ErrNoBudgetHold.
+func (s *Service) TrackBilling(ctx context.Context, notice *models.AuctionNotice) error {
+	notice.Type = models.NoticeTypeBilling
+
+	hold, charged, err := s.campaignService.BillBudgetHold(ctx, notice.BidID, notice.Price)
+	if err != nil {
+		return err
+	}
+	if hold == nil {
+		return ErrNoBudgetHold
+	}
+
+	notice.CampaignID = hold.CampaignID
+	notice.Test = hold.Test
+	notice.Charged = charged
+
+	if !notice.Test {
+		if err := s.redis.IncrementDelivery(hold.CampaignID.String()); err != nil {
+			s.logger.WithError(err).Error("Failed to increment delivery in Redis")
+		}
+	}
+
+	return s.recordNotice(ctx, notice, "billed")
+}
+
+func (s *Service) TrackLoss(ctx context.Context, notice *models.AuctionNotice) error {
+	notice.Type = models.NoticeTypeLoss
+
+	hold, err := s.campaignService.ReleaseBudgetHold(ctx, notice.BidID)
+	if err != nil {
+		return err
+	}
+	if hold != nil {
+		notice.CampaignID = hold.CampaignID
+		notice.Test = hold.Test
+	}
+
+	return s.recordNotice(ctx, notice, "losses")
+}
+
+// FillNotice fills in the auction ID, when empty, and the price, when
+// fillPrice is set, of a notice whose exchange left their macros
+// unexpanded. Both come from the bid's budget hold while it is pending, and
+// the price from the cached auction result after that.
+func (s *Service) FillNotice(ctx context.Context, notice *models.AuctionNotice, fillPrice bool) error {
+	if notice.AuctionID != "" && !fillPrice {
+		return nil
+	}
+
+	hold, err := s.campaignService.BudgetHold(ctx, notice.BidID)
+	if err != nil {
+		return err
+	}
+	if hold != nil {
+		if notice.AuctionID == "" {
+			notice.AuctionID = hold.AuctionID
+		}
+		if fillPrice {
+			notice.Price = hold.Amount
+			fillPrice = false
+		}
+	}
+
+	if fillPrice && notice.AuctionID != "" {
+		price, found, err := s.clearingPrice(notice.AuctionID, notice.BidID)
+		if err != nil {
+			return err
+		}
+		if found {
+			notice.Price = price
+			fillPrice = false
+		}
+	}
+
+	if notice.AuctionID == "" || fillPrice {
+		return ErrUnexpandedMacro
+	}
+	return nil
+}
+
+// clearingPrice looks the bid's clearing price up in the auction's cached
+// results.
+func (s *Service) clearingPrice(auctionID, bidID string) (float64, bool, error) {
+	data, err := s.redis.GetCachedBidRequest(auctionID)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get cached auction result: %w", err)
+	}
+	if data == nil {
+		return 0, false, nil
+	}
+
+	var results []models.AuctionResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return 0, false, fmt.Errorf("invalid cached auction result: %w", err)
+	}
+
+	for _, result := range results {
+		if result.WinningBidID != nil && result.WinningBidID.String() == bidID {
+			return result.WinningPrice, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// recordNotice counts the notice and publishes it. Notices for test bids held
+// no budget and only go to the test topic.
+func (s *Service) recordNotice(ctx context.Context, notice *models.AuctionNotice, metric string) error {
+	timer := prometheus.NewTimer(trackingLatency.WithLabelValues(string(notice.Type)))
+	defer timer.ObserveDuration()
+
+	notice.Timestamp = time.Now()
+	topic := fmt.Sprintf("%s-notices", notice.Type)
+
+	if notice.Test {
+		topic = kafka.TestTopic(topic)
+	} else {
+		noticeCounter.WithLabelValues(string(notice.Type)).Inc()
+
+		if err := s.redis.IncrementMetric(metric, notice.CampaignID.String()); err != nil {
+			s.logger.WithError(err).Error("Failed to increment notice metric in Redis")
+		}
+	}
+
+	if err := s.kafka.PublishEvent(ctx, s.brokers, topic, notice); err != nil {
+		s.logger.WithError(err).WithField("topic", topic).Error("Failed to publish notice to Kafka")
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package tracking
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ad-delivery-simulator/internal/campaign"
+	"github.com/ad-delivery-simulator/internal/models"
+	"github.com/ad-delivery-simulator/internal/sqltest"
+	"github.com/ad-delivery-simulator/pkg/kafka"
+	"github.com/ad-delivery-simulator/pkg/redis"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newNoticeService(t *testing.T) (*Service, *miniredis.Miniredis, *redis.Client) {
+	server := miniredis.RunT(t)
+	redisClient, err := redis.NewClient(server.Addr(), "", 0, logrus.New())
+	require.NoError(t, err)
+	t.Cleanup(func() { redisClient.Close() })
+
+	db, mock := sqltest.Open(t)
+	mock.OnExec("UPDATE campaigns", 1)
+
+	logger := logrus.New()
+	brokers := []string{"127.0.0.1:1"}
+	producer := kafka.NewProducer(brokers, logger)
+	campaignService := campaign.NewService(db, redisClient, producer, brokers, logger)
+	return NewService(db, redisClient, producer, campaignService, brokers, logger), server, redisClient
+}
+
+func placeHold(t *testing.T, s *Service, hold *models.BudgetHold) {
+	allowed, err := s.campaignService.HoldBudget(context.Background(), hold, time.Minute)
+	require.NoError(t, err)
+	require.True(t, allowed)
+}
+
+func TestService_TrackBilling_TestFlagFromHold(t *testing.T) {
+	s, server, redisClient := newNoticeService(t)
+	ctx := context.Background()
+	campaignID := uuid.New()
+	require.NoError(t, redisClient.SetCampaignBudget(campaignID.String(), 10, 100))
+
+	placeHold(t, s, &models.BudgetHold{BidID: "real", CampaignID: campaignID, Amount: 2})
+	placeHold(t, s, &models.BudgetHold{BidID: "test", CampaignID: campaignID, Amount: 2, Test: true})
+
+	billed := &models.AuctionNotice{BidID: "real", Price: 2, Test: true}
+	require.NoError(t, s.TrackBilling(ctx, billed))
+	assert.False(t, billed.Test, "test=1 on the URL doesn't turn a real bid into a test")
+	assert.Equal(t, campaignID, billed.CampaignID)
+	assert.Equal(t, 2.0, billed.Charged)
+
+	test := &models.AuctionNotice{BidID: "test", Price: 2}
+	require.NoError(t, s.TrackBilling(ctx, test))
+	assert.True(t, test.Test, "dropping test=1 from the URL doesn't bill a test bid")
+
+	delivered, err := server.Get("delivery:" + campaignID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "1", delivered)
+
+	assert.ErrorIs(t, s.TrackBilling(ctx, &models.AuctionNotice{BidID: "test", Price: 2}), ErrNoBudgetHold)
+	assert.ErrorIs(t, s.TrackBilling(ctx, &models.AuctionNotice{BidID: "unknown", Price: 2, Test: true}), ErrNoBudgetHold)
+}
+
+func TestService_TrackLoss_TestFlagFromHold(t *testing.T) {
+	s, _, _ := newNoticeService(t)
+	ctx := context.Background()
+
+	placeHold(t, s, &models.BudgetHold{BidID: "test", CampaignID: uuid.New(), Amount: 2, Test: true})
+
+	loss := &models.AuctionNotice{BidID: "test"}
+	require.NoError(t, s.TrackLoss(ctx, loss))
+	assert.True(t, loss.Test)
+
+	held, err := s.campaignService.BudgetHold(ctx, "test")
+	require.NoError(t, err)
+	assert.Nil(t, held, "the loss releases the hold")
+
+	unknown := &models.AuctionNotice{BidID: "unknown", Test: true}
+	require.NoError(t, s.TrackLoss(ctx, unknown))
+	assert.True(t, unknown.Test, "bids without a hold keep the URL's flag")
+}
+
+func TestService_FillNotice(t *testing.T) {
+	s, _, redisClient := newNoticeService(t)
+	ctx := context.Background()
+	campaignID := uuid.New()
+	require.NoError(t, redisClient.SetCampaignBudget(campaignID.String(), 10, 100))
+
+	placeHold(t, s, &models.BudgetHold{BidID: "pending", CampaignID: campaignID, AuctionID: "auction-1", Amount: 1.25})
+
+	notice := &models.AuctionNotice{BidID: "pending"}
+	require.NoError(t, s.FillNotice(ctx, notice, true))
+	assert.Equal(t, "auction-1", notice.AuctionID)
+	assert.Equal(t, 1.25, notice.Price)
+
+	notice = &models.AuctionNotice{BidID: "pending", AuctionID: "auction-1", Price: 1}
+	require.NoError(t, s.FillNotice(ctx, notice, false))
+	assert.Equal(t, 1.0, notice.Price, "expanded prices are kept")
+
+	billedID := uuid.New()
+	require.NoError(t, redisClient.CacheBidRequest("auction-2", []*models.AuctionResult{
+		{BidRequestID: "auction-2", WinningBidID: &billedID, WinningPrice: 0.75},
+	}, time.Minute))
+
+	notice = &models.AuctionNotice{BidID: billedID.String(), AuctionID: "auction-2"}
+	require.NoError(t, s.FillNotice(ctx, notice, true))
+	assert.Equal(t, 0.75, notice.Price, "settled bids are priced from the cached auction result")
+
+	assert.ErrorIs(t, s.FillNotice(ctx, &models.AuctionNotice{BidID: billedID.String()}, true), ErrUnexpandedMacro,
+		"the auction ID is only stored on the hold")
+	assert.ErrorIs(t, s.FillNotice(ctx, &models.AuctionNotice{BidID: uuid.NewString(), AuctionID: "auction-2"}, true), ErrUnexpandedMacro)
+	assert.ErrorIs(t, s.FillNotice(ctx, &models.AuctionNotice{BidID: "unknown", AuctionID: "auction-3"}, true), ErrUnexpandedMacro)
+}
@@ -97,6 +97,10 @@ func (s *Service) TrackImpression(ctx context.Context, event *models.TrackingEve
 	event.Type = models.EventTypeImpression
 	event.Timestamp = time.Now()
 
+	if event.Test {
+		return s.trackTestEvent(ctx, event, "impressions")
+	}
+
 	if err := s.validateAndEnrichEvent(ctx, event); err != nil {
 		return fmt.Errorf("failed to validate impression event: %w", err)
 	}
@@ -137,6 +141,10 @@ func (s *Service) TrackClick(ctx context.Context, event *models.TrackingEvent) e
 	event.Type = models.EventTypeClick
 	event.Timestamp = time.Now()
 
+	if event.Test {
+		return s.trackTestEvent(ctx, event, "clicks")
+	}
+
 	if err := s.validateAndEnrichEvent(ctx, event); err != nil {
 		return fmt.Errorf("failed to validate click event: %w", err)
 	}
@@ -177,6 +185,10 @@ func (s *Service) TrackConversion(ctx context.Context, event *models.TrackingEve
 	event.Type = models.EventTypeConversion
 	event.Timestamp = time.Now()
 
+	if event.Test {
+		return s.trackTestEvent(ctx, event, "conversions")
+	}
+
 	if err := s.validateAndEnrichEvent(ctx, event); err != nil {
 		return fmt.Errorf("failed to validate conversion event: %w", err)
 	}
@@ -203,6 +215,68 @@ func (s *Service) TrackConversion(ctx context.Context, event *models.TrackingEve
 	return nil
 }
 
+func (s *Service) TrackVideoEvent(ctx context.Context, event *models.TrackingEvent) error {
+	if !isVideoEvent(event.Type) {
+		return fmt.Errorf("unsupported video event: %s", event.Type)
+	}
+
+	timer := prometheus.NewTimer(trackingLatency.WithLabelValues(string(event.Type)))
+	defer timer.ObserveDuration()
+
+	event.ID = uuid.New()
+	event.Timestamp = time.Now()
+
+	if event.Test {
+		return s.trackTestEvent(ctx, event, "video-events")
+	}
+
+	if err := s.validateAndEnrichEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to validate video event: %w", err)
+	}
+
+	if err := s.redis.IncrementMetric(string(event.Type), event.CampaignID.String()); err != nil {
+		s.logger.WithError(err).Error("Failed to increment video metric in Redis")
+	}
+
+	select {
+	case s.eventBuffer <- event:
+	default:
+		s.logger.Warn("Event buffer full, processing synchronously")
+		if err := s.processEvent(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	if err := s.kafka.PublishEvent(ctx, s.brokers, "video-events", event); err != nil {
+		s.logger.WithError(err).Error("Failed to publish video event to Kafka")
+	}
+
+	return nil
+}
+
+// trackTestEvent handles events from test auctions. They are only published to
+// the test copy of topic: no metrics, frequency caps, budget or stored event.
+func (s *Service) trackTestEvent(ctx context.Context, event *models.TrackingEvent, topic string) error {
+	if event.CampaignID == uuid.Nil {
+		return fmt.Errorf("invalid campaign ID")
+	}
+
+	if err := s.kafka.PublishEvent(ctx, s.brokers, kafka.TestTopic(topic), event); err != nil {
+		s.logger.WithError(err).WithField("topic", kafka.TestTopic(topic)).Error("Failed to publish test event to Kafka")
+	}
+
+	return nil
+}
+
+func isVideoEvent(eventType models.EventType) bool {
+	switch eventType {
+	case models.EventTypeVideoStart, models.EventTypeVideoFirstQuartile, models.EventTypeVideoMidpoint,
+		models.EventTypeVideoThirdQuartile, models.EventTypeVideoComplete:
+		return true
+	}
+	return false
+}
+
 func (s *Service) validateAndEnrichEvent(ctx context.Context, event *models.TrackingEvent) error {
 	if event.CampaignID == uuid.Nil {
 		return fmt.Errorf("invalid campaign ID")
@@ -238,8 +312,9 @@ func (s *Service) processEvent(ctx context.Context, event *models.TrackingEvent)
 	query := `
 		INSERT INTO tracking_events (
 			id, type, campaign_id, creative_id, user_id, session_id,
-			ip, user_agent, referrer, price, timestamp, metadata
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			ip, user_agent, referrer, price, timestamp, metadata,
+			site_id, device_type
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 	`
 
 	metadataJSON, _ := json.Marshal(event.Metadata)
@@ -248,6 +323,7 @@ func (s *Service) processEvent(ctx context.Context, event *models.TrackingEvent)
 		event.ID, event.Type, event.CampaignID, event.CreativeID,
 		event.UserID, event.SessionID, event.IP, event.UserAgent,
 		event.Referrer, event.Price, event.Timestamp, metadataJSON,
+		event.SiteID, event.DeviceType,
 	)
 
 	if err != nil {
@@ -321,8 +397,9 @@ func (s *Service) processBatch(ctx context.Context, events []*models.TrackingEve
 	stmt, err := tx.PrepareContext(ctx, `
 		INSERT INTO tracking_events (
 			id, type, campaign_id, creative_id, user_id, session_id,
-			ip, user_agent, referrer, price, timestamp, metadata, processed_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			ip, user_agent, referrer, price, timestamp, metadata, processed_at,
+			site_id, device_type
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 	`)
 	if err != nil {
 		s.logger.WithError(err).Error("Failed to prepare statement")
@@ -339,6 +416,7 @@ func (s *Service) processBatch(ctx context.Context, events []*models.TrackingEve
 			event.ID, event.Type, event.CampaignID, event.CreativeID,
 			event.UserID, event.SessionID, event.IP, event.UserAgent,
 			event.Referrer, event.Price, event.Timestamp, metadataJSON, event.ProcessedAt,
+			event.SiteID, event.DeviceType,
 		)
 		if err != nil {
 			s.logger.WithError(err).Error("Failed to insert event in batch")
@@ -4,12 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/sirupsen/logrus"
 )
 
 type Consumer struct {
+	mu      sync.Mutex
 	readers map[string]*kafka.Reader
 	logger  *logrus.Logger
 }
@@ -23,8 +25,14 @@ func NewConsumer(logger *logrus.Logger) *Consumer {
 	}
 }
 
+// CreateReader returns the reader for topic in groupID. Readers are kept per
+// topic and group, so consumers in different groups each see every message.
 func (c *Consumer) CreateReader(topic string, brokers []string, groupID string) *kafka.Reader {
-	if reader, exists := c.readers[topic]; exists {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := topic + "/" + groupID
+	if reader, exists := c.readers[key]; exists {
 		return reader
 	}
 
@@ -37,7 +45,7 @@ func (c *Consumer) CreateReader(topic string, brokers []string, groupID string)
 		StartOffset: kafka.LastOffset,
 	})
 
-	c.readers[topic] = reader
+	c.readers[key] = reader
 	return reader
 }
 
@@ -126,9 +134,9 @@ func (c *Consumer) ProcessClick(ctx context.Context, data []byte, processor func
 }
 
 func (c *Consumer) Close() error {
-	for topic, reader := range c.readers {
+	for key, reader := range c.readers {
 		if err := reader.Close(); err != nil {
-			c.logger.WithError(err).WithField("topic", topic).Error("Failed to close Kafka reader")
+			c.logger.WithError(err).WithField("reader", key).Error("Failed to close Kafka reader")
 		}
 	}
 	return nil
@@ -21,6 +21,12 @@ func NewProducer(brokers []string, logger *logrus.Logger) *Producer {
 	}
 }
 
+// TestTopic returns the topic that test traffic for topic is published to, so
+// production consumers never see it.
+func TestTopic(topic string) string {
+	return "test-" + topic
+}
+
 func (p *Producer) GetWriter(topic string, brokers []string) *kafka.Writer {
 	if writer, exists := p.writers[topic]; exists {
 		return writer
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -115,6 +116,35 @@ func (c *Client) GetFrequencyCount(userID, campaignID string, eventType string)
 	return count, err
 }
 
+// SetUserSegments replaces a user's profile segments. A ttl of 0 keeps them
+// until they are replaced.
+func (c *Client) SetUserSegments(userID string, segments []string, ttl time.Duration) error {
+	key := fmt.Sprintf("user:segments:%s", userID)
+
+	pipe := c.rdb.TxPipeline()
+	pipe.Del(c.ctx, key)
+	if len(segments) > 0 {
+		members := make([]interface{}, len(segments))
+		for i, segment := range segments {
+			members[i] = segment
+		}
+		pipe.SAdd(c.ctx, key, members...)
+		if ttl > 0 {
+			pipe.Expire(c.ctx, key, ttl)
+		}
+	}
+
+	_, err := pipe.Exec(c.ctx)
+	return err
+}
+
+// GetUserSegments reads the user's profile segments. It takes ctx so the
+// auction can bound the read by its own deadline.
+func (c *Client) GetUserSegments(ctx context.Context, userID string) ([]string, error) {
+	key := fmt.Sprintf("user:segments:%s", userID)
+	return c.rdb.SMembers(ctx, key).Result()
+}
+
 func (c *Client) AddBidToAuction(auctionID string, bid interface{}, expiry time.Duration) error {
 	bidJSON, err := json.Marshal(bid)
 	if err != nil {
@@ -163,6 +193,31 @@ func (c *Client) GetMetrics(metricType, campaignID string, date string) (int64,
 	return count, err
 }
 
+// IncrementDelivery counts a billed impression toward the campaign's
+// lifetime delivery.
+func (c *Client) IncrementDelivery(campaignID string) error {
+	key := fmt.Sprintf("delivery:%s", campaignID)
+	return c.rdb.Incr(c.ctx, key).Err()
+}
+
+// GetDelivery returns the campaign's lifetime and daily billed impressions.
+func (c *Client) GetDelivery(campaignID string, date string) (total, daily int64, err error) {
+	pipe := c.rdb.Pipeline()
+	totalCmd := pipe.Get(c.ctx, fmt.Sprintf("delivery:%s", campaignID))
+	dailyCmd := pipe.Get(c.ctx, fmt.Sprintf("metrics:billed:%s:%s", campaignID, date))
+	if _, err := pipe.Exec(c.ctx); err != nil && err != redis.Nil {
+		return 0, 0, err
+	}
+
+	if total, err = totalCmd.Int64(); err != nil && err != redis.Nil {
+		return 0, 0, err
+	}
+	if daily, err = dailyCmd.Int64(); err != nil && err != redis.Nil {
+		return 0, 0, err
+	}
+	return total, daily, nil
+}
+
 func (c *Client) PublishEvent(channel string, event interface{}) error {
 	eventJSON, err := json.Marshal(event)
 	if err != nil {
@@ -201,7 +256,41 @@ func (c *Client) CacheBidRequest(requestID string, request interface{}, ttl time
 
 func (c *Client) GetCachedBidRequest(requestID string) ([]byte, error) {
 	key := fmt.Sprintf("bidrequest:%s", requestID)
-	return c.rdb.Get(c.ctx, key).Bytes()
+	data, err := c.rdb.Get(c.ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (c *Client) CacheAuctionTrace(requestID string, trace interface{}, ttl time.Duration) error {
+	key := fmt.Sprintf("bidrequest:%s:trace", requestID)
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Set(c.ctx, key, data, ttl).Err()
+}
+
+func (c *Client) GetAuctionTrace(requestID string) ([]byte, error) {
+	key := fmt.Sprintf("bidrequest:%s:trace", requestID)
+	data, err := c.rdb.Get(c.ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (c *Client) SavePredictionModel(snapshot []byte) error {
+	return c.rdb.Set(c.ctx, "prediction:model", snapshot, 0).Err()
+}
+
+func (c *Client) GetPredictionModel() ([]byte, error) {
+	data, err := c.rdb.Get(c.ctx, "prediction:model").Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return data, err
 }
 
 func (c *Client) RateLimitCheck(identifier string, limit int, window time.Duration) (bool, error) {
@@ -229,4 +318,179 @@ func (c *Client) RateLimitCheck(identifier string, limit int, window time.Durati
 	}
 	
 	return result == 1, nil
-}
\ No newline at end of file
+}
+
+const budgetHoldsKey = "budget:holds"
+
+// budgetHoldRetention keeps a hold past its billing window long enough for
+// the expired-hold sweep to release it, after which Redis drops it.
+const budgetHoldRetention = time.Hour
+
+// BudgetHold is a winning bid's reservation against its campaign's budgets.
+// Test holds reserve nothing and only record the bid for its notices.
+type BudgetHold struct {
+	CampaignID string
+	AuctionID  string
+	Amount     float64
+	Test       bool
+}
+
+func budgetHoldKey(bidID string) string {
+	return fmt.Sprintf("budget:hold:%s", bidID)
+}
+
+// HoldBudget reserves hold.Amount from the campaign's budgets and records the
+// hold under the bid ID until it is billed, released, or expires after ttl.
+func (c *Client) HoldBudget(bidID string, hold BudgetHold, ttl time.Duration) (bool, error) {
+	dailyKey := fmt.Sprintf("campaign:budget:daily:%s", hold.CampaignID)
+	totalKey := fmt.Sprintf("campaign:budget:total:%s", hold.CampaignID)
+
+	script := `
+		local daily_key = KEYS[1]
+		local total_key = KEYS[2]
+		local hold_key = KEYS[3]
+		local holds_key = KEYS[4]
+		local amount = tonumber(ARGV[1])
+
+		if ARGV[4] ~= '1' then
+			local daily_budget = redis.call('get', daily_key)
+			local total_budget = redis.call('get', total_key)
+
+			if not daily_budget or not total_budget then
+				return 0
+			end
+
+			if tonumber(daily_budget) < amount or tonumber(total_budget) < amount then
+				return 0
+			end
+
+			redis.call('incrbyfloat', daily_key, -amount)
+			redis.call('incrbyfloat', total_key, -amount)
+		end
+
+		redis.call('hset', hold_key, 'campaign_id', ARGV[2], 'auction_id', ARGV[3], 'amount', ARGV[1], 'test', ARGV[4])
+		redis.call('expire', hold_key, ARGV[7])
+		redis.call('zadd', holds_key, ARGV[5], ARGV[6])
+		return 1
+	`
+
+	test := "0"
+	if hold.Test {
+		test = "1"
+	}
+	expiresAt := time.Now().Add(ttl).Unix()
+	retention := int64((ttl + budgetHoldRetention).Seconds())
+
+	result, err := c.rdb.Eval(c.ctx, script, []string{dailyKey, totalKey, budgetHoldKey(bidID), budgetHoldsKey},
+		hold.Amount, hold.CampaignID, hold.AuctionID, test, expiresAt, bidID, retention).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return result == 1, nil
+}
+
+// GetBudgetHold returns the pending hold for the bid, nil when there is none.
+func (c *Client) GetBudgetHold(bidID string) (*BudgetHold, error) {
+	fields, err := c.rdb.HMGet(c.ctx, budgetHoldKey(bidID), "campaign_id", "auction_id", "amount", "test").Result()
+	if err != nil {
+		return nil, err
+	}
+	if fields[0] == nil {
+		return nil, nil
+	}
+
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		values[i], _ = field.(string)
+	}
+	return parseBudgetHold(values)
+}
+
+// SettleBudgetHold closes a hold, keeping up to charge of the held amount as
+// spend and returning the rest to the campaign's budgets. It returns the
+// closed hold, nil when the hold was already settled or released.
+func (c *Client) SettleBudgetHold(bidID string, charge float64) (*BudgetHold, float64, error) {
+	holdKey := budgetHoldKey(bidID)
+
+	// The budget keys depend on the hold's campaign, so it is read first and
+	// the script gives up if the hold changed in between.
+	campaignID, err := c.rdb.HGet(c.ctx, holdKey, "campaign_id").Result()
+	if err == redis.Nil {
+		// A hold past its retention is gone, so its sweep entry is too.
+		return nil, 0, c.rdb.ZRem(c.ctx, budgetHoldsKey, bidID).Err()
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	dailyKey := fmt.Sprintf("campaign:budget:daily:%s", campaignID)
+	totalKey := fmt.Sprintf("campaign:budget:total:%s", campaignID)
+
+	script := `
+		local hold_key = KEYS[1]
+		local holds_key = KEYS[2]
+		local daily_key = KEYS[3]
+		local total_key = KEYS[4]
+
+		local hold = redis.call('hmget', hold_key, 'campaign_id', 'auction_id', 'amount', 'test')
+		if hold[1] ~= ARGV[3] then
+			return false
+		end
+
+		local held = tonumber(hold[3])
+		local charged = math.min(held, math.max(tonumber(ARGV[1]), 0))
+		local refund = held - charged
+		if hold[4] ~= '1' and refund > 0 then
+			redis.call('incrbyfloat', daily_key, refund)
+			redis.call('incrbyfloat', total_key, refund)
+		end
+
+		redis.call('del', hold_key)
+		redis.call('zrem', holds_key, ARGV[2])
+		return {hold[1], hold[2] or '', hold[3], hold[4] or '', tostring(charged)}
+	`
+
+	result, err := c.rdb.Eval(c.ctx, script, []string{holdKey, budgetHoldsKey, dailyKey, totalKey},
+		charge, bidID, campaignID).StringSlice()
+	if err == redis.Nil {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hold, err := parseBudgetHold(result[:4])
+	if err != nil {
+		return nil, 0, err
+	}
+	charged, err := strconv.ParseFloat(result[4], 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid charged amount %q: %w", result[4], err)
+	}
+
+	return hold, charged, nil
+}
+
+// parseBudgetHold reads a hold's campaign_id, auction_id, amount and test
+// fields, in that order.
+func parseBudgetHold(values []string) (*BudgetHold, error) {
+	amount, err := strconv.ParseFloat(values[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hold amount %q: %w", values[2], err)
+	}
+
+	return &BudgetHold{
+		CampaignID: values[0],
+		AuctionID:  values[1],
+		Amount:     amount,
+		Test:       values[3] == "1",
+	}, nil
+}
+
+// ExpiredBudgetHolds returns the bid IDs of holds whose billing window has passed.
+func (c *Client) ExpiredBudgetHolds(now time.Time) ([]string, error) {
+	return c.rdb.ZRangeByScore(c.ctx, budgetHoldsKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("%d", now.Unix()),
+	}).Result()
+}
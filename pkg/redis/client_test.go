@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) (*Client, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client, err := NewClient(server.Addr(), "", 0, logrus.New())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func budgets(t *testing.T, c *Client, campaignID string) (daily, total float64) {
+	daily, err := c.rdb.Get(c.ctx, "campaign:budget:daily:"+campaignID).Float64()
+	require.NoError(t, err)
+	total, err = c.rdb.Get(c.ctx, "campaign:budget:total:"+campaignID).Float64()
+	require.NoError(t, err)
+	return daily, total
+}
+
+func TestClient_HoldBudget(t *testing.T) {
+	c, server := newTestClient(t)
+	require.NoError(t, c.SetCampaignBudget("c-1", 10, 100))
+
+	allowed, err := c.HoldBudget("bid-1", BudgetHold{CampaignID: "c-1", AuctionID: "auction-1", Amount: 4}, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	daily, total := budgets(t, c, "c-1")
+	assert.Equal(t, 6.0, daily)
+	assert.Equal(t, 96.0, total)
+
+	hold, err := c.GetBudgetHold("bid-1")
+	require.NoError(t, err)
+	assert.Equal(t, &BudgetHold{CampaignID: "c-1", AuctionID: "auction-1", Amount: 4}, hold)
+	assert.Equal(t, time.Minute+budgetHoldRetention, server.TTL("budget:hold:bid-1"))
+
+	allowed, err = c.HoldBudget("bid-2", BudgetHold{CampaignID: "c-1", AuctionID: "auction-2", Amount: 7}, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, allowed, "the hold exceeds the remaining daily budget")
+	assert.False(t, server.Exists("budget:hold:bid-2"))
+
+	allowed, err = c.HoldBudget("bid-3", BudgetHold{CampaignID: "c-2", Amount: 1}, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, allowed, "campaigns without budgets can't hold")
+
+	hold, err = c.GetBudgetHold("bid-3")
+	require.NoError(t, err)
+	assert.Nil(t, hold)
+}
+
+func TestClient_HoldBudget_Test(t *testing.T) {
+	c, server := newTestClient(t)
+
+	allowed, err := c.HoldBudget("bid-1", BudgetHold{CampaignID: "c-1", AuctionID: "auction-1", Amount: 4, Test: true}, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, allowed, "test holds don't need a budget")
+	assert.False(t, server.Exists("campaign:budget:daily:c-1"))
+
+	hold, err := c.GetBudgetHold("bid-1")
+	require.NoError(t, err)
+	assert.True(t, hold.Test)
+
+	settled, charged, err := c.SettleBudgetHold("bid-1", 0)
+	require.NoError(t, err)
+	assert.True(t, settled.Test)
+	assert.Equal(t, 0.0, charged)
+	assert.False(t, server.Exists("campaign:budget:daily:c-1"), "test holds refund nothing")
+}
+
+func TestClient_SettleBudgetHold(t *testing.T) {
+	tests := []struct {
+		name            string
+		charge          float64
+		expectedCharged float64
+		expectedDaily   float64
+	}{
+		{"Billed below the hold", 2.5, 2.5, 7.5},
+		{"Billed at the hold", 4, 4, 6},
+		{"Billed above the hold", 9, 4, 6},
+		{"Released", 0, 0, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, server := newTestClient(t)
+			require.NoError(t, c.SetCampaignBudget("c-1", 10, 100))
+			allowed, err := c.HoldBudget("bid-1", BudgetHold{CampaignID: "c-1", AuctionID: "auction-1", Amount: 4}, time.Minute)
+			require.NoError(t, err)
+			require.True(t, allowed)
+
+			hold, charged, err := c.SettleBudgetHold("bid-1", tt.charge)
+			require.NoError(t, err)
+			assert.Equal(t, &BudgetHold{CampaignID: "c-1", AuctionID: "auction-1", Amount: 4}, hold)
+			assert.Equal(t, tt.expectedCharged, charged)
+
+			daily, total := budgets(t, c, "c-1")
+			assert.Equal(t, tt.expectedDaily, daily)
+			assert.Equal(t, 90+tt.expectedDaily, total)
+
+			assert.False(t, server.Exists("budget:hold:bid-1"))
+			expired, err := c.ExpiredBudgetHolds(time.Now().Add(time.Hour))
+			require.NoError(t, err)
+			assert.Empty(t, expired)
+
+			hold, _, err = c.SettleBudgetHold("bid-1", tt.charge)
+			require.NoError(t, err)
+			assert.Nil(t, hold, "a hold settles once")
+			daily, _ = budgets(t, c, "c-1")
+			assert.Equal(t, tt.expectedDaily, daily)
+		})
+	}
+}
+
+func TestClient_ExpiredBudgetHolds(t *testing.T) {
+	c, server := newTestClient(t)
+	require.NoError(t, c.SetCampaignBudget("c-1", 10, 100))
+
+	for bidID, ttl := range map[string]time.Duration{"bid-1": time.Minute, "bid-2": time.Hour} {
+		allowed, err := c.HoldBudget(bidID, BudgetHold{CampaignID: "c-1", Amount: 1}, ttl)
+		require.NoError(t, err)
+		require.True(t, allowed)
+	}
+
+	expired, err := c.ExpiredBudgetHolds(time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+
+	expired, err = c.ExpiredBudgetHolds(time.Now().Add(2 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bid-1"}, expired)
+
+	server.FastForward(time.Minute + budgetHoldRetention)
+	assert.False(t, server.Exists("budget:hold:bid-1"), "holds past their retention expire")
+
+	hold, _, err := c.SettleBudgetHold("bid-1", 0)
+	require.NoError(t, err)
+	assert.Nil(t, hold)
+
+	expired, err = c.ExpiredBudgetHolds(time.Now().Add(2 * time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, expired, "settling an expired hold drops it from the sweep")
+}
@@ -124,6 +124,7 @@ func sendImpressionEvent(client *http.Client, stats *LoadTestStats) {
 		"campaign_id": uuid.New().String(),
 		"user_id":     fmt.Sprintf("user-%d", rand.Intn(10000)),
 		"session_id":  uuid.New().String(),
+		"test":        1,
 	}
 
 	body, err := json.Marshal(impression)
@@ -156,6 +157,7 @@ func sendClickEvent(client *http.Client, stats *LoadTestStats) {
 		"campaign_id": uuid.New().String(),
 		"user_id":     fmt.Sprintf("user-%d", rand.Intn(10000)),
 		"session_id":  uuid.New().String(),
+		"test":        1,
 	}
 
 	body, err := json.Marshal(click)
@@ -232,6 +234,7 @@ func generateBidRequest() *models.BidRequest {
 		AT:   2,
 		TMax: 100,
 		Cur:  []string{"USD"},
+		Test: 1,
 	}
 }
 